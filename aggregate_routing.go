@@ -0,0 +1,207 @@
+package eventhorizon
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// Error returned when a route is not a func(aggregate, *Command) error or a
+// func(aggregate, *Event).
+var ErrInvalidRoute = errors.New("invalid route")
+
+// CommandRouteError is returned when a routed aggregate has no method for a
+// command, see RouteCommand and RegisterRoutes.
+type CommandRouteError struct {
+	AggregateType string
+	CommandType   string
+}
+
+func (e CommandRouteError) Error() string {
+	return "aggregate " + e.AggregateType + " has no route for command " + e.CommandType
+}
+
+// aggregateRoutes are the methods of an aggregate type that handle commands
+// and apply events, by the type of the command or event. The methods take
+// the aggregate as first argument. Registered aggregate types have been
+// registered with RegisterRoutes.
+type aggregateRoutes struct {
+	commands   map[reflect.Type]reflect.Value
+	events     map[reflect.Type]reflect.Value
+	registered bool
+}
+
+// aggregateRouteTable has the routes of all aggregate types. They are
+// replaced, not changed, when routes are registered so they can be used
+// without the lock.
+var aggregateRouteTable = struct {
+	sync.RWMutex
+	aggregates map[reflect.Type]*aggregateRoutes
+}{aggregates: make(map[reflect.Type]*aggregateRoutes)}
+
+var (
+	commandInterface = reflect.TypeOf((*Command)(nil)).Elem()
+	eventInterface   = reflect.TypeOf((*Event)(nil)).Elem()
+	errorInterface   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// RegisterRoutes registers an aggregate as routing its commands, and methods
+// of it that handle commands or apply events, in addition to the methods found
+// by RouteCommand and RouteEvent. A route is a method expression of the
+// aggregate, like (*InvitationAggregate).create, that takes a command and
+// returns an error or takes an event. Returns ErrInvalidRoute for other funcs.
+//
+// SetAggregate of AggregateCommandHandler returns a CommandRouteError for a
+// command that a registered aggregate has no route for. It can be called
+// without funcs to only register the aggregate.
+//
+// An example would be:
+//     eventhorizon.RegisterRoutes(&InvitationAggregate{},
+//         (*InvitationAggregate).create,
+//         (*InvitationAggregate).applyCreated)
+func RegisterRoutes(aggregate Aggregate, funcs ...interface{}) error {
+	typ := reflect.TypeOf(aggregate)
+	r := routesFor(typ)
+	registered := &aggregateRoutes{
+		commands:   make(map[reflect.Type]reflect.Value, len(r.commands)),
+		events:     make(map[reflect.Type]reflect.Value, len(r.events)),
+		registered: true,
+	}
+	for t, f := range r.commands {
+		registered.commands[t] = f
+	}
+	for t, f := range r.events {
+		registered.events[t] = f
+	}
+
+	for _, fn := range funcs {
+		f := reflect.ValueOf(fn)
+		if f.Kind() != reflect.Func || f.Type().NumIn() != 2 || f.Type().In(0) != typ {
+			return ErrInvalidRoute
+		}
+		if arg, ok := commandRoute(f.Type()); ok {
+			registered.commands[arg] = f
+		} else if arg, ok := eventRoute(f.Type()); ok {
+			registered.events[arg] = f
+		} else {
+			return ErrInvalidRoute
+		}
+	}
+
+	aggregateRouteTable.Lock()
+	defer aggregateRouteTable.Unlock()
+	aggregateRouteTable.aggregates[typ] = registered
+	return nil
+}
+
+// RouteCommand handles a command with the method of the aggregate for it,
+// which is either registered with RegisterRoutes or a method named after the
+// command type, like HandleCreateInvite(*CreateInvite) error. Returns a
+// CommandRouteError if there is none.
+//
+// The methods are found once for every aggregate type. An aggregate that is
+// registered with RegisterRoutes is checked by SetAggregate of
+// AggregateCommandHandler, so that a command without a route can not be set.
+//
+// An example would be:
+//     func (i *InvitationAggregate) HandleCommand(command eventhorizon.Command) error {
+//         return i.RouteCommand(i, command)
+//     }
+func (a *AggregateBase) RouteCommand(aggregate Aggregate, command Command) error {
+	f, ok := routesFor(reflect.TypeOf(aggregate)).commands[reflect.TypeOf(command)]
+	if !ok {
+		return CommandRouteError{aggregate.AggregateType(), command.CommandType()}
+	}
+
+	out := f.Call([]reflect.Value{reflect.ValueOf(aggregate), reflect.ValueOf(command)})
+	if err, ok := out[0].Interface().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// RouteEvent applies an event with the method of the aggregate for it, which
+// is either registered with RegisterRoutes or a method named after the event
+// type, like ApplyInviteCreated(*InviteCreated). Events without a method do
+// not change the aggregate and are ignored.
+func (a *AggregateBase) RouteEvent(aggregate Aggregate, event Event) {
+	f, ok := routesFor(reflect.TypeOf(aggregate)).events[reflect.TypeOf(event)]
+	if !ok {
+		return
+	}
+	f.Call([]reflect.Value{reflect.ValueOf(aggregate), reflect.ValueOf(event)})
+}
+
+// checkCommandRoute returns a CommandRouteError if an aggregate is registered
+// with RegisterRoutes but has no route for the command. Other aggregates can
+// handle commands in any way and are not checked.
+func checkCommandRoute(aggregate Aggregate, command Command) error {
+	aggregateRouteTable.RLock()
+	r, ok := aggregateRouteTable.aggregates[reflect.TypeOf(aggregate)]
+	aggregateRouteTable.RUnlock()
+	if !ok || !r.registered {
+		return nil
+	}
+	if _, ok := r.commands[reflect.TypeOf(command)]; !ok {
+		return CommandRouteError{aggregate.AggregateType(), command.CommandType()}
+	}
+	return nil
+}
+
+// routesFor returns the routes of an aggregate type, finding its methods the
+// first time.
+func routesFor(typ reflect.Type) *aggregateRoutes {
+	aggregateRouteTable.RLock()
+	r, ok := aggregateRouteTable.aggregates[typ]
+	aggregateRouteTable.RUnlock()
+	if ok {
+		return r
+	}
+
+	r = &aggregateRoutes{
+		commands: make(map[reflect.Type]reflect.Value),
+		events:   make(map[reflect.Type]reflect.Value),
+	}
+	for i := 0; i < typ.NumMethod(); i++ {
+		method := typ.Method(i)
+		if arg, ok := commandRoute(method.Type); ok && method.Name == "Handle"+typeName(arg) {
+			r.commands[arg] = method.Func
+		} else if arg, ok := eventRoute(method.Type); ok && method.Name == "Apply"+typeName(arg) {
+			r.events[arg] = method.Func
+		}
+	}
+
+	aggregateRouteTable.Lock()
+	defer aggregateRouteTable.Unlock()
+	if registered, ok := aggregateRouteTable.aggregates[typ]; ok {
+		return registered
+	}
+	aggregateRouteTable.aggregates[typ] = r
+	return r
+}
+
+// commandRoute returns the command type of a func(aggregate, command) error.
+func commandRoute(f reflect.Type) (reflect.Type, bool) {
+	if f.NumIn() != 2 || f.NumOut() != 1 || f.Out(0) != errorInterface {
+		return nil, false
+	}
+	arg := f.In(1)
+	return arg, arg.Kind() != reflect.Interface && arg.Implements(commandInterface)
+}
+
+// eventRoute returns the event type of a func(aggregate, event).
+func eventRoute(f reflect.Type) (reflect.Type, bool) {
+	if f.NumIn() != 2 || f.NumOut() != 0 {
+		return nil, false
+	}
+	arg := f.In(1)
+	return arg, arg.Kind() != reflect.Interface && arg.Implements(eventInterface)
+}
+
+// typeName returns the name of a type, or of the type it points to.
+func typeName(typ reflect.Type) string {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Name()
+}
@@ -0,0 +1,143 @@
+package eventhorizon
+
+import (
+	"errors"
+
+	"github.com/odeke-em/go-uuid"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&AggregateRoutingSuite{})
+
+type AggregateRoutingSuite struct{}
+
+type TestRoutedAggregate struct {
+	*AggregateBase
+	contents []string
+}
+
+func (t *TestRoutedAggregate) AggregateType() string { return "TestRoutedAggregate" }
+
+func (t *TestRoutedAggregate) HandleCommand(command Command) error {
+	return t.RouteCommand(t, command)
+}
+
+func (t *TestRoutedAggregate) ApplyEvent(event Event) {
+	t.RouteEvent(t, event)
+}
+
+func (t *TestRoutedAggregate) HandleTestCommand(command *TestCommand) error {
+	if command.Content == "error" {
+		return errors.New("command error")
+	}
+	t.StoreEvent(&TestEvent{command.TestID, command.Content})
+	return nil
+}
+
+func (t *TestRoutedAggregate) ApplyTestEvent(event *TestEvent) {
+	t.contents = append(t.contents, event.Content)
+}
+
+// HandleOther is not a route, it is not named after the command type.
+func (t *TestRoutedAggregate) HandleOther(command *TestCommandOther) error {
+	return nil
+}
+
+func (t *TestRoutedAggregate) handleOther2(command *TestCommandOther2) error {
+	t.StoreEvent(&TestEvent{command.TestID, "other2"})
+	return nil
+}
+
+func (s *AggregateRoutingSuite) TestRouteCommand(c *C) {
+	aggregate := &TestRoutedAggregate{AggregateBase: NewAggregateBase(uuid.New())}
+	err := aggregate.HandleCommand(&TestCommand{aggregate.AggregateID(), "command1"})
+	c.Assert(err, IsNil)
+	c.Assert(aggregate.GetUncommittedEvents(), DeepEquals, []Event{
+		&TestEvent{aggregate.AggregateID(), "command1"},
+	})
+
+	err = aggregate.HandleCommand(&TestCommand{aggregate.AggregateID(), "error"})
+	c.Assert(err, ErrorMatches, "command error")
+
+	err = aggregate.HandleCommand(&TestCommandOther{aggregate.AggregateID(), "command2"})
+	c.Assert(err, Equals, CommandRouteError{"TestRoutedAggregate", "TestCommandOther"})
+	c.Assert(err, ErrorMatches, "aggregate TestRoutedAggregate has no route for command TestCommandOther")
+}
+
+func (s *AggregateRoutingSuite) TestRouteEvent(c *C) {
+	aggregate := &TestRoutedAggregate{AggregateBase: NewAggregateBase(uuid.New())}
+	aggregate.ApplyEvent(&TestEvent{aggregate.AggregateID(), "event1"})
+	c.Assert(aggregate.contents, DeepEquals, []string{"event1"})
+
+	// Events without a route are ignored.
+	aggregate.ApplyEvent(&TestEventOther{aggregate.AggregateID(), "event2"})
+	c.Assert(aggregate.contents, DeepEquals, []string{"event1"})
+}
+
+type TestRegisteredAggregate struct {
+	TestRoutedAggregate
+}
+
+func (t *TestRegisteredAggregate) HandleCommand(command Command) error {
+	return t.RouteCommand(t, command)
+}
+
+func (t *TestRegisteredAggregate) applyOther(event *TestEventOther) {
+	t.contents = append(t.contents, "other")
+}
+
+func (s *AggregateRoutingSuite) TestRegisterRoutes(c *C) {
+	aggregate := &TestRegisteredAggregate{TestRoutedAggregate{AggregateBase: NewAggregateBase(uuid.New())}}
+	handleOther2 := func(t *TestRegisteredAggregate, command *TestCommandOther2) error {
+		return t.handleOther2(command)
+	}
+	err := RegisterRoutes(aggregate, handleOther2, (*TestRegisteredAggregate).applyOther)
+	c.Assert(err, IsNil)
+
+	// Registered routes are added to the methods that are found.
+	err = aggregate.HandleCommand(&TestCommandOther2{aggregate.AggregateID(), "command1"})
+	c.Assert(err, IsNil)
+	err = aggregate.HandleCommand(&TestCommand{aggregate.AggregateID(), "command2"})
+	c.Assert(err, IsNil)
+	c.Assert(aggregate.GetUncommittedEvents(), DeepEquals, []Event{
+		&TestEvent{aggregate.AggregateID(), "other2"},
+		&TestEvent{aggregate.AggregateID(), "command2"},
+	})
+	aggregate.RouteEvent(aggregate, &TestEventOther{aggregate.AggregateID(), "event1"})
+	c.Assert(aggregate.contents, DeepEquals, []string{"other"})
+
+	for _, route := range []interface{}{
+		"route",
+		func(t *TestRoutedAggregate, command *TestCommandOther2) error { return nil },
+		func(t *TestRegisteredAggregate, command *TestCommandOther2) {},
+		func(t *TestRegisteredAggregate, event *TestEvent) error { return nil },
+		func(t *TestRegisteredAggregate, command Command) error { return nil },
+		func(t *TestRegisteredAggregate) error { return nil },
+	} {
+		err = RegisterRoutes(aggregate, route)
+		c.Assert(err, Equals, ErrInvalidRoute, Commentf("route: %T", route))
+	}
+}
+
+// TestUnregisteredAggregate has a method named after a command, but handles
+// its commands without routes.
+type TestUnregisteredAggregate struct {
+	TestRoutedAggregate
+}
+
+func (s *AggregateRoutingSuite) TestSetAggregate(c *C) {
+	// Aggregates that are not registered are not checked, even if they have
+	// methods named after commands.
+	handler, _ := NewAggregateCommandHandler(&MockRepository{})
+	err := handler.SetAggregate(&TestUnregisteredAggregate{}, &TestCommandOther{})
+	c.Assert(err, IsNil)
+	err = handler.SetAggregate(&TestDispatcherAggregate{}, &TestCommandOther2{})
+	c.Assert(err, IsNil)
+
+	c.Assert(RegisterRoutes(&TestRoutedAggregate{}), IsNil)
+	handler, _ = NewAggregateCommandHandler(&MockRepository{})
+	err = handler.SetAggregate(&TestRoutedAggregate{}, &TestCommand{})
+	c.Assert(err, IsNil)
+	err = handler.SetAggregate(&TestRoutedAggregate{}, &TestCommandOther{})
+	c.Assert(err, Equals, CommandRouteError{"TestRoutedAggregate", "TestCommandOther"})
+}
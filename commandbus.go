@@ -16,6 +16,7 @@ package eventhorizon
 
 import (
 	"errors"
+	"sync"
 )
 
 // ErrHandlerAlreadySet returned when a handler is already registered for a command.
@@ -24,6 +25,10 @@ var ErrHandlerAlreadySet = errors.New("handler is already set")
 // ErrHandlerNotFound returned when no handler can be found.
 var ErrHandlerNotFound = errors.New("no handlers for command")
 
+// ErrInvalidWorkerCount returned when a command bus is created with less than
+// one worker.
+var ErrInvalidWorkerCount = errors.New("invalid worker count")
+
 // CommandHandler is an interface that all handlers of commands should implement.
 type CommandHandler interface {
 	HandleCommand(Command) error
@@ -47,13 +52,16 @@ type RemoteCommandBus interface {
 }
 
 // InternalCommandBus is a command bus that handles commands with the
-// registered CommandHandlers
+// registered CommandHandlers. It is safe for concurrent use.
 type InternalCommandBus struct {
-	handlers map[string]CommandHandler
+	handlers     map[string]CommandHandler
+	handlersLock sync.RWMutex
+
+	instrumentation
 }
 
 // NewInternalCommandBus creates a InternalCommandBus.
-func NewInternalCommandBus() CommandBus {
+func NewInternalCommandBus() *InternalCommandBus {
 	b := &InternalCommandBus{
 		handlers: make(map[string]CommandHandler),
 	}
@@ -67,17 +75,45 @@ func (b *InternalCommandBus) PublishCommand(command Command) error {
 
 // HandleCommand handles a command with a handler capable of handling it.
 func (b *InternalCommandBus) HandleCommand(command Command) error {
-	if handler, ok := b.handlers[command.CommandType()]; ok {
-		return handler.HandleCommand(command)
+	return b.handleCommandTraced(SpanContext{}, command)
+}
+
+// traced returns the bus, see isTraced.
+func (b *InternalCommandBus) traced() interface{} { return b }
+
+// handleCommandTraced handles a command as a child of parent.
+func (b *InternalCommandBus) handleCommandTraced(parent SpanContext, command Command) (err error) {
+	context, done := b.observeCommand("internal_command_bus", parent, command)
+	defer done(&err)
+
+	b.handlersLock.RLock()
+	handler, ok := b.handlers[command.CommandType()]
+	b.handlersLock.RUnlock()
+	if ok {
+		return handleCommand(handler, context, command)
 	}
 	return ErrHandlerNotFound
 }
 
 // SetHandler adds a handler for a specific command.
 func (b *InternalCommandBus) SetHandler(handler CommandHandler, command Command) error {
+	b.handlersLock.Lock()
+	defer b.handlersLock.Unlock()
 	if _, ok := b.handlers[command.CommandType()]; ok {
 		return ErrHandlerAlreadySet
 	}
 	b.handlers[command.CommandType()] = handler
 	return nil
 }
+
+// RemoveHandler removes the handler for a specific command. Returns
+// ErrHandlerNotFound if no handler is set.
+func (b *InternalCommandBus) RemoveHandler(command Command) error {
+	b.handlersLock.Lock()
+	defer b.handlersLock.Unlock()
+	if _, ok := b.handlers[command.CommandType()]; !ok {
+		return ErrHandlerNotFound
+	}
+	delete(b.handlers, command.CommandType())
+	return nil
+}
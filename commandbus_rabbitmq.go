@@ -3,9 +3,10 @@ package eventhorizon
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"sync"
+	"time"
 
-	"github.com/doubledutch/lager"
 	"github.com/streadway/amqp"
 )
 
@@ -14,6 +15,10 @@ const (
 	commandExchangeType = "topic"
 	commandQueueName    = "commands.queue"
 	commandKey          = "#"
+
+	// commandWorkerBacklog is the number of commands that can be queued for
+	// each worker before the delivery loop blocks.
+	commandWorkerBacklog = 64
 )
 
 // RabbitMQCommandBus implements CommandBus using RabbitMQ.
@@ -26,31 +31,45 @@ type RabbitMQCommandBus struct {
 	factoriesLock sync.Mutex
 	factories     map[string]func() Command
 	done          chan error
+	workers       []chan rabbitMQCommand
+	workersWait   sync.WaitGroup
 
 	exchange string
 	queue    string
 	tag      string
 
-	lgr lager.ContextLager
+	logging
+	instrumentation
 }
 
 // NewRabbitMQCommandBus creates a new RabbitMQ command bus. amqpURI is the RabbitMQ
 // URI for rabbitmq. app is provides a namespace for this application, allowing
 // for multiple command buses to run on one RabbitMQ and not conflict with eachother.
-// tag is used as the RabbitMQ consumer tag for this bus.
+// tag is used as the RabbitMQ consumer tag for this bus. The bus logs to lager
+// until another logger is set with SetLogger.
 func NewRabbitMQCommandBus(amqpURI, app, tag string) (*RabbitMQCommandBus, error) {
-	lgr := lager.Child()
+	return NewRabbitMQCommandBusWithWorkers(amqpURI, app, tag, 1)
+}
+
+// NewRabbitMQCommandBusWithWorkers creates a new RabbitMQ command bus that
+// handles received commands on a pool of workers. Commands are assigned to
+// a worker by hashing their aggregate ID, so commands for different
+// aggregates are handled in parallel while commands for the same aggregate
+// are always handled in the order they were received. The bus logs to lager
+// until another logger is set with SetLogger.
+func NewRabbitMQCommandBusWithWorkers(amqpURI, app, tag string, workers int) (*RabbitMQCommandBus, error) {
+	if workers < 1 {
+		return nil, ErrInvalidWorkerCount
+	}
 
 	connection, err := amqp.Dial(amqpURI)
 	if err != nil {
-		lgr.WithError(err).Errorf("Error dialing URI: %s", amqpURI)
 		return nil, fmt.Errorf("Dial err: %s", err)
 	}
 
 	channel, err := connection.Channel()
 	if err != nil {
 		connection.Close()
-		lgr.WithError(err).Errorf("Error opening channel")
 		return nil, fmt.Errorf("Channel: %s", err)
 	}
 
@@ -68,7 +87,6 @@ func NewRabbitMQCommandBus(amqpURI, app, tag string) (*RabbitMQCommandBus, error
 	); err != nil {
 		channel.Close()
 		connection.Close()
-		lgr.WithError(err).Errorf("Error declaring exchange :%s", exchange)
 		return nil, fmt.Errorf("Exchange Declare: %s", err)
 	}
 
@@ -83,7 +101,6 @@ func NewRabbitMQCommandBus(amqpURI, app, tag string) (*RabbitMQCommandBus, error
 	if err != nil {
 		channel.Close()
 		connection.Close()
-		lgr.WithError(err).Errorf("Error declaring queue %s", queueName)
 		return nil, fmt.Errorf("Queue Declare: %s", err)
 	}
 
@@ -96,7 +113,6 @@ func NewRabbitMQCommandBus(amqpURI, app, tag string) (*RabbitMQCommandBus, error
 	); err != nil {
 		channel.Close()
 		connection.Close()
-		lgr.WithError(err).Errorf("Error binding queue %s", queueName)
 		return nil, fmt.Errorf("Queue Bind: %s", err)
 	}
 
@@ -112,7 +128,6 @@ func NewRabbitMQCommandBus(amqpURI, app, tag string) (*RabbitMQCommandBus, error
 	if err != nil {
 		channel.Close()
 		connection.Close()
-		lgr.WithError(err).Errorf("Error consuming queue %s", queueName)
 		return nil, fmt.Errorf("Queue Consume: %s", err)
 	}
 
@@ -125,18 +140,31 @@ func NewRabbitMQCommandBus(amqpURI, app, tag string) (*RabbitMQCommandBus, error
 		handlers:  make(map[string]CommandHandler),
 		factories: make(map[string]func() Command),
 		done:      make(chan error),
-		lgr:       lgr,
+		workers:   make([]chan rabbitMQCommand, workers),
+	}
+	bus.logToLager()
+
+	for i := range bus.workers {
+		bus.workers[i] = make(chan rabbitMQCommand, commandWorkerBacklog)
+		bus.workersWait.Add(1)
+		go bus.handleWorker(bus.workers[i])
 	}
 
 	go bus.handleCommands(deliveries, bus.done)
 	return bus, nil
 }
 
-// PublishCommand publishes a command to the commands exchange.
-func (b *RabbitMQCommandBus) PublishCommand(command Command) error {
+// PublishCommand publishes a command to the commands exchange. The command
+// has a span that is the parent of the spans of the receiving bus.
+func (b *RabbitMQCommandBus) PublishCommand(command Command) (err error) {
+	span := b.startSpan("publish_command", SpanContext{},
+		spanAttributes("rabbitmq_command_bus", commandFields(command)))
+	defer span.end(&err)
+
 	d, err := json.Marshal(command)
 	if err != nil {
-		b.lgr.WithError(err).Errorf("Unable to marshal command")
+		b.logger().WithError(err).With(commandFields(command)).
+			Errorf("Unable to marshal command")
 		return err
 	}
 
@@ -146,9 +174,10 @@ func (b *RabbitMQCommandBus) PublishCommand(command Command) error {
 		false, // mandatory
 		false, // immediate
 		amqp.Publishing{
-			Headers:         amqp.Table{},
+			Headers:         amqpTraceHeaders(span.Context()),
 			ContentType:     "text/plain",
 			ContentEncoding: "",
+			Timestamp:       time.Now(),
 			Body:            d,
 			DeliveryMode:    amqp.Transient, // 1=non-persistent, 2=persistent
 			Priority:        0,              // 0-9
@@ -156,7 +185,8 @@ func (b *RabbitMQCommandBus) PublishCommand(command Command) error {
 		})
 
 	if err != nil {
-		b.lgr.WithError(err).Errorf("Unable to publish command")
+		b.logger().WithError(err).With(commandFields(command)).
+			Errorf("Unable to publish command")
 	}
 
 	return err
@@ -176,48 +206,98 @@ func (b *RabbitMQCommandBus) Close() error {
 	return <-b.done
 }
 
+// rabbitMQCommand is a received command waiting to be handled by a worker.
+type rabbitMQCommand struct {
+	delivery amqp.Delivery
+	command  Command
+}
+
 func (b *RabbitMQCommandBus) handleCommands(deliveries <-chan amqp.Delivery, done chan error) {
 	for d := range deliveries {
 		b.factoriesLock.Lock()
 		f, ok := b.factories[d.RoutingKey]
 		b.factoriesLock.Unlock()
 		if !ok {
-			b.lgr.With(map[string]string{
+			b.logger().With(map[string]string{
 				"commandType": d.RoutingKey,
-			}).Debugf("No factory for command type")
+			}).Warnf("No factory for command type")
 			d.Reject(false)
 			continue
 		}
 
 		command := f()
 		if err := json.Unmarshal(d.Body, command); err != nil {
-			b.lgr.WithError(err).With(map[string]string{
+			b.logger().WithError(err).With(map[string]string{
 				"commandType": d.RoutingKey,
 			}).Errorf("Unable to unmarshal received command")
 			d.Reject(false)
 			continue
 		}
+		if !d.Timestamp.IsZero() {
+			b.metrics().ObserveConsumerLag("rabbitmq_command_bus",
+				command.CommandType(), time.Since(d.Timestamp))
+		}
 
-		if err := b.HandleCommand(command); err != nil {
-			b.lgr.WithError(err).With(map[string]string{
-				"commandType": d.RoutingKey,
-			}).Errorf("Error handling command")
-			d.Reject(false)
+		// Commands for the same aggregate always go to the same worker to
+		// keep them ordered.
+		worker := b.workers[workerIndex(command.AggregateID(), len(b.workers))]
+		worker <- rabbitMQCommand{d, command}
+	}
+
+	for _, worker := range b.workers {
+		close(worker)
+	}
+	b.workersWait.Wait()
+
+	done <- nil
+}
+
+func (b *RabbitMQCommandBus) handleWorker(commands <-chan rabbitMQCommand) {
+	defer b.workersWait.Done()
+
+	for c := range commands {
+		// Handle the command as a child of the span of the publisher.
+		span := b.startSpan("receive_command", amqpSpanContext(c.delivery.Headers),
+			spanAttributes("rabbitmq_command_bus", commandFields(c.command)))
+		err := b.handleCommandTraced(span.Context(), c.command)
+		span.end(&err)
+		if err != nil {
+			b.logger().WithError(err).With(commandFields(c.command)).
+				Errorf("Error handling command")
+			c.delivery.Reject(false)
 			continue
 		}
 
-		b.lgr.With(map[string]string{"commandType": d.RoutingKey}).Debugf("Handled command")
-		d.Ack(false)
+		b.logger().With(commandFields(c.command)).Debugf("Handled command")
+		c.delivery.Ack(false)
 	}
-	done <- nil
+}
+
+// workerIndex returns the worker that handles commands for an aggregate.
+func workerIndex(aggregateID string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(aggregateID))
+	return int(h.Sum32() % uint32(workers))
 }
 
 // HandleCommand handles a command, dispatching it to the proper handlers.
 func (b *RabbitMQCommandBus) HandleCommand(command Command) error {
+	return b.handleCommandTraced(SpanContext{}, command)
+}
+
+// traced returns the bus, see isTraced.
+func (b *RabbitMQCommandBus) traced() interface{} { return b }
+
+// handleCommandTraced handles a command as a child of parent.
+func (b *RabbitMQCommandBus) handleCommandTraced(parent SpanContext, command Command) (err error) {
+	context, done := b.observeCommand("rabbitmq_command_bus", parent, command)
+	defer done(&err)
+
 	b.handlersLock.Lock()
-	defer b.handlersLock.Unlock()
-	if handler, ok := b.handlers[command.CommandType()]; ok {
-		return handler.HandleCommand(command)
+	handler, ok := b.handlers[command.CommandType()]
+	b.handlersLock.Unlock()
+	if ok {
+		return handleCommand(handler, context, command)
 	}
 	return ErrHandlerNotFound
 }
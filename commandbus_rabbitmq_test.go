@@ -5,11 +5,15 @@ package eventhorizon
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"sync"
 
+	"github.com/odeke-em/go-uuid"
 	. "gopkg.in/check.v1"
 )
 
 var _ = Suite(&RabbitMQCommandBusSuite{})
+var _ = Suite(&RabbitMQCommandBusWorkersSuite{})
 
 type RabbitMQCommandBusSuite struct {
 	uri string
@@ -69,3 +73,80 @@ func (s *RabbitMQCommandBusSuite) Test_NewHandlerCommandBus(c *C) {
 	c.Assert(err, Equals, nil)
 	c.Assert(bus, Not(Equals), nil)
 }
+
+func (s *RabbitMQCommandBusSuite) Test_NewHandlerCommandBus_InvalidWorkers(c *C) {
+	bus, err := NewRabbitMQCommandBusWithWorkers(s.uri, "test", "test", 0)
+	c.Assert(err, Equals, ErrInvalidWorkerCount)
+	c.Assert(bus, IsNil)
+}
+
+type RabbitMQCommandBusWorkersSuite struct {
+	uri string
+	CommandBusSuite
+	rbus *RabbitMQCommandBus
+}
+
+func (s *RabbitMQCommandBusWorkersSuite) SetUpSuite(c *C) {
+	s.uri = rabbitmqURI()
+}
+
+func (s *RabbitMQCommandBusWorkersSuite) SetUpTest(c *C) {
+	var err error
+	s.rbus, err = NewRabbitMQCommandBusWithWorkers(s.uri, "test", "workers", 4)
+	c.Assert(err, Equals, nil)
+	c.Assert(s.rbus, Not(Equals), nil)
+	err = s.rbus.RegisterCommandType(&TestCommand{}, func() Command { return &TestCommand{} })
+	c.Assert(err, Equals, nil)
+	s.Setup(s.rbus)
+}
+
+func (s *RabbitMQCommandBusWorkersSuite) TearDownTest(c *C) {
+	err := s.rbus.Close()
+	c.Assert(err, Equals, nil)
+}
+
+type orderingCommandHandler struct {
+	sync.Mutex
+	contents map[string][]string
+	recv     chan struct{}
+}
+
+func (h *orderingCommandHandler) HandleCommand(command Command) error {
+	h.Lock()
+	id := command.AggregateID()
+	h.contents[id] = append(h.contents[id], command.(*TestCommand).Content)
+	h.Unlock()
+	h.recv <- struct{}{}
+	return nil
+}
+
+func (s *RabbitMQCommandBusWorkersSuite) Test_PublishCommand_AggregateOrder(c *C) {
+	const aggregates, commands = 8, 25
+	handler := &orderingCommandHandler{
+		contents: make(map[string][]string),
+		recv:     make(chan struct{}, aggregates*commands),
+	}
+	err := s.bus.SetHandler(handler, &TestCommand{})
+	c.Assert(err, IsNil)
+
+	ids := make([]string, aggregates)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	for i := 0; i < commands; i++ {
+		for _, id := range ids {
+			err = s.bus.PublishCommand(&TestCommand{id, strconv.Itoa(i)})
+			c.Assert(err, IsNil)
+		}
+	}
+	for i := 0; i < aggregates*commands; i++ {
+		<-handler.recv
+	}
+
+	for _, id := range ids {
+		c.Assert(handler.contents[id], HasLen, commands)
+		for i, content := range handler.contents[id] {
+			c.Assert(content, Equals, strconv.Itoa(i))
+		}
+	}
+}
@@ -15,6 +15,9 @@
 package eventhorizon
 
 import (
+	"sync"
+
+	"github.com/odeke-em/go-uuid"
 	. "gopkg.in/check.v1"
 )
 
@@ -33,3 +36,45 @@ func (s *InternalCommandBusSuite) Test_NewHandlerCommandBus(c *C) {
 	bus := NewInternalCommandBus()
 	c.Assert(bus, Not(Equals), nil)
 }
+
+func (s *InternalCommandBusSuite) Test_RemoveHandler(c *C) {
+	bus := NewInternalCommandBus()
+	handler := &TestCommandHandler{}
+	err := bus.SetHandler(handler, &TestCommand{})
+	c.Assert(err, IsNil)
+	err = bus.RemoveHandler(&TestCommand{})
+	c.Assert(err, IsNil)
+	err = bus.RemoveHandler(&TestCommand{})
+	c.Assert(err, Equals, ErrHandlerNotFound)
+
+	command1 := &TestCommand{uuid.New(), "command1"}
+	err = bus.HandleCommand(command1)
+	c.Assert(err, Equals, ErrHandlerNotFound)
+
+	// A new handler can be set after removing the old one.
+	err = bus.SetHandler(handler, &TestCommand{})
+	c.Assert(err, IsNil)
+}
+
+func (s *InternalCommandBusSuite) Test_Concurrent(c *C) {
+	// Run with the race detector to find unsafe access.
+	bus := NewInternalCommandBus()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bus.SetHandler(nopCommandHandler{}, &TestCommand{})
+			bus.HandleCommand(&TestCommand{uuid.New(), "command"})
+			bus.RemoveHandler(&TestCommand{})
+		}()
+	}
+	wg.Wait()
+}
+
+// nopCommandHandler is a handler that can be used concurrently.
+type nopCommandHandler struct{}
+
+func (nopCommandHandler) HandleCommand(command Command) error {
+	return nil
+}
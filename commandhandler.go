@@ -16,9 +16,7 @@ package eventhorizon
 
 import (
 	"errors"
-	"fmt"
 	"reflect"
-	"time"
 )
 
 // Error returned when a dispatcher is created with a nil repository.
@@ -27,16 +25,31 @@ var ErrNilRepository = errors.New("repository is nil")
 // Error returned when an aggregate is already registered for a command.
 var ErrAggregateAlreadySet = errors.New("aggregate is already set")
 
-// Error returned when no aggregate can be found.
+// Error returned when no aggregate is set for a command.
 var ErrAggregateNotFound = errors.New("no aggregate for command")
 
-// CommandFieldError is returned by Dispatch when a field is incorrect.
+// CommandFieldError is a missing or invalid field of a command, see
+// CommandValidationError. Fields of nested structs are named by their path,
+// like "Address.City" or "Guests[1].Name".
 type CommandFieldError struct {
 	Field string
+
+	// Reason is why the field is invalid, it is empty for missing fields.
+	Reason string
 }
 
 func (c CommandFieldError) Error() string {
-	return "missing field: " + c.Field
+	if c.Reason == "" {
+		return "missing field: " + c.Field
+	}
+	return "invalid field " + c.Field + ": " + c.Reason
+}
+
+// ExistenceCommand is implemented by commands that create an aggregate or
+// target an existing one. It overrides the existence set by
+// SetAggregateRequiring.
+type ExistenceCommand interface {
+	AggregateExistence() AggregateExistence
 }
 
 // AggregateCommandHandler dispatches commands to registered aggregates.
@@ -44,13 +57,19 @@ func (c CommandFieldError) Error() string {
 // The dispatch process is as follows:
 // 1. The handler receives a command
 // 2. An aggregate is created or rebuilt from previous events by the repository
-// 3. The aggregate's command handler is called
-// 4. The aggregate stores events in response to the command
-// 5. The new events are stored in the event store by the repository
-// 6. The events are published to the event bus when stored by the event store
+// 3. The existence of the aggregate is checked, see AggregateExistence
+// 4. The aggregate's command handler is called
+// 5. The aggregate stores events in response to the command
+// 6. The new events are stored in the event store by the repository
+// 7. The events are published to the event bus when stored by the event store
 type AggregateCommandHandler struct {
 	repository Repository
 	aggregates map[string]string
+	existence  map[string]AggregateExistence
+	plans      map[reflect.Type]*commandPlan
+
+	logging
+	instrumentation
 }
 
 // NewAggregateCommandHandler creates a new AggregateCommandHandler.
@@ -62,29 +81,73 @@ func NewAggregateCommandHandler(repository Repository) (*AggregateCommandHandler
 	h := &AggregateCommandHandler{
 		repository: repository,
 		aggregates: make(map[string]string),
+		existence:  make(map[string]AggregateExistence),
+		plans:      make(map[reflect.Type]*commandPlan),
 	}
 	return h, nil
 }
 
-// SetAggregate sets an aggregate as handler for a command.
+// SetAggregate sets an aggregate as handler for a command. It computes how
+// the fields of the command type are validated, returns a CommandTagError if a
+// field has an invalid eh tag.
 func (h *AggregateCommandHandler) SetAggregate(aggregate Aggregate, command Command) error {
+	return h.SetAggregateRequiring(aggregate, command, AggregateMayExist)
+}
+
+// SetAggregateRequiring sets an aggregate as handler for a command, like
+// SetAggregate, which must create the aggregate or target an existing one as
+// required by existence. Returns a CommandRouteError if the aggregate is
+// registered with RegisterRoutes but has no route for the command.
+//
+// An example would be:
+//     handler.SetAggregateRequiring(&InvitationAggregate{}, &CreateInvite{},
+//         eventhorizon.AggregateMustNotExist)
+func (h *AggregateCommandHandler) SetAggregateRequiring(aggregate Aggregate, command Command, existence AggregateExistence) error {
 	// Check for already existing handler.
 	if _, ok := h.aggregates[command.CommandType()]; ok {
 		return ErrAggregateAlreadySet
 	}
 
+	if err := checkCommandRoute(aggregate, command); err != nil {
+		return err
+	}
+
+	plan, err := newCommandPlan(reflect.TypeOf(command))
+	if err != nil {
+		return err
+	}
+	h.plans[reflect.TypeOf(command)] = plan
+
 	// Add aggregate type to command type.
 	h.aggregates[command.CommandType()] = aggregate.AggregateType()
+	h.existence[command.CommandType()] = existence
 
 	return nil
 }
 
 // HandleCommand handles a command with the registered aggregate.
-// Returns ErrAggregateNotFound if no aggregate could be found.
+// Returns ErrAggregateNotFound if no aggregate is set for the command,
+// ErrAggregateDoesNotExist if the aggregate must exist but does not,
+// ErrAggregateExists if it exists but must not, and a
+// CommandValidationError if the command has missing or invalid fields.
 func (h *AggregateCommandHandler) HandleCommand(command Command) error {
-	fmt.Println("got command", command)
-	err := h.checkCommand(command)
+	return h.handleCommandTraced(SpanContext{}, command)
+}
+
+// traced returns the handler, see isTraced.
+func (h *AggregateCommandHandler) traced() interface{} { return h }
+
+// handleCommandTraced handles a command as a child of parent.
+func (h *AggregateCommandHandler) handleCommandTraced(parent SpanContext, command Command) (err error) {
+	context, done := h.observeCommand("aggregate_command_handler", parent, command)
+	defer done(&err)
+
+	logger := h.logger().With(commandFields(command))
+	logger.Debugf("Handling command")
+
+	err = h.checkCommand(command)
 	if err != nil {
+		logger.WithError(err).Debugf("Invalid command")
 		return err
 	}
 
@@ -95,7 +158,16 @@ func (h *AggregateCommandHandler) HandleCommand(command Command) error {
 	}
 
 	var aggregate Aggregate
-	if aggregate, err = h.repository.Load(aggregateType, command.AggregateID()); err != nil {
+	if aggregate, err = loadAggregate(h.repository, context, aggregateType, command.AggregateID()); err != nil {
+		return err
+	}
+
+	existence := h.existence[command.CommandType()]
+	if c, ok := command.(ExistenceCommand); ok {
+		existence = c.AggregateExistence()
+	}
+	if err = existence.Check(aggregate); err != nil {
+		logger.WithError(err).Debugf("Aggregate existence not met")
 		return err
 	}
 
@@ -103,58 +175,20 @@ func (h *AggregateCommandHandler) HandleCommand(command Command) error {
 		return err
 	}
 
-	if err = h.repository.Save(aggregate); err != nil {
+	if err = saveAggregate(h.repository, context, aggregate); err != nil {
+		logger.WithError(err).Errorf("Unable to save aggregate")
 		return err
 	}
 
 	return nil
 }
 
+// checkCommand validates the fields of a command with their eh tags, see
+// CommandValidationError, and the command itself if it is a Validator. The
+// plan computed by SetAggregate is used if the command has the same type.
 func (h *AggregateCommandHandler) checkCommand(command Command) error {
-	rv := reflect.Indirect(reflect.ValueOf(command))
-	rt := rv.Type()
-
-	for i := 0; i < rt.NumField(); i++ {
-		field := rt.Field(i)
-		if field.PkgPath != "" {
-			continue // Skip private field.
-		}
-
-		tag := field.Tag.Get("eh")
-		if tag == "optional" {
-			continue // Optional field.
-		}
-
-		if isZero(rv.Field(i)) {
-			return CommandFieldError{field.Name}
-		}
+	if plan, ok := h.plans[reflect.TypeOf(command)]; ok {
+		return plan.validate(command)
 	}
-	return nil
-}
-
-func isZero(v reflect.Value) bool {
-	switch v.Kind() {
-	case reflect.Func, reflect.Map, reflect.Slice:
-		return v.IsNil()
-	case reflect.Struct:
-		// Special case to get zero values by method.
-		switch obj := v.Interface().(type) {
-		case time.Time:
-			return obj.IsZero()
-		}
-
-		// Check public fields for zero values.
-		z := true
-		for i := 0; i < v.NumField(); i++ {
-			if v.Type().Field(i).PkgPath != "" {
-				continue // Skip private fields.
-			}
-			z = z && isZero(v.Field(i))
-		}
-		return z
-	}
-
-	// Compare other types directly:
-	z := reflect.Zero(v.Type())
-	return v.Interface() == z.Interface()
+	return validateCommand(command)
 }
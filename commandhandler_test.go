@@ -117,6 +117,90 @@ func (s *AggregateCommandHandlerSuite) Test_SetHandler_Twice(c *C) {
 	c.Assert(err, Equals, ErrAggregateAlreadySet)
 }
 
+func (s *AggregateCommandHandlerSuite) Test_SetAggregate_InvalidTag(c *C) {
+	aggregate := &TestDispatcherAggregate{}
+	err := s.handler.SetAggregate(aggregate, &TestCommandInvalidTag{})
+	c.Assert(err, Equals, CommandTagError{"Count", "min=1"})
+
+	// The command can be set again when the tag has been fixed.
+	err = s.handler.SetAggregate(aggregate, &TestCommand{})
+	c.Assert(err, IsNil)
+}
+
+func (s *AggregateCommandHandlerSuite) Test_HandleCommand_Invalid(c *C) {
+	aggregate := &TestDispatcherAggregate{
+		AggregateBase: NewAggregateBase(uuid.New()),
+	}
+	s.repo.aggregates[aggregate.AggregateID()] = aggregate
+	err := s.handler.SetAggregate(aggregate, &TestCommandValidation{})
+	c.Assert(err, IsNil)
+	command := validTestCommand()
+	command.Code = "se"
+	err = s.handler.HandleCommand(command)
+	c.Assert(err, DeepEquals, CommandValidationError{[]error{
+		CommandFieldError{"Code", "must match ^[A-Z]{2,3}$"},
+	}})
+}
+
+func (s *AggregateCommandHandlerSuite) Test_SetAggregateRequiring(c *C) {
+	aggregate := &TestDispatcherAggregate{
+		AggregateBase: NewAggregateBase(uuid.New()),
+	}
+	s.repo.aggregates[aggregate.AggregateID()] = aggregate
+	err := s.handler.SetAggregateRequiring(aggregate, &TestCommand{}, AggregateMustExist)
+	c.Assert(err, IsNil)
+	err = s.handler.SetAggregateRequiring(aggregate, &TestCommandOther{}, AggregateMustNotExist)
+	c.Assert(err, IsNil)
+
+	dispatchedCommand = nil
+	err = s.handler.HandleCommand(&TestCommand{aggregate.AggregateID(), "command1"})
+	c.Assert(err, Equals, ErrAggregateDoesNotExist)
+	c.Assert(dispatchedCommand, IsNil)
+	command := &TestCommandOther{aggregate.AggregateID(), "command2"}
+	err = s.handler.HandleCommand(command)
+	c.Assert(err, ErrorMatches, "couldn't handle command")
+	c.Assert(dispatchedCommand, Equals, command)
+
+	aggregate.IncrementVersion()
+	dispatchedCommand = nil
+	err = s.handler.HandleCommand(&TestCommandOther{aggregate.AggregateID(), "command2"})
+	c.Assert(err, Equals, ErrAggregateExists)
+	c.Assert(dispatchedCommand, IsNil)
+	err = s.handler.HandleCommand(&TestCommand{aggregate.AggregateID(), "command1"})
+	c.Assert(err, IsNil)
+}
+
+type TestExistenceCommand struct {
+	TestID    string
+	Existence AggregateExistence `eh:"optional"`
+}
+
+func (t *TestExistenceCommand) AggregateID() string   { return t.TestID }
+func (t *TestExistenceCommand) AggregateType() string { return "Test" }
+func (t *TestExistenceCommand) CommandType() string   { return "TestExistenceCommand" }
+
+func (t *TestExistenceCommand) AggregateExistence() AggregateExistence {
+	return t.Existence
+}
+
+func (s *AggregateCommandHandlerSuite) Test_ExistenceCommand(c *C) {
+	aggregate := &TestDispatcherAggregate{
+		AggregateBase: NewAggregateBase(uuid.New()),
+	}
+	s.repo.aggregates[aggregate.AggregateID()] = aggregate
+	err := s.handler.SetAggregateRequiring(aggregate, &TestExistenceCommand{}, AggregateMustNotExist)
+	c.Assert(err, IsNil)
+
+	// The command overrides the existence it was set with.
+	err = s.handler.HandleCommand(&TestExistenceCommand{aggregate.AggregateID(), AggregateMustExist})
+	c.Assert(err, Equals, ErrAggregateDoesNotExist)
+	aggregate.IncrementVersion()
+	err = s.handler.HandleCommand(&TestExistenceCommand{aggregate.AggregateID(), AggregateMustNotExist})
+	c.Assert(err, Equals, ErrAggregateExists)
+	err = s.handler.HandleCommand(&TestExistenceCommand{aggregate.AggregateID(), AggregateMayExist})
+	c.Assert(err, ErrorMatches, "couldn't handle command")
+}
+
 var callCountDispatcher int
 
 type BenchmarkDispatcherAggregate struct {
@@ -154,6 +238,15 @@ func (s *AggregateCommandHandlerSuite) Benchmark_Dispatcher(c *C) {
 	c.Assert(callCountDispatcher, Equals, c.N)
 }
 
+func (s *AggregateCommandHandlerSuite) Benchmark_CheckCommand(c *C) {
+	s.handler.SetAggregate(&TestDispatcherAggregate{}, &TestCommandValidation{})
+	command := validTestCommand()
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		s.handler.checkCommand(command)
+	}
+}
+
 func (s *AggregateCommandHandlerSuite) Test_CheckCommand_AllFields(c *C) {
 	err := s.handler.checkCommand(&TestCommand{uuid.New(), "command1"})
 	c.Assert(err, Equals, nil)
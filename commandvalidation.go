@@ -0,0 +1,493 @@
+package eventhorizon
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Validator is implemented by commands, or structs in commands, with rules
+// that can not be expressed with tags. Validate is called after the fields
+// have been checked. It can return a CommandFieldError or a
+// CommandValidationError to report invalid fields.
+type Validator interface {
+	Validate() error
+}
+
+// CommandValidationError is returned by HandleCommand when a command has one
+// or more invalid fields. It lists an error for every invalid field.
+type CommandValidationError struct {
+	Errors []error
+}
+
+func (c CommandValidationError) Error() string {
+	messages := make([]string, len(c.Errors))
+	for i, err := range c.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// CommandTagError is returned by HandleCommand when a field of a command has
+// an invalid eh tag.
+type CommandTagError struct {
+	Field string
+	Tag   string
+}
+
+func (c CommandTagError) Error() string {
+	return "invalid tag on field " + c.Field + ": " + c.Tag
+}
+
+// fieldCheck checks a value, which is not zero, and returns the reason why it
+// is invalid or an empty string.
+type fieldCheck func(reflect.Value) string
+
+var uuidRegexp = regexp.MustCompile(
+	"^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+// parseFieldTag parses the eh tag of a field with type t. The tag is a comma
+// separated list of rules:
+//     optional      the field can be left out (zero)
+//     min=N, max=N  bounds of a number
+//     minlen=N      minimum length of a string, slice, array or map
+//     maxlen=N      maximum length of a string, slice, array or map
+//     uuid          a string formatted as a UUID
+//     enum=a|b|c    one of the listed values, of a string or integer
+//     regexp=RE     a string matching RE, which must be the last rule
+// The rules are only checked for fields that are not zero. Fields of
+// nested structs, and of structs in slices, are checked with their own tags,
+// but are optional if they have no tag.
+func parseFieldTag(tag string, t reflect.Type) (bool, []fieldCheck, bool) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	optional := false
+	var checks []fieldCheck
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regexp=") {
+			rule, tag = tag, ""
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			rule, tag = tag[:i], tag[i+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+
+		var check fieldCheck
+		switch {
+		case name == "optional" && arg == "":
+			optional = true
+			continue
+		case (name == "min" || name == "max") && isNumberKind(t.Kind()):
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return false, nil, false
+			}
+			check = numberCheck(name == "min", n)
+		case (name == "minlen" || name == "maxlen") && hasLength(t.Kind()):
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				return false, nil, false
+			}
+			check = lengthCheck(name == "minlen", n)
+		case name == "uuid" && arg == "" && t.Kind() == reflect.String:
+			check = func(v reflect.Value) string {
+				if !uuidRegexp.MatchString(v.String()) {
+					return "must be a UUID"
+				}
+				return ""
+			}
+		case name == "enum" && arg != "" && (t.Kind() == reflect.String || isIntegerKind(t.Kind())):
+			check = enumCheck(strings.Split(arg, "|"))
+		case name == "regexp" && t.Kind() == reflect.String:
+			re, err := regexp.Compile(arg)
+			if err != nil {
+				return false, nil, false
+			}
+			check = func(v reflect.Value) string {
+				if !re.MatchString(v.String()) {
+					return "must match " + re.String()
+				}
+				return ""
+			}
+		default:
+			return false, nil, false
+		}
+		checks = append(checks, check)
+	}
+	return optional, checks, true
+}
+
+func numberCheck(min bool, n float64) fieldCheck {
+	return func(v reflect.Value) string {
+		switch x := numberValue(v); {
+		case min && x < n:
+			return "must be at least " + strconv.FormatFloat(n, 'g', -1, 64)
+		case !min && x > n:
+			return "must be at most " + strconv.FormatFloat(n, 'g', -1, 64)
+		}
+		return ""
+	}
+}
+
+func lengthCheck(min bool, n int) fieldCheck {
+	return func(v reflect.Value) string {
+		l := v.Len()
+		if v.Kind() == reflect.String {
+			l = utf8.RuneCountInString(v.String())
+		}
+		switch {
+		case min && l < n:
+			return "must have a length of at least " + strconv.Itoa(n)
+		case !min && l > n:
+			return "must have a length of at most " + strconv.Itoa(n)
+		}
+		return ""
+	}
+}
+
+func enumCheck(values []string) fieldCheck {
+	return func(v reflect.Value) string {
+		s := fmt.Sprint(v.Interface())
+		for _, value := range values {
+			if s == value {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(values, ", ")
+	}
+}
+
+func isIntegerKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return isIntegerKind(k) || k == reflect.Float32 || k == reflect.Float64
+}
+
+func hasLength(k reflect.Kind) bool {
+	return k == reflect.String || k == reflect.Slice || k == reflect.Array || k == reflect.Map
+}
+
+// numberValue returns the value of any integer or float as a float64.
+func numberValue(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+// validateCommand checks all fields of a command, and the command itself if
+// it is a Validator. It computes the plan of the command type for every call,
+// use the plan of AggregateCommandHandler to check many commands.
+func validateCommand(command Command) error {
+	plan, err := newCommandPlan(reflect.TypeOf(command))
+	if err != nil {
+		return err
+	}
+	return plan.validate(command)
+}
+
+// commandPlan is the validation of a command type, computed once from the
+// types and tags of its fields.
+type commandPlan struct {
+	structPlan *structPlan
+}
+
+// structPlan is the validation of a struct type.
+type structPlan struct {
+	typ    reflect.Type
+	fields []fieldPlan
+
+	// validator is set if the struct, or a pointer to it, is a Validator.
+	validator    bool
+	ptrValidator bool
+}
+
+// fieldPlan is the validation of an exported field.
+type fieldPlan struct {
+	index    int
+	name     string
+	optional bool
+	checks   []fieldCheck
+	zero     func(reflect.Value) bool
+	ptr      bool
+
+	// nested is set for structs, and elem for slices and arrays of structs,
+	// to check their fields.
+	nested    *structPlan
+	elem      *structPlan
+	elemIsPtr bool
+}
+
+var validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+
+// newCommandPlan computes the plan of a command type, which must be a struct
+// or a pointer to a struct. Returns a CommandTagError for invalid tags.
+func newCommandPlan(t reflect.Type) (*commandPlan, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	p, err := newStructPlan(t, "", make(map[reflect.Type]*structPlan))
+	if err != nil {
+		return nil, err
+	}
+	return &commandPlan{p}, nil
+}
+
+// newStructPlan computes the plan of a struct type. Plans are shared by
+// types, which also handles recursive types.
+func newStructPlan(t reflect.Type, path string, plans map[reflect.Type]*structPlan) (*structPlan, error) {
+	if p, ok := plans[t]; ok {
+		return p, nil
+	}
+	p := &structPlan{
+		typ:          t,
+		validator:    t.Implements(validatorType),
+		ptrValidator: reflect.PtrTo(t).Implements(validatorType),
+	}
+	plans[t] = p
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue // Skip private field.
+		}
+
+		name := joinFieldPath(path, field.Name)
+		tag := field.Tag.Get("eh")
+		optional, checks, ok := parseFieldTag(tag, field.Type)
+		if !ok {
+			return nil, CommandTagError{name, tag}
+		}
+		// Only the fields of the command itself are required by default.
+		if path != "" && tag == "" {
+			optional = true
+		}
+
+		f := fieldPlan{
+			index:    i,
+			name:     field.Name,
+			optional: optional,
+			checks:   checks,
+			zero:     zeroFunc(field.Type),
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			f.ptr = true
+			ft = ft.Elem()
+		}
+		var err error
+		switch ft.Kind() {
+		case reflect.Struct:
+			if isNestedStruct(ft) {
+				f.nested, err = newStructPlan(ft, name, plans)
+			}
+		case reflect.Slice, reflect.Array:
+			et := ft.Elem()
+			if et.Kind() == reflect.Ptr {
+				f.elemIsPtr = true
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct && isNestedStruct(et) {
+				f.elem, err = newStructPlan(et, name+"[]", plans)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.fields = append(p.fields, f)
+	}
+	return p, nil
+}
+
+// validate checks a command with the plan.
+func (p *commandPlan) validate(command Command) error {
+	var errs []error
+	p.structPlan.validate(reflect.Indirect(reflect.ValueOf(command)), "", &errs)
+	if len(errs) > 0 {
+		return CommandValidationError{errs}
+	}
+	return nil
+}
+
+// validate checks the fields of a struct and adds the errors of invalid
+// fields to errs. Fields are named by their path from the command.
+func (p *structPlan) validate(v reflect.Value, path string, errs *[]error) {
+	for i := range p.fields {
+		p.fields[i].validate(v.Field(p.fields[i].index), path, errs)
+	}
+
+	// Let the struct check itself, with a pointer receiver if possible.
+	var validator Validator
+	switch {
+	case p.ptrValidator && v.CanAddr():
+		validator = v.Addr().Interface().(Validator)
+	case p.validator:
+		validator = v.Interface().(Validator)
+	case p.ptrValidator:
+		c := reflect.New(p.typ)
+		c.Elem().Set(v)
+		validator = c.Interface().(Validator)
+	}
+	if validator != nil {
+		if err := validator.Validate(); err != nil {
+			addValidatorError(path, err, errs)
+		}
+	}
+}
+
+// validate checks a field and the structs in it. Nil elements of a slice or
+// array of struct pointers are missing, unless the field is optional.
+func (f *fieldPlan) validate(v reflect.Value, path string, errs *[]error) {
+	if f.zero(v) {
+		if !f.optional {
+			*errs = append(*errs, CommandFieldError{Field: joinFieldPath(path, f.name)})
+		}
+		return
+	}
+
+	if f.ptr {
+		v = v.Elem()
+	}
+	for _, check := range f.checks {
+		if reason := check(v); reason != "" {
+			*errs = append(*errs, CommandFieldError{joinFieldPath(path, f.name), reason})
+			break
+		}
+	}
+
+	if f.nested != nil {
+		f.nested.validate(v, joinFieldPath(path, f.name), errs)
+	}
+	if f.elem != nil {
+		name := joinFieldPath(path, f.name)
+		for i := 0; i < v.Len(); i++ {
+			elem := v.Index(i)
+			elemName := fmt.Sprintf("%s[%d]", name, i)
+			if f.elemIsPtr {
+				if elem.IsNil() {
+					if !f.optional {
+						*errs = append(*errs, CommandFieldError{Field: elemName})
+					}
+					continue
+				}
+				elem = elem.Elem()
+			}
+			f.elem.validate(elem, elemName, errs)
+		}
+	}
+}
+
+// zeroFunc returns a function that checks if a value of a type is zero. The
+// zero value of time.Time is checked by its IsZero method, structs are zero
+// if their exported fields are.
+func zeroFunc(t reflect.Type) func(reflect.Value) bool {
+	switch t.Kind() {
+	case reflect.Bool:
+		return func(v reflect.Value) bool { return !v.Bool() }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value) bool { return v.Int() == 0 }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(v reflect.Value) bool { return v.Uint() == 0 }
+	case reflect.Float32, reflect.Float64:
+		return func(v reflect.Value) bool { return v.Float() == 0 }
+	case reflect.Complex64, reflect.Complex128:
+		return func(v reflect.Value) bool { return v.Complex() == 0 }
+	case reflect.String:
+		return func(v reflect.Value) bool { return v.Len() == 0 }
+	case reflect.Func, reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface, reflect.Chan:
+		return func(v reflect.Value) bool { return v.IsNil() }
+	case reflect.UnsafePointer:
+		return func(v reflect.Value) bool { return v.Pointer() == 0 }
+	case reflect.Array:
+		elem := zeroFunc(t.Elem())
+		return func(v reflect.Value) bool {
+			for i := 0; i < v.Len(); i++ {
+				if !elem(v.Index(i)) {
+					return false
+				}
+			}
+			return true
+		}
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return func(v reflect.Value) bool { return v.Interface().(time.Time).IsZero() }
+		}
+		var indexes []int
+		var fields []func(reflect.Value) bool
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).PkgPath != "" {
+				continue // Skip private fields.
+			}
+			indexes = append(indexes, i)
+			fields = append(fields, zeroFunc(t.Field(i).Type))
+		}
+		return func(v reflect.Value) bool {
+			for i, zero := range fields {
+				if !zero(v.Field(indexes[i])) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return func(v reflect.Value) bool { return false }
+}
+
+// isNestedStruct checks if the fields of a struct type should be validated,
+// which they are not for values like time.Time.
+func isNestedStruct(t reflect.Type) bool {
+	return t != reflect.TypeOf(time.Time{})
+}
+
+// addValidatorError adds an error returned by the Validator of the struct at
+// path, with the fields named by their path from the command.
+func addValidatorError(path string, err error, errs *[]error) {
+	switch err := err.(type) {
+	case CommandValidationError:
+		for _, e := range err.Errors {
+			addValidatorError(path, e, errs)
+		}
+	case CommandFieldError:
+		err.Field = joinFieldPath(path, err.Field)
+		*errs = append(*errs, err)
+	default:
+		if path == "" {
+			*errs = append(*errs, err)
+		} else {
+			*errs = append(*errs, CommandFieldError{path, err.Error()})
+		}
+	}
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	if name == "" {
+		return path
+	}
+	return path + "." + name
+}
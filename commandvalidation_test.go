@@ -0,0 +1,209 @@
+package eventhorizon
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/odeke-em/go-uuid"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&CommandValidationSuite{})
+
+type CommandValidationSuite struct{}
+
+type TestValidationAddress struct {
+	Street string `eh:"minlen=2"`
+	City   string `eh:"optional,enum=Stockholm|Oslo"`
+}
+
+type TestValidationGuest struct {
+	Name string `eh:"maxlen=20"`
+	Age  int    `eh:"optional,min=18,max=120"`
+	Note string
+}
+
+func (g *TestValidationGuest) Validate() error {
+	if g.Name == "Mallory" {
+		return errors.New("is not welcome")
+	}
+	return nil
+}
+
+type TestCommandValidation struct {
+	TestID  string `eh:"uuid"`
+	Code    string `eh:"regexp=^[A-Z]{2,3}$"`
+	Count   uint   `eh:"optional,max=10"`
+	Rating  float64
+	Tags    []string `eh:"optional,maxlen=2"`
+	Address TestValidationAddress
+	Backup  *TestValidationAddress `eh:"optional"`
+	Guests  []TestValidationGuest  `eh:"optional"`
+	Level   int                    `eh:"optional,enum=1|2|3"`
+	Time    time.Time              `eh:"optional"`
+}
+
+func (t *TestCommandValidation) AggregateID() string   { return t.TestID }
+func (t *TestCommandValidation) AggregateType() string { return "Test" }
+func (t *TestCommandValidation) CommandType() string   { return "TestCommandValidation" }
+
+func (t *TestCommandValidation) Validate() error {
+	if len(t.Guests) > int(t.Count) {
+		return CommandFieldError{"Guests", "must not be more than Count"}
+	}
+	return nil
+}
+
+func validTestCommand() *TestCommandValidation {
+	return &TestCommandValidation{
+		TestID:  uuid.New(),
+		Code:    "SE",
+		Count:   2,
+		Rating:  0.5,
+		Address: TestValidationAddress{Street: "Main Street", City: "Oslo"},
+		Guests:  []TestValidationGuest{{Name: "Alice", Age: 30}},
+	}
+}
+
+func (s *CommandValidationSuite) TestValid(c *C) {
+	c.Assert(validateCommand(validTestCommand()), IsNil)
+}
+
+func (s *CommandValidationSuite) TestEveryInvalidField(c *C) {
+	command := validTestCommand()
+	command.TestID = "not a uuid"
+	command.Code = "se"
+	command.Count = 11
+	command.Rating = 0
+	command.Tags = []string{"a", "b", "c"}
+	command.Address.Street = "M"
+	command.Address.City = "Paris"
+	command.Backup = &TestValidationAddress{}
+	command.Guests = []TestValidationGuest{{Name: "Alice", Age: 12}, {Age: 30}, {Name: "Mallory"}}
+	command.Level = 4
+
+	err := validateCommand(command)
+	c.Assert(err, DeepEquals, CommandValidationError{[]error{
+		CommandFieldError{"TestID", "must be a UUID"},
+		CommandFieldError{"Code", "must match ^[A-Z]{2,3}$"},
+		CommandFieldError{"Count", "must be at most 10"},
+		CommandFieldError{"Rating", ""},
+		CommandFieldError{"Tags", "must have a length of at most 2"},
+		CommandFieldError{"Address.Street", "must have a length of at least 2"},
+		CommandFieldError{"Address.City", "must be one of Stockholm, Oslo"},
+		CommandFieldError{"Backup.Street", ""},
+		CommandFieldError{"Guests[0].Age", "must be at least 18"},
+		CommandFieldError{"Guests[1].Name", ""},
+		CommandFieldError{"Guests[2]", "is not welcome"},
+		CommandFieldError{"Level", "must be one of 1, 2, 3"},
+	}})
+	c.Assert(err, ErrorMatches, `invalid field TestID: must be a UUID; .*; missing field: Rating; .*`)
+}
+
+func (s *CommandValidationSuite) TestValidator(c *C) {
+	command := validTestCommand()
+	command.Count = 0
+	command.Rating = 0
+	err := validateCommand(command)
+	c.Assert(err, DeepEquals, CommandValidationError{[]error{
+		CommandFieldError{"Rating", ""},
+		CommandFieldError{"Guests", "must not be more than Count"},
+	}})
+}
+
+type TestCommandInvalidTag struct {
+	TestID string
+	Count  string `eh:"min=1"`
+}
+
+func (t *TestCommandInvalidTag) AggregateID() string   { return t.TestID }
+func (t *TestCommandInvalidTag) AggregateType() string { return "Test" }
+func (t *TestCommandInvalidTag) CommandType() string   { return "TestCommandInvalidTag" }
+
+func (s *CommandValidationSuite) TestInvalidTag(c *C) {
+	err := validateCommand(&TestCommandInvalidTag{uuid.New(), "1"})
+	c.Assert(err, Equals, CommandTagError{"Count", "min=1"})
+
+	for _, t := range []struct {
+		tag   string
+		value interface{}
+	}{
+		{"min=a", 0},
+		{"maxlen=-1", ""},
+		{"uuid=1", ""},
+		{"uuid", 0},
+		{"enum=", ""},
+		{"regexp=(", ""},
+		{"optional,required", ""},
+	} {
+		_, _, ok := parseFieldTag(t.tag, reflect.TypeOf(t.value))
+		c.Check(ok, Equals, false, Commentf(t.tag))
+	}
+}
+
+type TestValidationNode struct {
+	Name     string                `eh:"maxlen=3"`
+	Children []*TestValidationNode `eh:"optional"`
+}
+
+type TestCommandRecursive struct {
+	TestID string
+	Root   TestValidationNode
+}
+
+func (t *TestCommandRecursive) AggregateID() string   { return t.TestID }
+func (t *TestCommandRecursive) AggregateType() string { return "Test" }
+func (t *TestCommandRecursive) CommandType() string   { return "TestCommandRecursive" }
+
+func (s *CommandValidationSuite) TestRecursive(c *C) {
+	command := &TestCommandRecursive{uuid.New(), TestValidationNode{
+		Name: "a",
+		Children: []*TestValidationNode{
+			{Name: "b", Children: []*TestValidationNode{{Name: "long"}}},
+			nil,
+		},
+	}}
+	err := validateCommand(command)
+	c.Assert(err, DeepEquals, CommandValidationError{[]error{
+		CommandFieldError{"Root.Children[0].Children[0].Name", "must have a length of at most 3"},
+	}})
+}
+
+type TestCommandNilElements struct {
+	TestID string
+	Guests []*TestValidationGuest
+	Extra  []*TestValidationGuest `eh:"optional"`
+}
+
+func (t *TestCommandNilElements) AggregateID() string   { return t.TestID }
+func (t *TestCommandNilElements) AggregateType() string { return "Test" }
+func (t *TestCommandNilElements) CommandType() string   { return "TestCommandNilElements" }
+
+func (s *CommandValidationSuite) TestNilElements(c *C) {
+	command := &TestCommandNilElements{uuid.New(),
+		[]*TestValidationGuest{{Name: "Alice"}, nil},
+		[]*TestValidationGuest{nil, {Name: "Bob"}},
+	}
+	err := validateCommand(command)
+	c.Assert(err, DeepEquals, CommandValidationError{[]error{
+		CommandFieldError{"Guests[1]", ""},
+	}})
+}
+
+func (s *CommandValidationSuite) Benchmark_ValidateCommand_Uncached(c *C) {
+	command := validTestCommand()
+	for i := 0; i < c.N; i++ {
+		validateCommand(command)
+	}
+}
+
+func (s *CommandValidationSuite) Benchmark_ValidateCommand_Plan(c *C) {
+	command := validTestCommand()
+	plan, err := newCommandPlan(reflect.TypeOf(command))
+	c.Assert(err, IsNil)
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		plan.validate(command)
+	}
+}
@@ -0,0 +1,137 @@
+package ehtest
+
+import (
+	"reflect"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// AggregateFixture tests the events an aggregate stores when it handles a
+// command, given the events it already has.
+//
+// An example would be:
+//     f := ehtest.NewAggregateFixture(t, &InvitationAggregate{}, factory,
+//         &CreateInvite{}, &AcceptInvite{}, &DeclineInvite{})
+//     f.Given(&InviteCreated{id, eventID, "Alice", 0}).
+//         When(&AcceptInvite{id}).
+//         Then(&InviteAccepted{id})
+type AggregateFixture struct {
+	t         TestingT
+	aggregate eventhorizon.Aggregate
+	factory   func(string) eventhorizon.Aggregate
+	commands  []eventhorizon.Command
+
+	eventStore *eventhorizon.TraceEventStore
+	handler    *eventhorizon.AggregateCommandHandler
+	when       bool
+	err        error
+}
+
+// NewAggregateFixture creates an AggregateFixture for an aggregate, created by
+// factory, that handles the commands. Failed expectations are reported to t.
+func NewAggregateFixture(t TestingT, aggregate eventhorizon.Aggregate,
+	factory func(string) eventhorizon.Aggregate, commands ...eventhorizon.Command) *AggregateFixture {
+	f := &AggregateFixture{
+		t:         t,
+		aggregate: aggregate,
+		factory:   factory,
+		commands:  commands,
+	}
+	f.Given()
+	return f
+}
+
+// Given starts a new test with the events that have already happened.
+func (f *AggregateFixture) Given(events ...eventhorizon.Event) *AggregateFixture {
+	f.eventStore = eventhorizon.NewTraceEventStore(eventhorizon.NewMemoryEventStore(nil))
+	f.handler = nil
+	f.when = false
+	f.err = nil
+
+	repository, err := eventhorizon.NewCallbackRepository(f.eventStore)
+	if err != nil {
+		f.t.Errorf("could not create repository: %v", err)
+		return f
+	}
+	if err := repository.RegisterAggregate(f.aggregate, f.factory); err != nil {
+		f.t.Errorf("could not register aggregate: %v", err)
+		return f
+	}
+	if f.handler, err = eventhorizon.NewAggregateCommandHandler(repository); err != nil {
+		f.t.Errorf("could not create command handler: %v", err)
+		return f
+	}
+	for _, command := range f.commands {
+		if err := f.handler.SetAggregate(f.aggregate, command); err != nil {
+			f.t.Errorf("could not set aggregate for %s: %v", command.CommandType(), err)
+			return f
+		}
+	}
+
+	if len(events) > 0 {
+		if err := f.eventStore.Save(events); err != nil {
+			f.t.Errorf("could not save given events: %v", err)
+		}
+	}
+	return f
+}
+
+// When handles a command, tracing the events it stores.
+func (f *AggregateFixture) When(command eventhorizon.Command) *AggregateFixture {
+	if f.handler == nil {
+		return f
+	}
+	f.when = true
+	f.eventStore.ResetTrace()
+	f.eventStore.StartTracing()
+	f.err = f.handler.HandleCommand(command)
+	f.eventStore.StopTracing()
+	return f
+}
+
+// Then expects the command to succeed and store the events, in order.
+func (f *AggregateFixture) Then(events ...eventhorizon.Event) {
+	if !f.when {
+		f.t.Errorf("no command was handled")
+		return
+	}
+	if f.err != nil {
+		f.t.Errorf("unexpected error: %v", f.err)
+		return
+	}
+
+	actual := f.eventStore.GetTrace()
+	if !reflect.DeepEqual(toInterfaces(events), toInterfaces(actual)) {
+		f.t.Errorf("events do not match (- expected, + actual):\n%s",
+			diff(toInterfaces(events), toInterfaces(actual)))
+	}
+}
+
+// ThenError expects the command to fail with an error, which is equal to err
+// or has the same message, and to not store any events. A nil err expects the
+// command to not fail.
+func (f *AggregateFixture) ThenError(err error) {
+	if !f.when {
+		f.t.Errorf("no command was handled")
+		return
+	}
+	if err == nil {
+		if f.err != nil {
+			f.t.Errorf("unexpected error: %v", f.err)
+		}
+	} else if f.err == nil || (f.err != err && f.err.Error() != err.Error()) {
+		f.t.Errorf("errors do not match:\n- %v\n+ %v", err, f.err)
+	}
+
+	if actual := f.eventStore.GetTrace(); len(actual) > 0 {
+		f.t.Errorf("unexpected events:\n%s", diff(nil, toInterfaces(actual)))
+	}
+}
+
+func toInterfaces(events []eventhorizon.Event) []interface{} {
+	values := make([]interface{}, len(events))
+	for i, e := range events {
+		values[i] = e
+	}
+	return values
+}
@@ -0,0 +1,117 @@
+package ehtest_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/ehtest"
+	"github.com/looplab/eventhorizon/examples/common"
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&AggregateFixtureSuite{})
+
+type AggregateFixtureSuite struct {
+	t *mockT
+	f *ehtest.AggregateFixture
+}
+
+// mockT records the failures of a fixture.
+type mockT struct {
+	errors []string
+}
+
+func (t *mockT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (s *AggregateFixtureSuite) SetUpTest(c *C) {
+	s.t = &mockT{}
+	s.f = ehtest.NewAggregateFixture(s.t, &common.InvitationAggregate{},
+		func(id string) eventhorizon.Aggregate {
+			return &common.InvitationAggregate{AggregateBase: eventhorizon.NewAggregateBase(id)}
+		},
+		&common.CreateInvite{}, &common.AcceptInvite{}, &common.DeclineInvite{})
+}
+
+func (s *AggregateFixtureSuite) TestThen(c *C) {
+	s.f.Given(&common.InviteCreated{"1", "2", "Alice", 0}).
+		When(&common.AcceptInvite{"1"}).
+		Then(&common.InviteAccepted{"1"})
+	c.Assert(s.t.errors, HasLen, 0)
+
+	s.f.Given(&common.InviteCreated{"1", "2", "Alice", 0}, &common.InviteAccepted{"1"}).
+		When(&common.AcceptInvite{"1"}).
+		Then()
+	c.Assert(s.t.errors, HasLen, 0)
+}
+
+func (s *AggregateFixtureSuite) TestThenDiff(c *C) {
+	s.f.Given(&common.InviteCreated{"1", "2", "Alice", 0}).
+		When(&common.AcceptInvite{"1"}).
+		Then(&common.InviteDeclined{"1"})
+	c.Assert(s.t.errors, HasLen, 1)
+	c.Assert(s.t.errors[0], Equals, strings.Join([]string{
+		"events do not match (- expected, + actual):",
+		`- &common.InviteDeclined{InvitationID:"1"}`,
+		`+ &common.InviteAccepted{InvitationID:"1"}`,
+		"",
+	}, "\n"))
+}
+
+func (s *AggregateFixtureSuite) TestThenUnexpectedError(c *C) {
+	s.f.Given().
+		When(&common.AcceptInvite{"1"}).
+		Then(&common.InviteAccepted{"1"})
+	c.Assert(s.t.errors, DeepEquals, []string{"unexpected error: aggregate does not exist"})
+}
+
+func (s *AggregateFixtureSuite) TestThenError(c *C) {
+	s.f.Given(&common.InviteCreated{"1", "2", "Alice", 0}, &common.InviteDeclined{"1"}).
+		When(&common.AcceptInvite{"1"}).
+		ThenError(errors.New("Alice already declined"))
+	c.Assert(s.t.errors, HasLen, 0)
+
+	s.f.Given(&common.InviteCreated{"1", "2", "Alice", 0}).
+		When(&common.AcceptInvite{"1"}).
+		ThenError(eventhorizon.ErrAggregateDoesNotExist)
+	c.Assert(s.t.errors, DeepEquals, []string{
+		"errors do not match:\n- aggregate does not exist\n+ <nil>",
+		"unexpected events:\n+ &common.InviteAccepted{InvitationID:\"1\"}\n",
+	})
+}
+
+func (s *AggregateFixtureSuite) TestThenErrorNil(c *C) {
+	s.f.Given(&common.InviteCreated{"1", "2", "Alice", 0}, &common.InviteDeclined{"1"}).
+		When(&common.AcceptInvite{"1"}).
+		ThenError(nil)
+	c.Assert(s.t.errors, DeepEquals, []string{"unexpected error: Alice already declined"})
+
+	s.t.errors = nil
+	s.f.Given(&common.InviteCreated{"1", "2", "Alice", 0}, &common.InviteAccepted{"1"}).
+		When(&common.AcceptInvite{"1"}).
+		ThenError(nil)
+	c.Assert(s.t.errors, HasLen, 0)
+}
+
+func (s *AggregateFixtureSuite) TestThenErrorExistence(c *C) {
+	s.f.Given().
+		When(&common.AcceptInvite{"1"}).
+		ThenError(eventhorizon.ErrAggregateDoesNotExist)
+	s.f.Given(&common.InviteCreated{"1", "2", "Alice", 0}).
+		When(&common.CreateInvite{"1", "2", "Bob", 0}).
+		ThenError(eventhorizon.ErrAggregateExists)
+	c.Assert(s.t.errors, HasLen, 0)
+}
+
+func (s *AggregateFixtureSuite) TestNoCommand(c *C) {
+	s.f.Given(&common.InviteCreated{"1", "2", "Alice", 0}).
+		Then(&common.InviteAccepted{"1"})
+	c.Assert(s.t.errors, DeepEquals, []string{"no command was handled"})
+}
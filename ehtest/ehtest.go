@@ -0,0 +1,69 @@
+// Package ehtest provides fixtures for testing aggregates and projectors in
+// isolation, with readable diffs of the expected and actual results.
+package ehtest
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// TestingT is the part of *testing.T and *check.C used by the fixtures.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// diff returns the lines of two lists, prefixed with - for expected values
+// that are missing, + for actual values that were not expected and a space
+// for values that are equal.
+func diff(expected, actual []interface{}) string {
+	var b bytes.Buffer
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		switch {
+		case i < len(expected) && i < len(actual) && reflect.DeepEqual(expected[i], actual[i]):
+			fmt.Fprintf(&b, "  %#v\n", expected[i])
+		default:
+			if i < len(expected) {
+				fmt.Fprintf(&b, "- %#v\n", expected[i])
+			}
+			if i < len(actual) {
+				fmt.Fprintf(&b, "+ %#v\n", actual[i])
+			}
+		}
+	}
+	return b.String()
+}
+
+// diffModels returns the lines of two sets of models, by id, in the format of
+// diff.
+func diffModels(expected, actual map[string]interface{}) string {
+	var ids []string
+	for id := range expected {
+		ids = append(ids, id)
+	}
+	for id := range actual {
+		if _, ok := expected[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var b bytes.Buffer
+	for _, id := range ids {
+		e, inExpected := expected[id]
+		a, inActual := actual[id]
+		switch {
+		case inExpected && inActual && reflect.DeepEqual(e, a):
+			fmt.Fprintf(&b, "  %s: %#v\n", id, e)
+		default:
+			if inExpected && e != nil {
+				fmt.Fprintf(&b, "- %s: %#v\n", id, e)
+			}
+			if inActual && a != nil {
+				fmt.Fprintf(&b, "+ %s: %#v\n", id, a)
+			}
+		}
+	}
+	return b.String()
+}
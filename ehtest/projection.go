@@ -0,0 +1,128 @@
+package ehtest
+
+import (
+	"reflect"
+
+	"github.com/looplab/eventhorizon"
+)
+
+// ProjectionFixture tests the read models that a projector creates from a
+// sequence of events. It also checks that replaying the events does not
+// change the models, as events may be delivered more than once.
+//
+// An example would be:
+//     f := ehtest.NewProjectionFixture(t,
+//         func(r eventhorizon.UpdateReadRepository) eventhorizon.EventHandler {
+//             return NewInvitationProjector(r)
+//         })
+//     f.When(&InviteCreated{id, eventID, "Alice", 0}, &InviteAccepted{id}).
+//         ThenModel(id, &Invitation{ID: id, Name: "Alice", Status: "accepted"})
+type ProjectionFixture struct {
+	t         TestingT
+	projector func(eventhorizon.UpdateReadRepository) eventhorizon.EventHandler
+	replay    bool
+
+	when   bool
+	models map[string]interface{}
+}
+
+// NewProjectionFixture creates a ProjectionFixture for a projector, created
+// for a MemoryReadRepository. Failed expectations are reported to t.
+func NewProjectionFixture(t TestingT,
+	projector func(eventhorizon.UpdateReadRepository) eventhorizon.EventHandler) *ProjectionFixture {
+	return &ProjectionFixture{
+		t:         t,
+		projector: projector,
+		replay:    true,
+	}
+}
+
+// WithoutReplay disables the replay check, for projectors that are known to
+// not be idempotent.
+func (f *ProjectionFixture) WithoutReplay() *ProjectionFixture {
+	f.replay = false
+	return f
+}
+
+// When starts a new test by handling the events, in order, with a new
+// projector and repository.
+func (f *ProjectionFixture) When(events ...eventhorizon.Event) *ProjectionFixture {
+	repository := &projectionRepository{
+		MemoryReadRepository: eventhorizon.NewMemoryReadRepository(),
+		ids:                  make(map[string]bool),
+	}
+	projector := f.projector(repository)
+	for _, event := range events {
+		projector.HandleEvent(event)
+	}
+	f.when = true
+	f.models = repository.models()
+
+	if f.replay {
+		for _, event := range events {
+			projector.HandleEvent(event)
+		}
+		if replayed := repository.models(); !reflect.DeepEqual(f.models, replayed) {
+			f.t.Errorf("replaying the events changed the models (- once, + replayed):\n%s",
+				diffModels(f.models, replayed))
+		}
+	}
+	return f
+}
+
+// ThenModel expects the model with id to be equal to model, or to not exist
+// if model is nil.
+func (f *ProjectionFixture) ThenModel(id string, model interface{}) {
+	if !f.when {
+		f.t.Errorf("no events were handled")
+		return
+	}
+	if !reflect.DeepEqual(model, f.models[id]) {
+		f.t.Errorf("models do not match (- expected, + actual):\n%s",
+			diffModels(map[string]interface{}{id: model}, map[string]interface{}{id: f.models[id]}))
+	}
+}
+
+// ThenModels expects the models, by id, to be all the models in the
+// repository.
+func (f *ProjectionFixture) ThenModels(models map[string]interface{}) {
+	if !f.when {
+		f.t.Errorf("no events were handled")
+		return
+	}
+	if !reflect.DeepEqual(models, f.models) {
+		f.t.Errorf("models do not match (- expected, + actual):\n%s",
+			diffModels(models, f.models))
+	}
+}
+
+// projectionRepository is a MemoryReadRepository that keeps track of the ids
+// of the saved models.
+type projectionRepository struct {
+	*eventhorizon.MemoryReadRepository
+	ids map[string]bool
+}
+
+// Save implements the Save method of the ReadRepository interface.
+func (r *projectionRepository) Save(id string, model interface{}) error {
+	r.ids[id] = true
+	return r.MemoryReadRepository.Save(id, model)
+}
+
+// SaveVersion implements the SaveVersion method of the
+// VersionedReadRepository interface.
+func (r *projectionRepository) SaveVersion(id string, model interface{}, version int) error {
+	r.ids[id] = true
+	return r.MemoryReadRepository.SaveVersion(id, model, version)
+}
+
+// models returns copies of all models in the repository, by id.
+func (r *projectionRepository) models() map[string]interface{} {
+	models := make(map[string]interface{})
+	for id := range r.ids {
+		if model, err := r.Find(id); err == nil {
+			models[id] = model
+		}
+	}
+	return models
+}
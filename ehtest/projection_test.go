@@ -0,0 +1,95 @@
+package ehtest_test
+
+import (
+	"strings"
+
+	"github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/ehtest"
+	"github.com/looplab/eventhorizon/examples/common"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ProjectionFixtureSuite{})
+
+type ProjectionFixtureSuite struct {
+	t *mockT
+}
+
+func (s *ProjectionFixtureSuite) SetUpTest(c *C) {
+	s.t = &mockT{}
+}
+
+func invitationProjector(r eventhorizon.UpdateReadRepository) eventhorizon.EventHandler {
+	return common.NewInvitationProjector(r)
+}
+
+func guestListProjector(r eventhorizon.UpdateReadRepository) eventhorizon.EventHandler {
+	return common.NewGuestListProjector(r, "event")
+}
+
+func (s *ProjectionFixtureSuite) TestThenModel(c *C) {
+	f := ehtest.NewProjectionFixture(s.t, invitationProjector)
+	f.When(&common.InviteCreated{"1", "event", "Alice", 0}, &common.InviteAccepted{"1"}).
+		ThenModel("1", &common.Invitation{ID: "1", Name: "Alice", Status: "accepted"})
+	c.Assert(s.t.errors, HasLen, 0)
+
+	f.ThenModel("2", nil)
+	c.Assert(s.t.errors, HasLen, 0)
+
+	f.ThenModel("1", &common.Invitation{ID: "1", Name: "Alice", Status: "declined"})
+	c.Assert(s.t.errors, HasLen, 1)
+	c.Assert(s.t.errors[0], Equals, strings.Join([]string{
+		"models do not match (- expected, + actual):",
+		`- 1: &common.Invitation{ID:"1", Name:"Alice", Status:"declined"}`,
+		`+ 1: &common.Invitation{ID:"1", Name:"Alice", Status:"accepted"}`,
+		"",
+	}, "\n"))
+}
+
+func (s *ProjectionFixtureSuite) TestThenModels(c *C) {
+	f := ehtest.NewProjectionFixture(s.t, invitationProjector)
+	f.When(
+		&common.InviteCreated{"1", "event", "Alice", 0},
+		&common.InviteCreated{"2", "event", "Bob", 0},
+		&common.InviteDeclined{"2"},
+	).ThenModels(map[string]interface{}{
+		"1": &common.Invitation{ID: "1", Name: "Alice"},
+		"2": &common.Invitation{ID: "2", Name: "Bob", Status: "declined"},
+	})
+	c.Assert(s.t.errors, HasLen, 0)
+
+	f.ThenModels(map[string]interface{}{
+		"1": &common.Invitation{ID: "1", Name: "Alice"},
+	})
+	c.Assert(s.t.errors, DeepEquals, []string{strings.Join([]string{
+		"models do not match (- expected, + actual):",
+		`  1: &common.Invitation{ID:"1", Name:"Alice", Status:""}`,
+		`+ 2: &common.Invitation{ID:"2", Name:"Bob", Status:"declined"}`,
+		"",
+	}, "\n")})
+}
+
+func (s *ProjectionFixtureSuite) TestReplay(c *C) {
+	// The guest list projector counts the accepted invites again on replay.
+	f := ehtest.NewProjectionFixture(s.t, guestListProjector)
+	f.When(&common.InviteCreated{"1", "event", "Alice", 0}, &common.InviteAccepted{"1"}).
+		ThenModel("event", &common.GuestList{ID: "event", NumAccepted: 1})
+	c.Assert(s.t.errors, DeepEquals, []string{strings.Join([]string{
+		"replaying the events changed the models (- once, + replayed):",
+		`- event: &common.GuestList{ID:"event", NumGuests:0, NumAccepted:1, NumDeclined:0}`,
+		`+ event: &common.GuestList{ID:"event", NumGuests:0, NumAccepted:2, NumDeclined:0}`,
+		"",
+	}, "\n")})
+
+	s.t.errors = nil
+	f.WithoutReplay().
+		When(&common.InviteCreated{"1", "event", "Alice", 0}, &common.InviteAccepted{"1"}).
+		ThenModel("event", &common.GuestList{ID: "event", NumAccepted: 1})
+	c.Assert(s.t.errors, HasLen, 0)
+}
+
+func (s *ProjectionFixtureSuite) TestNoEvents(c *C) {
+	f := ehtest.NewProjectionFixture(s.t, invitationProjector)
+	f.ThenModel("1", nil)
+	c.Assert(s.t.errors, DeepEquals, []string{"no events were handled"})
+}
@@ -14,6 +14,19 @@
 
 package eventhorizon
 
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrInvalidQueueSize returned when an async event bus is created with a
+// queue size less than one.
+var ErrInvalidQueueSize = errors.New("invalid queue size")
+
 // EventHandler is an interface that all handlers of events should implement.
 type EventHandler interface {
 	// HandleEvent handles an event.
@@ -41,57 +54,221 @@ type RemoteEventBus interface {
 }
 
 // InternalEventBus is an event bus that notifies registered EventHandlers of
-// published events.
+// published events. It is safe for concurrent use, handlers can be added and
+// removed while events are published.
+//
+// By default events are handled synchronously by PublishEvent. An async bus
+// handles them on a pool of workers instead, see NewAsyncInternalEventBus.
+//
+// Handlers are called in the order they were added, unless they have a
+// priority, see PriorityEventHandler.
 type InternalEventBus struct {
-	eventHandlers  map[string]map[EventHandler]bool
-	localHandlers  map[EventHandler]bool
-	globalHandlers map[EventHandler]bool
+	handlers *eventHandlers
+
+	workers     []*internalWorker
+	workersWait sync.WaitGroup
+	done        chan struct{}
+	closeOnce   sync.Once
+
+	instrumentation
 }
 
 // NewInternalEventBus creates a InternalEventBus.
 func NewInternalEventBus() *InternalEventBus {
 	b := &InternalEventBus{
-		eventHandlers:  make(map[string]map[EventHandler]bool),
-		localHandlers:  make(map[EventHandler]bool),
-		globalHandlers: make(map[EventHandler]bool),
+		handlers: newEventHandlers(),
 	}
 	return b
 }
 
+// NewAsyncInternalEventBus creates a InternalEventBus that handles events on
+// a number of workers. Each worker has a queue of queueSize events, when it
+// is full PublishEvent blocks until there is room. Handlers never block when
+// they publish to the full queue of their own worker, the events are queued
+// in order without a limit instead. Returns ErrInvalidWorkerCount or
+// ErrInvalidQueueSize if workers or queueSize is less than one.
+//
+// Events for the same aggregate are always handled by the same worker, which
+// keeps them in order. Close must be called to stop the workers.
+func NewAsyncInternalEventBus(workers, queueSize int) (*InternalEventBus, error) {
+	if workers < 1 {
+		return nil, ErrInvalidWorkerCount
+	}
+	if queueSize < 1 {
+		return nil, ErrInvalidQueueSize
+	}
+
+	b := NewInternalEventBus()
+	b.done = make(chan struct{})
+	b.workers = make([]*internalWorker, workers)
+	for i := range b.workers {
+		b.workers[i] = &internalWorker{events: make(chan internalEvent, queueSize)}
+		b.workersWait.Add(1)
+		go b.handleWorker(b.workers[i])
+	}
+	return b, nil
+}
+
+// internalWorker handles the events of its queue on one goroutine.
+type internalWorker struct {
+	events chan internalEvent
+	// goroutine is the id of the goroutine of the worker.
+	goroutine uint64
+	// overflow are the events that the handlers published when the queue
+	// was full, with the events that were queued before them. It is only
+	// used by the goroutine of the worker and handled before the queue.
+	overflow []internalEvent
+}
+
+// internalEvent is an event with the handlers to notify.
+type internalEvent struct {
+	event    Event
+	parent   SpanContext
+	handlers []EventHandler
+}
+
 // PublishEvent publishes an event to all handlers capable of handling it.
+// Events published on an async bus after it has been closed are dropped.
 func (b *InternalEventBus) PublishEvent(event Event) {
-	if handlers, ok := b.eventHandlers[event.EventType()]; ok {
-		for handler := range handlers {
-			handler.HandleEvent(event)
+	b.publishEventTraced(SpanContext{}, event)
+}
+
+// traced returns the bus, see isTraced.
+func (b *InternalEventBus) traced() interface{} { return b }
+
+// publishEventTraced publishes an event with parent as the parent span of
+// its handlers.
+func (b *InternalEventBus) publishEventTraced(parent SpanContext, event Event) {
+	// Publish to the handlers of the event, to matching handlers and to
+	// local and global handlers.
+	handlers := b.handlers.handlers(event,
+		eventTypeHandlers|matchingHandlers|localHandlers|globalHandlers)
+
+	if b.workers == nil {
+		b.dispatchEvent("internal_event_bus", event, parent, handlers)
+		return
+	}
+
+	select {
+	case <-b.done:
+		return
+	default:
+	}
+
+	w := b.workers[workerIndex(event.AggregateID(), len(b.workers))]
+	e := internalEvent{event, parent, handlers}
+	select {
+	case w.events <- e:
+		return
+	default:
+	}
+
+	// A handler can not wait for its own worker, the queued events and the
+	// event are moved to the overflow to keep them in order.
+	if goroutineID() == atomic.LoadUint64(&w.goroutine) {
+		for len(w.events) > 0 {
+			w.overflow = append(w.overflow, <-w.events)
 		}
+		w.overflow = append(w.overflow, e)
+		return
 	}
 
-	// Publish to local and global handlers.
-	for handler := range b.localHandlers {
-		handler.HandleEvent(event)
+	// The queues are never closed, a full queue is waited on until the bus is
+	// closed so that a blocked publisher can not keep Close from returning.
+	select {
+	case w.events <- e:
+	case <-b.done:
+	}
+}
+
+// handleWorker handles the events of a worker until the bus is closed, and
+// then the events left.
+func (b *InternalEventBus) handleWorker(w *internalWorker) {
+	defer b.workersWait.Done()
+	atomic.StoreUint64(&w.goroutine, goroutineID())
+	for {
+		if len(w.overflow) > 0 {
+			e := w.overflow[0]
+			w.overflow = w.overflow[1:]
+			b.dispatchEvent("internal_event_bus", e.event, e.parent, e.handlers)
+			continue
+		}
+
+		select {
+		case e := <-w.events:
+			b.dispatchEvent("internal_event_bus", e.event, e.parent, e.handlers)
+		case <-b.done:
+			select {
+			case e := <-w.events:
+				b.dispatchEvent("internal_event_bus", e.event, e.parent, e.handlers)
+			default:
+				return
+			}
+		}
 	}
-	for handler := range b.globalHandlers {
-		handler.HandleEvent(event)
+}
+
+// goroutineID returns the id of the current goroutine, which the runtime only
+// has in the header of its stack trace, like "goroutine 18 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	fields := bytes.Fields(buf[:n])
+	if len(fields) < 2 {
+		return 0
 	}
+	id, _ := strconv.ParseUint(string(fields[1]), 10, 64)
+	return id
 }
 
 // AddHandler adds a handler for a specific local event.
 func (b *InternalEventBus) AddHandler(handler EventHandler, event Event) {
-	// Create handler list for new event types.
-	if _, ok := b.eventHandlers[event.EventType()]; !ok {
-		b.eventHandlers[event.EventType()] = make(map[EventHandler]bool)
-	}
+	b.handlers.addEvent(handler, event.EventType())
+}
 
-	// Add handler to event type.
-	b.eventHandlers[event.EventType()][handler] = true
+// AddMatchingHandler adds a handler for the events matching a matcher.
+func (b *InternalEventBus) AddMatchingHandler(handler EventHandler, matcher EventMatcher) {
+	b.handlers.addMatching(handler, matcher)
 }
 
 // AddLocalHandler adds a handler for local events.
 func (b *InternalEventBus) AddLocalHandler(handler EventHandler) {
-	b.localHandlers[handler] = true
+	b.handlers.addLocal(handler)
 }
 
 // AddGlobalHandler adds a handler for global (remote) events.
 func (b *InternalEventBus) AddGlobalHandler(handler EventHandler) {
-	b.globalHandlers[handler] = true
+	b.handlers.addGlobal(handler)
+}
+
+// RemoveHandler removes a handler for a specific local event. Events that
+// are already queued on an async bus are still handled by it.
+func (b *InternalEventBus) RemoveHandler(handler EventHandler, event Event) {
+	b.handlers.removeEvent(handler, event.EventType())
+}
+
+// RemoveMatchingHandler removes a handler for all its matchers.
+func (b *InternalEventBus) RemoveMatchingHandler(handler EventHandler) {
+	b.handlers.removeMatching(handler)
+}
+
+// RemoveLocalHandler removes a handler for local events.
+func (b *InternalEventBus) RemoveLocalHandler(handler EventHandler) {
+	b.handlers.removeLocal(handler)
+}
+
+// RemoveGlobalHandler removes a handler for global (remote) events.
+func (b *InternalEventBus) RemoveGlobalHandler(handler EventHandler) {
+	b.handlers.removeGlobal(handler)
+}
+
+// Close stops the workers of an async bus, after they have handled all
+// queued events.
+func (b *InternalEventBus) Close() error {
+	if b.workers == nil {
+		return nil
+	}
+	b.closeOnce.Do(func() { close(b.done) })
+	b.workersWait.Wait()
+	return nil
 }
@@ -0,0 +1,196 @@
+package eventhorizon
+
+import (
+	"sort"
+	"sync"
+)
+
+// PriorityEventHandler is an EventHandler with a priority. Handlers with a
+// higher priority handle an event before handlers with a lower priority.
+// Handlers without a priority have priority 0, handlers with the same
+// priority handle events in the order they were added.
+type PriorityEventHandler interface {
+	EventHandler
+
+	// HandlerPriority returns the priority of the handler.
+	HandlerPriority() int
+}
+
+// WithPriority returns a handler with a priority that passes events to
+// handler. Use the same priority when removing the handler from a bus.
+//
+// An example would be:
+//     bus.AddHandler(WithPriority(projector, 10), &InviteAccepted{})
+//     bus.AddHandler(notifier, &InviteAccepted{})
+func WithPriority(handler EventHandler, priority int) PriorityEventHandler {
+	return priorityEventHandler{handler, priority}
+}
+
+type priorityEventHandler struct {
+	EventHandler
+	priority int
+}
+
+// HandlerPriority implements the HandlerPriority method of the
+// PriorityEventHandler interface.
+func (h priorityEventHandler) HandlerPriority() int {
+	return h.priority
+}
+
+// handlerPriority returns the priority of a handler.
+func handlerPriority(handler EventHandler) int {
+	if h, ok := handler.(PriorityEventHandler); ok {
+		return h.HandlerPriority()
+	}
+	return 0
+}
+
+// Kinds of handlers to get from an eventHandlers.
+const (
+	eventTypeHandlers = 1 << iota
+	matchingHandlers
+	localHandlers
+	globalHandlers
+)
+
+// eventHandlers keeps the handlers of an event bus in the order they were
+// added. It is safe for concurrent use.
+type eventHandlers struct {
+	event    map[string][]EventHandler
+	matching []matchingEventHandler
+	local    []EventHandler
+	global   []EventHandler
+	lock     sync.RWMutex
+}
+
+// matchingEventHandler is a handler for the events matching a matcher.
+type matchingEventHandler struct {
+	handler EventHandler
+	matcher EventMatcher
+}
+
+func newEventHandlers() *eventHandlers {
+	return &eventHandlers{
+		event: make(map[string][]EventHandler),
+	}
+}
+
+// addEvent adds a handler for an event type.
+func (h *eventHandlers) addEvent(handler EventHandler, eventType string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.event[eventType] = addEventHandler(h.event[eventType], handler)
+}
+
+// addMatching adds a handler for the events matching a matcher.
+func (h *eventHandlers) addMatching(handler EventHandler, matcher EventMatcher) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.matching = append(h.matching, matchingEventHandler{handler, matcher})
+}
+
+// addLocal adds a handler for local events.
+func (h *eventHandlers) addLocal(handler EventHandler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.local = addEventHandler(h.local, handler)
+}
+
+// addGlobal adds a handler for global events.
+func (h *eventHandlers) addGlobal(handler EventHandler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.global = addEventHandler(h.global, handler)
+}
+
+// removeEvent removes a handler for an event type.
+func (h *eventHandlers) removeEvent(handler EventHandler, eventType string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if handlers := removeEventHandler(h.event[eventType], handler); len(handlers) > 0 {
+		h.event[eventType] = handlers
+	} else {
+		delete(h.event, eventType)
+	}
+}
+
+// removeMatching removes a handler for all its matchers.
+func (h *eventHandlers) removeMatching(handler EventHandler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var matching []matchingEventHandler
+	for _, m := range h.matching {
+		if m.handler != handler {
+			matching = append(matching, m)
+		}
+	}
+	h.matching = matching
+}
+
+// removeLocal removes a handler for local events.
+func (h *eventHandlers) removeLocal(handler EventHandler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.local = removeEventHandler(h.local, handler)
+}
+
+// removeGlobal removes a handler for global events.
+func (h *eventHandlers) removeGlobal(handler EventHandler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.global = removeEventHandler(h.global, handler)
+}
+
+// handlers returns the kinds of handlers for an event, ordered by priority.
+// Handlers with the same priority are ordered as the kinds, handlers of the
+// event type first, and then in the order they were added. The result is a
+// copy that can be used without holding the lock.
+func (h *eventHandlers) handlers(event Event, kinds int) []EventHandler {
+	h.lock.RLock()
+	var handlers []EventHandler
+	if kinds&eventTypeHandlers != 0 {
+		handlers = append(handlers, h.event[event.EventType()]...)
+	}
+	if kinds&matchingHandlers != 0 {
+		// Handlers with several matching matchers are only added once.
+		var matched []EventHandler
+		for _, m := range h.matching {
+			if m.matcher.MatchEvent(event) {
+				matched = addEventHandler(matched, m.handler)
+			}
+		}
+		handlers = append(handlers, matched...)
+	}
+	if kinds&localHandlers != 0 {
+		handlers = append(handlers, h.local...)
+	}
+	if kinds&globalHandlers != 0 {
+		handlers = append(handlers, h.global...)
+	}
+	h.lock.RUnlock()
+
+	sort.SliceStable(handlers, func(i, j int) bool {
+		return handlerPriority(handlers[i]) > handlerPriority(handlers[j])
+	})
+	return handlers
+}
+
+// addEventHandler appends a handler to a list, unless it is already added.
+func addEventHandler(handlers []EventHandler, handler EventHandler) []EventHandler {
+	for _, h := range handlers {
+		if h == handler {
+			return handlers
+		}
+	}
+	return append(handlers, handler)
+}
+
+// removeEventHandler removes a handler from a list.
+func removeEventHandler(handlers []EventHandler, handler EventHandler) []EventHandler {
+	for i, h := range handlers {
+		if h == handler {
+			return append(handlers[:i], handlers[i+1:]...)
+		}
+	}
+	return handlers
+}
@@ -0,0 +1,89 @@
+package eventhorizon
+
+import "strings"
+
+// EventMatcher selects the events that a handler is interested in.
+type EventMatcher interface {
+	// MatchEvent returns true if the event matches.
+	MatchEvent(Event) bool
+}
+
+// MatchingEventBus is an event bus that can add handlers for the events
+// selected by an EventMatcher.
+//
+// Remote buses use the matchers created by MatchEventType and
+// MatchAggregateType to only receive the matching events from the server.
+type MatchingEventBus interface {
+	EventBus
+
+	// AddMatchingHandler adds a handler for the events matching a matcher.
+	// It is called for the same events as a handler added with AddHandler.
+	//
+	// An example would be:
+	//     bus.AddMatchingHandler(notifier, MatchEventType("Invite*"))
+	AddMatchingHandler(EventHandler, EventMatcher)
+}
+
+// MatchEventType returns a matcher for events with a type matching a pattern,
+// where * matches any characters. For example "Invite*" matches both
+// InviteAccepted and InviteDeclined.
+func MatchEventType(pattern string) EventMatcher {
+	return eventTypeMatcher(pattern)
+}
+
+type eventTypeMatcher string
+
+// MatchEvent implements the MatchEvent method of the EventMatcher interface.
+func (m eventTypeMatcher) MatchEvent(event Event) bool {
+	return matchPattern(string(m), event.EventType())
+}
+
+// MatchAggregateType returns a matcher for events of an aggregate type.
+func MatchAggregateType(aggregateType string) EventMatcher {
+	return aggregateTypeMatcher(aggregateType)
+}
+
+type aggregateTypeMatcher string
+
+// MatchEvent implements the MatchEvent method of the EventMatcher interface.
+func (m aggregateTypeMatcher) MatchEvent(event Event) bool {
+	return event.AggregateType() == string(m)
+}
+
+// MatchFunc returns a matcher for the events where a predicate returns true.
+// Remote buses have to receive all events to match them.
+func MatchFunc(f func(Event) bool) EventMatcher {
+	return funcMatcher(f)
+}
+
+type funcMatcher func(Event) bool
+
+// MatchEvent implements the MatchEvent method of the EventMatcher interface.
+func (m funcMatcher) MatchEvent(event Event) bool {
+	return m(event)
+}
+
+// matchPattern matches a string with a pattern, where * matches any
+// characters.
+func matchPattern(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	// The first part must be a prefix and the last a suffix, the parts in
+	// between must be found in order.
+	first, last := parts[0], parts[len(parts)-1]
+	if !strings.HasPrefix(s, first) {
+		return false
+	}
+	s = s[len(first):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
@@ -0,0 +1,73 @@
+package eventhorizon
+
+import (
+	"github.com/odeke-em/go-uuid"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&EventMatcherSuite{})
+
+type EventMatcherSuite struct{}
+
+func (s *EventMatcherSuite) TestMatchPattern(c *C) {
+	for _, t := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"InviteAccepted", "InviteAccepted", true},
+		{"InviteAccepted", "InviteDeclined", false},
+		{"Invite*", "InviteAccepted", true},
+		{"Invite*", "Invite", true},
+		{"Invite*", "GuestInvited", false},
+		{"*Accepted", "InviteAccepted", true},
+		{"*Accepted", "AcceptedInvite", false},
+		{"I*e*d", "InviteAccepted", true},
+		{"I*e*d", "InviteAccepts", false},
+		{"a*a", "a", false},
+		{"*", "", true},
+	} {
+		c.Check(matchPattern(t.pattern, t.s), Equals, t.match, Commentf("%s %s", t.pattern, t.s))
+	}
+}
+
+func (s *EventMatcherSuite) TestMatchers(c *C) {
+	event := &TestEvent{uuid.New(), "event"}
+	c.Assert(MatchEventType("Test*").MatchEvent(event), Equals, true)
+	c.Assert(MatchEventType("TestEventOther").MatchEvent(event), Equals, false)
+	c.Assert(MatchAggregateType("Test").MatchEvent(event), Equals, true)
+	c.Assert(MatchAggregateType("Invitation").MatchEvent(event), Equals, false)
+	c.Assert(MatchFunc(func(e Event) bool { return e == event }).MatchEvent(event), Equals, true)
+}
+
+func (s *EventMatcherSuite) TestRedisSubscription(c *C) {
+	prefix := "app:events:"
+	c.Assert(redisSubscription{}.pattern(prefix), Equals, "app:events:*:*")
+	c.Assert(redisSubscription{eventType: "Invite*"}.pattern(prefix), Equals, "app:events:*:Invite*")
+	c.Assert(redisSubscription{eventType: "A?[b]*"}.pattern(prefix), Equals, `app:events:*:A\?\[b\]*`)
+	c.Assert(redisSubscription{aggregateType: "a:b*"}.pattern(prefix), Equals, `app:events:a%3Ab\*:*`)
+	c.Assert(redisSubscription{}.legacyPattern(prefix), Equals, "app:events:*")
+	c.Assert(redisSubscription{aggregateType: "Invitation"}.legacyPattern(prefix), Equals, "app:events:*")
+	c.Assert(redisSubscription{eventType: "A?*"}.legacyPattern(prefix), Equals, `app:events:A\?*`)
+
+	channel := redisChannel(prefix, "a:b%", "Event:Type")
+	c.Assert(channel, Equals, "app:events:a%3Ab%25:Event:Type")
+	aggregateType, eventType, ok := parseRedisChannel(prefix, channel)
+	c.Assert(ok, Equals, true)
+	c.Assert(aggregateType, Equals, "a:b%")
+	c.Assert(eventType, Equals, "Event:Type")
+	_, _, ok = parseRedisChannel(prefix, "app:events:Event")
+	c.Assert(ok, Equals, false)
+
+	c.Assert(redisSubscription{aggregateType: "Invitation"}.match("Invitation", "InviteAccepted"), Equals, true)
+	c.Assert(redisSubscription{aggregateType: "Invitation"}.match("Guest", "InviteAccepted"), Equals, false)
+	c.Assert(redisSubscription{eventType: "*Accepted"}.match("Guest", "InviteAccepted"), Equals, true)
+}
+
+func (s *EventMatcherSuite) TestAMQPKeys(c *C) {
+	c.Assert(amqpRoutingKey("Invitation", "InviteAccepted"), Equals, "Invitation.InviteAccepted")
+	c.Assert(amqpRoutingKey("a.b", "c*#%"), Equals, "a%2Eb.c%2A%23%25")
+	c.Assert(amqpBindingKeys(MatchEventType("InviteAccepted")), DeepEquals, []string{"*.InviteAccepted", "InviteAccepted"})
+	c.Assert(amqpBindingKeys(MatchEventType("Invite*")), DeepEquals, []string{"#"})
+	c.Assert(amqpBindingKeys(MatchAggregateType("a.b")), DeepEquals, []string{"a%2Eb.*", "*"})
+	c.Assert(amqpBindingKeys(MatchFunc(func(Event) bool { return true })), DeepEquals, []string{"#"})
+}
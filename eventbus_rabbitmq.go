@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/doubledutch/lager"
 	"github.com/streadway/amqp"
 )
 
@@ -25,18 +25,24 @@ func appTagQueueName(app, tag, queueName string) string {
 	return strings.Join([]string{app, tag, queueName}, ".")
 }
 
-// RabbitMQEventBus implements CommandBus using RabbitMQ.
+// RabbitMQEventBus implements CommandBus using RabbitMQ. Handlers are called
+// in the order they were added, unless they have a priority, see
+// PriorityEventHandler.
+//
+// Events are published with a routing key of their aggregate and event type.
+// The queue is only bound to the keys of the events that handlers have been
+// added for, global handlers and handlers with a MatchFunc matcher bind it to
+// all events. Earlier versions published events with a routing key of their
+// event type only, which the queue is bound to too.
 type RabbitMQEventBus struct {
 	conn    *amqp.Connection
 	channel *amqp.Channel
 
-	eventHandlersLock sync.Mutex
-	eventHandlers     map[string]map[EventHandler]bool
-	factoriesLock     sync.Mutex
-	factories         map[string]func() Event
-
-	localHandlers  map[EventHandler]bool
-	globalHandlers map[EventHandler]bool
+	handlers      *eventHandlers
+	factoriesLock sync.Mutex
+	factories     map[string]func() Event
+	bindingsLock  sync.Mutex
+	bindings      map[string]bool
 
 	done chan error
 
@@ -45,26 +51,24 @@ type RabbitMQEventBus struct {
 	queue       string
 	tag         string
 
-	lgr lager.ContextLager
+	logging
+	instrumentation
 }
 
 // NewRabbitMQEventBus creates a new RabbitMQ event bus. amqpURI is the RabbitMQ
 // URI for rabbitmq. app is provides a namespace for this application, allowing
 // for multiple event buses to run on one RabbitMQ and not conflict with eachother.
-// tag is used as the RabbitMQ consumer tag for this bus.
+// tag is used as the RabbitMQ consumer tag for this bus. The bus logs to lager
+// until another logger is set with SetLogger.
 func NewRabbitMQEventBus(amqpURI, app, tag string) (*RabbitMQEventBus, error) {
-	lgr := lager.Child()
-
 	connection, err := amqp.Dial(amqpURI)
 	if err != nil {
-		lgr.WithError(err).Errorf("Error dialing URI: %s", amqpURI)
 		return nil, fmt.Errorf("Dial err: %s", err)
 	}
 
 	channel, err := connection.Channel()
 	if err != nil {
 		connection.Close()
-		lgr.WithError(err).Errorf("Error opening channel")
 		return nil, fmt.Errorf("Channel: %s", err)
 	}
 
@@ -82,7 +86,6 @@ func NewRabbitMQEventBus(amqpURI, app, tag string) (*RabbitMQEventBus, error) {
 	); err != nil {
 		channel.Close()
 		connection.Close()
-		lgr.WithError(err).Errorf("Error declaring exchange :%s", exchange)
 		return nil, fmt.Errorf("Exchange Declare: %s", err)
 	}
 
@@ -97,21 +100,20 @@ func NewRabbitMQEventBus(amqpURI, app, tag string) (*RabbitMQEventBus, error) {
 	if err != nil {
 		channel.Close()
 		connection.Close()
-		lgr.WithError(err).Errorf("Error declaring queue %s", queueName)
 		return nil, fmt.Errorf("Queue Declare: %s", err)
 	}
 
-	if err = channel.QueueBind(
+	// The queue is bound when handlers are added, remove the binding to all
+	// events of earlier versions of the bus.
+	if err = channel.QueueUnbind(
 		queue.Name, // name of the queue
-		commandKey, // bindingKey
+		eventKey,   // bindingKey
 		exchange,   // sourceExchange
-		false,      // noWait
 		nil,        // arguments
 	); err != nil {
 		channel.Close()
 		connection.Close()
-		lgr.WithError(err).Errorf("Error binding queue %s", queueName)
-		return nil, fmt.Errorf("Queue Bind: %s", err)
+		return nil, fmt.Errorf("Queue Unbind: %s", err)
 	}
 
 	deliveries, err := channel.Consume(
@@ -126,23 +128,21 @@ func NewRabbitMQEventBus(amqpURI, app, tag string) (*RabbitMQEventBus, error) {
 	if err != nil {
 		channel.Close()
 		connection.Close()
-		lgr.WithError(err).Errorf("Error consuming queue %s", queueName)
 		return nil, fmt.Errorf("Queue Consume: %s", err)
 	}
 
 	bus := &RabbitMQEventBus{
-		conn:           connection,
-		channel:        channel,
-		exchange:       exchange,
-		queue:          queueName,
-		tag:            tag,
-		eventHandlers:  make(map[string]map[EventHandler]bool),
-		localHandlers:  make(map[EventHandler]bool),
-		globalHandlers: make(map[EventHandler]bool),
-		factories:      make(map[string]func() Event),
-		done:           make(chan error),
-		lgr:            lgr,
+		conn:      connection,
+		channel:   channel,
+		exchange:  exchange,
+		queue:     queueName,
+		tag:       tag,
+		handlers:  newEventHandlers(),
+		factories: make(map[string]func() Event),
+		bindings:  make(map[string]bool),
+		done:      make(chan error),
 	}
+	bus.logToLager()
 
 	go bus.handleEvents(deliveries, bus.done)
 	return bus, nil
@@ -150,34 +150,47 @@ func NewRabbitMQEventBus(amqpURI, app, tag string) (*RabbitMQEventBus, error) {
 
 // PublishEvent publishes a command to the commands exchange.
 func (b *RabbitMQEventBus) PublishEvent(event Event) {
+	b.publishEventTraced(SpanContext{}, event)
+}
+
+// traced returns the bus, see isTraced.
+func (b *RabbitMQEventBus) traced() interface{} { return b }
+
+// publishEventTraced publishes an event with parent as the parent span of
+// its handlers, which is sent with the event to the queue.
+func (b *RabbitMQEventBus) publishEventTraced(parent SpanContext, event Event) {
 	// Send it locally
-	for handler := range b.localHandlers {
-		handler.HandleEvent(event)
-	}
+	b.dispatchEvent("rabbitmq_event_bus", event, parent, b.handlers.handlers(event, localHandlers))
 
 	// Send it to the queue
 	d, err := json.Marshal(event)
 	if err != nil {
-		b.lgr.WithError(err).With(map[string]string{
-			"event": event.AggregateID(),
-		}).Errorf("Unable to publish event")
+		b.logger().WithError(err).With(eventFields(event)).
+			Errorf("Unable to marshal event")
 		return
 	}
 
-	b.channel.Publish(
-		b.exchange,        // publish to an exchange
-		event.EventType(), // routing to 0 or more queues
-		false,             // mandatory
-		false,             // immediate
+	key := amqpRoutingKey(event.AggregateType(), event.EventType())
+	err = b.channel.Publish(
+		b.exchange, // publish to an exchange
+		key,        // routing to 0 or more queues
+		false,      // mandatory
+		false,      // immediate
 		amqp.Publishing{
-			Headers:         amqp.Table{},
+			Headers:         amqpTraceHeaders(parent),
 			ContentType:     "application/json",
 			ContentEncoding: "",
+			Type:            event.EventType(),
+			Timestamp:       time.Now(),
 			Body:            d,
 			DeliveryMode:    amqp.Transient, // 1=non-persistent, 2=persistent
 			Priority:        0,              // 0-9
 			// a bunch of application/implementation-specific fields
 		})
+	if err != nil {
+		b.logger().WithError(err).With(eventFields(event)).
+			Errorf("Unable to publish event")
+	}
 }
 
 // Close closes the command bus, closing the rabbitmq connection.
@@ -196,24 +209,38 @@ func (b *RabbitMQEventBus) Close() error {
 
 func (b *RabbitMQEventBus) handleEvents(deliveries <-chan amqp.Delivery, done chan error) {
 	for d := range deliveries {
+		// Events published by earlier versions of the bus only have the
+		// event type as routing key.
+		eventType := d.Type
+		if eventType == "" {
+			eventType = d.RoutingKey
+		}
+
 		b.factoriesLock.Lock()
-		f, ok := b.factories[d.RoutingKey]
+		f, ok := b.factories[eventType]
 		b.factoriesLock.Unlock()
 		if !ok {
+			b.logger().With(map[string]string{
+				"eventType": eventType,
+			}).Warnf("No factory for event type")
 			d.Reject(false)
 			continue
 		}
 
 		event := f()
 		if err := json.Unmarshal(d.Body, event); err != nil {
-			b.lgr.WithError(err).With(map[string]string{
-				"eventType": d.RoutingKey,
+			b.logger().WithError(err).With(map[string]string{
+				"eventType": eventType,
 			}).Errorf("Unable to unmarshal received event")
 			d.Reject(false)
 			continue
 		}
+		if !d.Timestamp.IsZero() {
+			b.metrics().ObserveConsumerLag("rabbitmq_event_bus",
+				eventType, time.Since(d.Timestamp))
+		}
 
-		if err := b.handleEvent(event); err != nil {
+		if err := b.handleEvent(event, amqpSpanContext(d.Headers)); err != nil {
 			d.Reject(false)
 			continue
 		}
@@ -223,19 +250,10 @@ func (b *RabbitMQEventBus) handleEvents(deliveries <-chan amqp.Delivery, done ch
 	done <- nil
 }
 
-func (b *RabbitMQEventBus) handleEvent(event Event) error {
-	b.eventHandlersLock.Lock()
-	handlers, ok := b.eventHandlers[event.EventType()]
-	b.eventHandlersLock.Unlock()
-	if ok {
-		for handler := range handlers {
-			handler.HandleEvent(event)
-		}
-	}
-
-	for handler := range b.globalHandlers {
-		handler.HandleEvent(event)
-	}
+func (b *RabbitMQEventBus) handleEvent(event Event, parent SpanContext) error {
+	handlers := b.handlers.handlers(event,
+		eventTypeHandlers|matchingHandlers|globalHandlers)
+	b.dispatchEvent("rabbitmq_event_bus", event, parent, handlers)
 
 	return nil
 }
@@ -255,22 +273,98 @@ func (b *RabbitMQEventBus) RegisterEventType(event Event, factory func() Event)
 
 // AddHandler adds a handler for a specific local event.
 func (b *RabbitMQEventBus) AddHandler(handler EventHandler, event Event) {
-	b.eventHandlersLock.Lock()
-	defer b.eventHandlersLock.Unlock()
-	if _, ok := b.eventHandlers[event.EventType()]; !ok {
-		b.eventHandlers[event.EventType()] = make(map[EventHandler]bool)
+	b.handlers.addEvent(handler, event.EventType())
+	for _, key := range amqpBindingKeys(MatchEventType(event.EventType())) {
+		b.bind(key)
 	}
+}
 
-	// Add handler to event type.
-	b.eventHandlers[event.EventType()][handler] = true
+// AddMatchingHandler adds a handler for the events matching a matcher. The
+// matchers created by MatchEventType and MatchAggregateType bind the queue to
+// the matching events only.
+func (b *RabbitMQEventBus) AddMatchingHandler(handler EventHandler, matcher EventMatcher) {
+	b.handlers.addMatching(handler, matcher)
+	for _, key := range amqpBindingKeys(matcher) {
+		b.bind(key)
+	}
 }
 
 // AddLocalHandler adds a handler for local events.
 func (b *RabbitMQEventBus) AddLocalHandler(handler EventHandler) {
-	b.localHandlers[handler] = true
+	b.handlers.addLocal(handler)
 }
 
 // AddGlobalHandler adds a handler for global (remote) events.
 func (b *RabbitMQEventBus) AddGlobalHandler(handler EventHandler) {
-	b.globalHandlers[handler] = true
+	b.handlers.addGlobal(handler)
+	b.bind(eventKey)
+}
+
+// bind binds the queue to a key, unless it is already bound. Errors are
+// logged, as the add methods of an EventBus can not return them, and the key
+// is bound again by the next handler that needs it.
+func (b *RabbitMQEventBus) bind(key string) {
+	b.bindingsLock.Lock()
+	defer b.bindingsLock.Unlock()
+	if b.bindings[key] {
+		return
+	}
+
+	if err := b.channel.QueueBind(
+		b.queue,    // name of the queue
+		key,        // bindingKey
+		b.exchange, // sourceExchange
+		false,      // noWait
+		nil,        // arguments
+	); err != nil {
+		b.logger().WithError(err).With(map[string]string{
+			"bindingKey": key,
+		}).Errorf("Error binding queue %s", b.queue)
+		return
+	}
+	b.bindings[key] = true
+}
+
+// The aggregate and event type are escaped to not contain the characters
+// that are special in routing and binding keys.
+var amqpKeyEscaper = strings.NewReplacer(
+	"%", "%25", ".", "%2E", "*", "%2A", "#", "%23")
+
+// amqpRoutingKey returns the routing key of an aggregate and event type.
+func amqpRoutingKey(aggregateType, eventType string) string {
+	return amqpKeyEscaper.Replace(aggregateType) + "." + amqpKeyEscaper.Replace(eventType)
+}
+
+// amqpBindingKeys returns the binding keys for the events matching a matcher,
+// including the key of the event type only that earlier versions published
+// with. Legacy keys have no aggregate type, so aggregate types bind to all of
+// them. Event type patterns with a * can not be expressed as a binding key and
+// bind to all events.
+func amqpBindingKeys(matcher EventMatcher) []string {
+	switch m := matcher.(type) {
+	case eventTypeMatcher:
+		if !strings.Contains(string(m), "*") {
+			return []string{"*." + amqpKeyEscaper.Replace(string(m)), string(m)}
+		}
+	case aggregateTypeMatcher:
+		return []string{amqpKeyEscaper.Replace(string(m)) + ".*", "*"}
+	}
+	return []string{eventKey}
+}
+
+// amqpTraceHeaders returns message headers with the traceparent of a span
+// context, if it is valid.
+func amqpTraceHeaders(context SpanContext) amqp.Table {
+	headers := amqp.Table{}
+	if context.IsValid() {
+		headers["traceparent"] = traceparent(context)
+	}
+	return headers
+}
+
+// amqpSpanContext returns the span context in the headers of a received
+// message, which is invalid if it has none.
+func amqpSpanContext(headers amqp.Table) SpanContext {
+	header, _ := headers["traceparent"].(string)
+	return parseTraceparent(header)
 }
@@ -2,7 +2,14 @@
 
 package eventhorizon
 
-import . "gopkg.in/check.v1"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/odeke-em/go-uuid"
+	"github.com/streadway/amqp"
+	. "gopkg.in/check.v1"
+)
 
 var _ = Suite(&RabbitMQEventBusSuite{})
 
@@ -45,3 +52,46 @@ func (s *RabbitMQEventBusSuite) Test_NewHandlerEventBus(c *C) {
 	c.Assert(bus, NotNil)
 	bus.Close()
 }
+
+func (s *RabbitMQEventBusSuite) Test_BindError(c *C) {
+	bus, err := NewRabbitMQEventBus(s.uri, "test", "bind")
+	c.Assert(err, IsNil)
+	defer bus.Close()
+	logger := newMockLogger()
+	bus.SetLogger(logger)
+
+	// Binding to an exchange that does not exist fails.
+	bus.exchange = "test_missing_exchange"
+	bus.AddHandler(NewMockEventHandler(), &TestEvent{})
+	entries := logger.Entries()
+	c.Assert(entries, HasLen, 2)
+	for i, key := range []string{"*.TestEvent", "TestEvent"} {
+		c.Assert(entries[i].level, Equals, "error")
+		c.Assert(entries[i].message, Equals, "Error binding queue "+bus.queue)
+		c.Assert(entries[i].fields["bindingKey"], Equals, key)
+		c.Assert(entries[i].fields["error"], Not(Equals), "")
+	}
+	c.Assert(bus.bindings, HasLen, 0)
+}
+
+func (s *RabbitMQEventBusSuite) Test_LegacyRoutingKey(c *C) {
+	handler := NewMockEventHandler()
+	s.bus.AddHandler(handler, &TestEvent{})
+
+	// Earlier versions publish with a routing key of the event type only,
+	// and without a message type.
+	event1 := &TestEvent{uuid.New(), "legacy"}
+	body, err := json.Marshal(event1)
+	c.Assert(err, IsNil)
+	bus2 := s.bus2.(*RabbitMQEventBus)
+	err = bus2.channel.Publish(bus2.exchange, event1.EventType(), false, false,
+		amqp.Publishing{ContentType: "application/json", Body: body})
+	c.Assert(err, IsNil)
+
+	select {
+	case <-handler.recv:
+	case <-time.After(5 * time.Second):
+		c.Fatal("event not received")
+	}
+	c.Assert(handler.events, DeepEquals, []Event{event1})
+}
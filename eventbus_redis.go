@@ -15,118 +15,182 @@
 package eventhorizon
 
 import (
-	"log"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/garyburd/redigo/redis"
 	"gopkg.in/mgo.v2/bson"
 )
 
 // RedisEventBus is an event bus that notifies registered EventHandlers of
-// published events.
+// published events. Handlers are called in the order they were added, unless
+// they have a priority, see PriorityEventHandler.
+//
+// Events are published on a channel per aggregate and event type. The bus
+// only subscribes to the channels of the events that handlers have been
+// added for, global handlers and handlers with a MatchFunc matcher subscribe
+// to all events.
+//
+// Earlier versions published events on a channel per event type only. The
+// bus subscribes to those channels too and handles their events, but earlier
+// versions do not receive the events published by this one.
 type RedisEventBus struct {
-	eventHandlers  map[string]map[EventHandler]bool
-	localHandlers  map[EventHandler]bool
-	globalHandlers map[EventHandler]bool
-	prefix         string
-	pool           *redis.Pool
-	conn           *redis.PubSubConn
-	factories      map[string]func() Event
-	exit           chan struct{}
+	handlers  *eventHandlers
+	prefix    string
+	pool      *redis.Pool
+	conn      *redis.PubSubConn
+	factories map[string]func() Event
+	exit      chan struct{}
+
+	// messages are received messages waiting to be handled. They are
+	// handled on another goroutine than they are received on, so that
+	// handlers can add handlers and wait for the subscriptions.
+	messages     []redis.PMessage
+	messagesCond *sync.Cond
+	received     bool
+	handled      chan struct{}
+
+	// subscriptions are in the order they were made, each with a channel
+	// that is closed when Redis has confirmed it.
+	subscriptions     []redisSubscription
+	subscribed        map[string]chan struct{}
+	subscriptionsLock sync.RWMutex
+
+	logging
+	instrumentation
+}
+
+// redisSubscription is a subscription to the events of an aggregate type
+// with an event type matching a pattern, an empty field matches any type.
+type redisSubscription struct {
+	aggregateType string
+	eventType     string
 }
 
 // NewRedisEventBus creates a RedisEventBus for remote events.
 func NewRedisEventBus(appID, server, password string) (*RedisEventBus, error) {
-	pool := &redis.Pool{
-		MaxIdle:     3,
-		IdleTimeout: 240 * time.Second,
-		Dial: func() (redis.Conn, error) {
-			c, err := redis.Dial("tcp", server)
-			if err != nil {
-				return nil, err
-			}
-			if password != "" {
-				if _, err := c.Do("AUTH", password); err != nil {
-					c.Close()
-					return nil, err
-				}
-			}
-			return c, err
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			_, err := c.Do("PING")
-			return err
-		},
-	}
-
+	pool := newRedisPool(server, password)
 	return NewRedisEventBusWithPool(appID, pool)
 }
 
-// NewRedisEventBusWithPool creates a RedisEventBus for remote events.
+// NewRedisEventBusWithPool creates a RedisEventBus for remote events. It
+// logs to lager until another logger is set with SetLogger.
 func NewRedisEventBusWithPool(appID string, pool *redis.Pool) (*RedisEventBus, error) {
 	b := &RedisEventBus{
-		eventHandlers:  make(map[string]map[EventHandler]bool),
-		localHandlers:  make(map[EventHandler]bool),
-		globalHandlers: make(map[EventHandler]bool),
-		prefix:         appID + ":events:",
-		pool:           pool,
-		factories:      make(map[string]func() Event),
-		exit:           make(chan struct{}),
+		handlers:   newEventHandlers(),
+		prefix:     appID + ":events:",
+		pool:       pool,
+		factories:  make(map[string]func() Event),
+		exit:       make(chan struct{}),
+		subscribed: make(map[string]chan struct{}),
+		handled:    make(chan struct{}),
 	}
+	b.messagesCond = sync.NewCond(&sync.Mutex{})
+	b.logToLager()
 
-	// Add a patten matching subscription.
+	// Subscriptions are made when handlers are added, check the connection
+	// before receiving.
 	b.conn = &redis.PubSubConn{Conn: b.pool.Get()}
-	ready := make(chan struct{})
-	go b.receiveGlobal(ready)
-	err := b.conn.PSubscribe(b.prefix + "*")
-	if err != nil {
-		b.Close()
+	if _, err := b.conn.Conn.Do("PING"); err != nil {
+		b.conn.Close()
 		return nil, err
 	}
-	<-ready
+	go b.receiveGlobal()
+	go b.handleGlobal()
 
 	return b, nil
 }
 
 // PublishEvent publishes an event to all handlers capable of handling it.
 func (b *RedisEventBus) PublishEvent(event Event) {
+	b.publishEventTraced(SpanContext{}, event)
+}
+
+// traced returns the bus, see isTraced.
+func (b *RedisEventBus) traced() interface{} { return b }
+
+// publishEventTraced publishes an event with parent as the parent span of
+// its handlers, which is sent with the event to global handlers.
+func (b *RedisEventBus) publishEventTraced(parent SpanContext, event Event) {
 	// Publish to local handlers.
-	for handler := range b.localHandlers {
-		handler.HandleEvent(event)
-	}
+	b.dispatchEvent("redis_event_bus", event, parent, b.handlers.handlers(event, localHandlers))
 
 	// Publish to global handlers.
-	b.publishGlobal(event)
+	b.publishGlobal(event, parent)
 
 }
 
 // AddHandler adds a handler for a specific local event.
 func (b *RedisEventBus) AddHandler(handler EventHandler, event Event) {
-	// Create handler list for new event types.
-	if _, ok := b.eventHandlers[event.EventType()]; !ok {
-		b.eventHandlers[event.EventType()] = make(map[EventHandler]bool)
-	}
+	b.handlers.addEvent(handler, event.EventType())
+	b.subscribe(redisSubscription{eventType: event.EventType()})
+}
 
-	// Add handler to event type.
-	b.eventHandlers[event.EventType()][handler] = true
+// AddMatchingHandler adds a handler for the events matching a matcher. The
+// matchers created by MatchEventType and MatchAggregateType subscribe to the
+// channels of the matching events only.
+func (b *RedisEventBus) AddMatchingHandler(handler EventHandler, matcher EventMatcher) {
+	b.handlers.addMatching(handler, matcher)
+	switch m := matcher.(type) {
+	case eventTypeMatcher:
+		b.subscribe(redisSubscription{eventType: string(m)})
+	case aggregateTypeMatcher:
+		b.subscribe(redisSubscription{aggregateType: string(m)})
+	default:
+		b.subscribe(redisSubscription{})
+	}
 }
 
 // AddLocalHandler adds a handler for local events.
 func (b *RedisEventBus) AddLocalHandler(handler EventHandler) {
-	b.localHandlers[handler] = true
+	b.handlers.addLocal(handler)
 }
 
 // AddGlobalHandler adds a handler for global (remote) events.
 func (b *RedisEventBus) AddGlobalHandler(handler EventHandler) {
-	b.globalHandlers[handler] = true
+	b.handlers.addGlobal(handler)
+	b.subscribe(redisSubscription{})
+}
+
+// subscribe subscribes to the channel patterns of a subscription, unless it
+// is already subscribed, and waits for Redis to confirm them. It can be called
+// by handlers, the confirmation is received while they handle events.
+func (b *RedisEventBus) subscribe(s redisSubscription) {
+	patterns := []string{s.pattern(b.prefix), s.legacyPattern(b.prefix)}
+
+	b.subscriptionsLock.Lock()
+	if _, ok := b.subscribed[patterns[0]]; !ok {
+		b.subscriptions = append(b.subscriptions, s)
+	}
+	var waits []chan struct{}
+	for _, pattern := range patterns {
+		ready, ok := b.subscribed[pattern]
+		if !ok {
+			ready = make(chan struct{})
+			b.subscribed[pattern] = ready
+			if err := b.conn.PSubscribe(pattern); err != nil {
+				b.logger().WithError(err).With(map[string]string{"pattern": pattern}).Errorf("Unable to subscribe")
+			}
+		}
+		waits = append(waits, ready)
+	}
+	b.subscriptionsLock.Unlock()
+
+	for _, ready := range waits {
+		select {
+		case <-ready:
+		case <-b.exit:
+			return
+		}
+	}
 }
 
 // RegisterEventType registers an event factory for a event type. The factory is
 // used to create concrete event types when receiving from subscriptions.
 //
 // An example would be:
-//     eventStore.RegisterEventType(&MyEvent{}, func() Event { return &MyEvent{} })
+//
+//	eventStore.RegisterEventType(&MyEvent{}, func() Event { return &MyEvent{} })
 func (b *RedisEventBus) RegisterEventType(event Event, factory func() Event) error {
 	if _, ok := b.factories[event.EventType()]; ok {
 		return ErrHandlerAlreadySet
@@ -137,85 +201,254 @@ func (b *RedisEventBus) RegisterEventType(event Event, factory func() Event) err
 	return nil
 }
 
-// Close exits the recive goroutine by unsubscribing to all channels.
+// Close exits the recive goroutine by unsubscribing to all channels, after
+// the received events have been handled.
 func (b *RedisEventBus) Close() error {
+	b.subscriptionsLock.Lock()
 	err := b.conn.PUnsubscribe()
+	b.subscriptionsLock.Unlock()
 	if err != nil {
-		log.Printf("error: event bus close: %v\n", err)
+		b.logger().WithError(err).Errorf("Unable to unsubscribe")
 	}
 	<-b.exit
+	<-b.handled
 	err = b.conn.Close()
 	if err != nil {
-		log.Printf("error: event bus close: %v\n", err)
+		b.logger().WithError(err).Errorf("Unable to close connection")
 	}
 	return err
 }
 
-func (b *RedisEventBus) publishGlobal(event Event) {
+func (b *RedisEventBus) publishGlobal(event Event, parent SpanContext) {
 	conn := b.pool.Get()
 	defer conn.Close()
 	if err := conn.Err(); err != nil {
-		log.Printf("error: event bus publish: %v\n", err)
+		b.logger().WithError(err).With(eventFields(event)).Errorf("Unable to publish event")
+		return
 	}
 
-	// Marshal event data.
+	// Marshal event data, with the trace context of the parent.
 	var data []byte
 	var err error
-	if data, err = bson.Marshal(event); err != nil {
-		log.Printf("error: event bus publish: %v\n", ErrCouldNotMarshalEvent)
+	if data, err = marshalRedisEvent(event, parent); err != nil {
+		b.logger().WithError(err).With(eventFields(event)).Errorf("Unable to marshal event")
+		return
 	}
 
-	// Publish all events on their own channel.
-	if _, err = conn.Do("PUBLISH", b.prefix+event.EventType(), data); err != nil {
-		log.Printf("error: event bus publish: %v\n", err)
+	// Publish all events on the channel of their aggregate and event type.
+	channel := redisChannel(b.prefix, event.AggregateType(), event.EventType())
+	if _, err = conn.Do("PUBLISH", channel, data); err != nil {
+		b.logger().WithError(err).With(eventFields(event)).Errorf("Unable to publish event")
 	}
 }
 
-func (b *RedisEventBus) receiveGlobal(ready chan struct{}) {
+// receiveGlobal receives messages until all channels are unsubscribed, and
+// queues them to be handled by handleGlobal.
+func (b *RedisEventBus) receiveGlobal() {
+	defer func() {
+		b.messagesCond.L.Lock()
+		b.received = true
+		b.messagesCond.L.Unlock()
+		b.messagesCond.Signal()
+		close(b.exit)
+	}()
+
 	for {
 		switch n := b.conn.Receive().(type) {
 		case redis.PMessage:
-			// Extract the event type from the channel name.
-			eventType := strings.TrimPrefix(n.Channel, b.prefix)
-
-			// Get the registered factory function for creating events.
-			f, ok := b.factories[eventType]
-			if !ok {
-				log.Printf("error: event bus receive: %v\n", ErrEventNotRegistered)
-				continue
-			}
-
-			// Manually decode the raw BSON event.
-			data := bson.Raw{3, n.Data}
-			event := f()
-			if err := data.Unmarshal(event); err != nil {
-				log.Printf("error: event bus receive: %v\n", ErrCouldNotUnmarshalEvent)
-				continue
-			}
-
-			if handlers, ok := b.eventHandlers[event.EventType()]; ok {
-				for handler := range handlers {
-					handler.HandleEvent(event)
-				}
-			}
-
-			for handler := range b.globalHandlers {
-				handler.HandleEvent(event)
-			}
+			b.messagesCond.L.Lock()
+			b.messages = append(b.messages, n)
+			b.messagesCond.L.Unlock()
+			b.messagesCond.Signal()
 		case redis.Subscription:
 			switch n.Kind {
 			case "psubscribe":
-				close(ready)
+				b.subscriptionsLock.RLock()
+				if ready, ok := b.subscribed[n.Channel]; ok {
+					close(ready)
+				}
+				b.subscriptionsLock.RUnlock()
 			case "punsubscribe":
 				if n.Count == 0 {
-					close(b.exit)
 					return
 				}
 			}
 		case error:
-			log.Printf("error: event bus receive: %v\n", n)
-			close(b.exit)
+			b.logger().WithError(n).Errorf("Unable to receive events")
+			return
+		}
+	}
+}
+
+// handleGlobal handles the received messages in order, until all have been
+// received and handled.
+func (b *RedisEventBus) handleGlobal() {
+	defer close(b.handled)
+	for {
+		b.messagesCond.L.Lock()
+		for len(b.messages) == 0 && !b.received {
+			b.messagesCond.Wait()
+		}
+		if len(b.messages) == 0 {
+			b.messagesCond.L.Unlock()
 			return
 		}
+		n := b.messages[0]
+		b.messages = b.messages[1:]
+		b.messagesCond.L.Unlock()
+
+		b.handleMessage(n)
+	}
+}
+
+// handleMessage decodes the event of a message and passes it to the
+// handlers.
+func (b *RedisEventBus) handleMessage(n redis.PMessage) {
+	// Extract the aggregate and event type from the channel name. Earlier
+	// versions publish on a channel of the event type only.
+	aggregateType, eventType, ok := parseRedisChannel(b.prefix, n.Channel)
+	legacy := false
+	if !ok {
+		if !strings.HasPrefix(n.Channel, b.prefix) {
+			return
+		}
+		eventType, legacy = n.Channel[len(b.prefix):], true
+	}
+
+	// A message of this version is received once for every pattern matching
+	// its channel, handle it for the first subscription only.
+	if !legacy && !b.firstSubscription(aggregateType, eventType, n.Pattern, false) {
+		return
+	}
+
+	// Get the registered factory function for creating events.
+	f, ok := b.factories[eventType]
+	if !ok {
+		b.logger().With(map[string]string{"eventType": eventType}).Warnf("No factory for event type")
+		return
+	}
+
+	// Manually decode the raw BSON event.
+	data := bson.Raw{3, n.Data}
+	event := f()
+	if err := data.Unmarshal(event); err != nil {
+		b.logger().WithError(err).With(map[string]string{"eventType": eventType}).Errorf("Unable to unmarshal received event")
+		return
+	}
+
+	// The aggregate type of a legacy message is known from its event only.
+	if legacy && !b.firstSubscription(event.AggregateType(), eventType, n.Pattern, true) {
+		return
+	}
+
+	handlers := b.handlers.handlers(event,
+		eventTypeHandlers|matchingHandlers|globalHandlers)
+	b.dispatchEvent("redis_event_bus", event, redisEventSpanContext(n.Data), handlers)
+}
+
+// firstSubscription checks if the pattern is the one of the first subscription
+// matching an aggregate and event type, or its legacy pattern.
+func (b *RedisEventBus) firstSubscription(aggregateType, eventType, pattern string, legacy bool) bool {
+	b.subscriptionsLock.RLock()
+	defer b.subscriptionsLock.RUnlock()
+	for _, s := range b.subscriptions {
+		if s.match(aggregateType, eventType) {
+			if legacy {
+				return s.legacyPattern(b.prefix) == pattern
+			}
+			return s.pattern(b.prefix) == pattern
+		}
+	}
+	return false
+}
+
+// match checks if the subscription is for an aggregate and event type.
+func (s redisSubscription) match(aggregateType, eventType string) bool {
+	return (s.aggregateType == "" || s.aggregateType == aggregateType) &&
+		(s.eventType == "" || matchPattern(s.eventType, eventType))
+}
+
+// pattern returns the channel pattern of the subscription. The * in the event
+// type is kept as a wildcard.
+func (s redisSubscription) pattern(prefix string) string {
+	aggregateType := "*"
+	if s.aggregateType != "" {
+		aggregateType = redisPatternEscaper.Replace(redisAggregateEscaper.Replace(s.aggregateType))
+	}
+	return redisPatternEscaper.Replace(prefix) + aggregateType + ":" + s.eventTypePattern()
+}
+
+// legacyPattern returns the channel pattern of the subscription for events
+// published by earlier versions, on a channel per event type. It matches
+// the events of any aggregate type.
+func (s redisSubscription) legacyPattern(prefix string) string {
+	return redisPatternEscaper.Replace(prefix) + s.eventTypePattern()
+}
+
+// eventTypePattern returns the pattern of the event type, with the * kept as
+// a wildcard.
+func (s redisSubscription) eventTypePattern() string {
+	if s.eventType == "" {
+		return "*"
+	}
+	parts := strings.Split(s.eventType, "*")
+	for i, p := range parts {
+		parts[i] = redisPatternEscaper.Replace(p)
+	}
+	return strings.Join(parts, "*")
+}
+
+var (
+	// The aggregate type is escaped to not contain the : that separates it
+	// from the event type, and so is the collection of a RedisReadRepository.
+	redisAggregateEscaper   = strings.NewReplacer("%", "%25", ":", "%3A")
+	redisAggregateUnescaper = strings.NewReplacer("%25", "%", "%3A", ":")
+
+	// The special characters of Redis patterns are escaped with a \.
+	redisPatternEscaper = strings.NewReplacer(
+		"\\", "\\\\", "*", "\\*", "?", "\\?", "[", "\\[", "]", "\\]")
+)
+
+// redisChannel returns the channel of an aggregate and event type.
+func redisChannel(prefix, aggregateType, eventType string) string {
+	return prefix + redisAggregateEscaper.Replace(aggregateType) + ":" + eventType
+}
+
+// parseRedisChannel returns the aggregate and event type of a channel.
+func parseRedisChannel(prefix, channel string) (string, string, bool) {
+	if !strings.HasPrefix(channel, prefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(channel[len(prefix):], ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return redisAggregateUnescaper.Replace(parts[0]), parts[1], true
+}
+
+// marshalRedisEvent marshals an event to BSON, with the traceparent of a span
+// context in an extra _traceparent field.
+func marshalRedisEvent(event Event, context SpanContext) ([]byte, error) {
+	data, err := bson.Marshal(event)
+	if err != nil || !context.IsValid() {
+		return data, err
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	doc = append(doc, bson.DocElem{Name: "_traceparent", Value: traceparent(context)})
+	return bson.Marshal(doc)
+}
+
+// redisEventSpanContext returns the span context of a received event, which
+// is invalid if it has none.
+func redisEventSpanContext(data []byte) SpanContext {
+	var metadata struct {
+		Traceparent string `bson:"_traceparent"`
+	}
+	if err := (bson.Raw{3, data}).Unmarshal(&metadata); err != nil {
+		return SpanContext{}
 	}
+	return parseTraceparent(metadata.Traceparent)
 }
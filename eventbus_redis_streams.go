@@ -0,0 +1,478 @@
+package eventhorizon
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// redisStreamReadCount is the max number of entries read per XREADGROUP.
+	redisStreamReadCount = 100
+
+	// redisStreamBlock is how long a read blocks waiting for new entries, in
+	// milliseconds. It also bounds how long Close has to wait.
+	redisStreamBlock = 1000
+
+	// DefaultRedisStreamMaxLen is the approximate number of entries kept in
+	// the stream before old entries are trimmed.
+	DefaultRedisStreamMaxLen = 100000
+
+	// DefaultRedisStreamClaimMinIdle is how long an entry must have been
+	// pending on another consumer before it is reclaimed.
+	DefaultRedisStreamClaimMinIdle = time.Minute
+)
+
+// RedisStreamEventBus is an event bus that uses Redis Streams and consumer
+// groups to deliver events to remote handlers at least once.
+//
+// All buses in the same group share the events between them, each event is
+// handled by one of them. Use different groups to let several services
+// receive all events. Events that were read but never acknowledged, for
+// example because the consumer crashed, are claimed by another consumer in
+// the group once they have been idle for the claim time.
+//
+// Handlers are called in the order they were added, unless they have a
+// priority, see PriorityEventHandler.
+type RedisStreamEventBus struct {
+	handlers      *eventHandlers
+	factoriesLock sync.RWMutex
+	factories     map[string]func() Event
+
+	optionsLock  sync.RWMutex
+	maxLen       int
+	claimMinIdle time.Duration
+
+	stream   string
+	group    string
+	consumer string
+	pool     *redis.Pool
+	exit     chan struct{}
+	done     chan struct{}
+
+	logging
+	instrumentation
+}
+
+// NewRedisStreamEventBus creates a RedisStreamEventBus for remote events.
+// group is the consumer group shared by all instances of a service and
+// consumer is the unique name of this instance within the group.
+func NewRedisStreamEventBus(appID, group, consumer, server, password string) (*RedisStreamEventBus, error) {
+	pool := newRedisPool(server, password)
+	return NewRedisStreamEventBusWithPool(appID, group, consumer, pool)
+}
+
+// NewRedisStreamEventBusWithPool creates a RedisStreamEventBus for remote events.
+func NewRedisStreamEventBusWithPool(appID, group, consumer string, pool *redis.Pool) (*RedisStreamEventBus, error) {
+	b := &RedisStreamEventBus{
+		handlers:     newEventHandlers(),
+		factories:    make(map[string]func() Event),
+		maxLen:       DefaultRedisStreamMaxLen,
+		claimMinIdle: DefaultRedisStreamClaimMinIdle,
+		stream:       appID + ":events:stream",
+		group:        group,
+		consumer:     consumer,
+		pool:         pool,
+		exit:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+
+	conn := b.pool.Get()
+	err := b.createGroup(conn)
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	go b.receiveGlobal()
+
+	return b, nil
+}
+
+// PublishEvent publishes an event to all handlers capable of handling it.
+func (b *RedisStreamEventBus) PublishEvent(event Event) {
+	b.publishEventTraced(SpanContext{}, event)
+}
+
+// traced returns the bus, see isTraced.
+func (b *RedisStreamEventBus) traced() interface{} { return b }
+
+// publishEventTraced publishes an event with parent as the parent span of
+// its handlers, which is sent with the event to global handlers.
+func (b *RedisStreamEventBus) publishEventTraced(parent SpanContext, event Event) {
+	// Publish to local handlers.
+	b.dispatchEvent("redis_stream_event_bus", event, parent, b.handlers.handlers(event, localHandlers))
+
+	// Publish to global handlers.
+	b.publishGlobal(event, parent)
+}
+
+// AddHandler adds a handler for a specific local event.
+func (b *RedisStreamEventBus) AddHandler(handler EventHandler, event Event) {
+	b.handlers.addEvent(handler, event.EventType())
+}
+
+// AddLocalHandler adds a handler for local events.
+func (b *RedisStreamEventBus) AddLocalHandler(handler EventHandler) {
+	b.handlers.addLocal(handler)
+}
+
+// AddMatchingHandler adds a handler for the events matching a matcher. All
+// events are read from the stream, the matcher is applied when they are
+// received.
+func (b *RedisStreamEventBus) AddMatchingHandler(handler EventHandler, matcher EventMatcher) {
+	b.handlers.addMatching(handler, matcher)
+}
+
+// AddGlobalHandler adds a handler for global (remote) events.
+func (b *RedisStreamEventBus) AddGlobalHandler(handler EventHandler) {
+	b.handlers.addGlobal(handler)
+}
+
+// RegisterEventType registers an event factory for a event type. The factory is
+// used to create concrete event types when reading from the stream.
+//
+// An example would be:
+//
+//	eventBus.RegisterEventType(&MyEvent{}, func() Event { return &MyEvent{} })
+func (b *RedisStreamEventBus) RegisterEventType(event Event, factory func() Event) error {
+	b.factoriesLock.Lock()
+	defer b.factoriesLock.Unlock()
+	if _, ok := b.factories[event.EventType()]; ok {
+		return ErrHandlerAlreadySet
+	}
+
+	b.factories[event.EventType()] = factory
+
+	return nil
+}
+
+// SetMaxLen sets the approximate max number of entries kept in the stream.
+// A value of 0 disables trimming.
+func (b *RedisStreamEventBus) SetMaxLen(maxLen int) {
+	b.optionsLock.Lock()
+	defer b.optionsLock.Unlock()
+	b.maxLen = maxLen
+}
+
+// SetClaimMinIdle sets how long an entry must have been pending on another
+// consumer before this consumer claims it.
+func (b *RedisStreamEventBus) SetClaimMinIdle(minIdle time.Duration) {
+	b.optionsLock.Lock()
+	defer b.optionsLock.Unlock()
+	b.claimMinIdle = minIdle
+}
+
+// Close stops the receive goroutine. Events that have been read but not yet
+// handled are left pending for other consumers to claim.
+func (b *RedisStreamEventBus) Close() error {
+	close(b.exit)
+	<-b.done
+	return nil
+}
+
+// createGroup creates the consumer group, starting at new events only. The
+// group may already exist if other consumers have created it.
+func (b *RedisStreamEventBus) createGroup(conn redis.Conn) error {
+	_, err := conn.Do("XGROUP", "CREATE", b.stream, b.group, "$", "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+func (b *RedisStreamEventBus) publishGlobal(event Event, parent SpanContext) {
+	conn := b.pool.Get()
+	defer conn.Close()
+	if err := conn.Err(); err != nil {
+		b.logger().WithError(err).With(eventFields(event)).Errorf("Unable to publish event")
+		return
+	}
+
+	// Marshal event data.
+	data, err := bson.Marshal(event)
+	if err != nil {
+		b.logger().WithError(err).With(eventFields(event)).Errorf("Unable to marshal event")
+		return
+	}
+
+	b.optionsLock.RLock()
+	maxLen := b.maxLen
+	b.optionsLock.RUnlock()
+
+	args := []interface{}{b.stream}
+	if maxLen > 0 {
+		args = append(args, "MAXLEN", "~", maxLen)
+	}
+	args = append(args, "*", "type", event.EventType(), "data", data)
+	if parent.IsValid() {
+		args = append(args, "traceparent", traceparent(parent))
+	}
+	if _, err = conn.Do("XADD", args...); err != nil {
+		b.logger().WithError(err).With(eventFields(event)).Errorf("Unable to publish event")
+	}
+}
+
+func (b *RedisStreamEventBus) receiveGlobal() {
+	defer close(b.done)
+
+	conn := b.pool.Get()
+	defer func() { conn.Close() }()
+
+	// Start with entries that were delivered to this consumer before but
+	// never acknowledged, then continue with new entries.
+	id := "0"
+	var lastClaim time.Time
+	for {
+		select {
+		case <-b.exit:
+			return
+		default:
+		}
+
+		b.optionsLock.RLock()
+		minIdle := b.claimMinIdle
+		b.optionsLock.RUnlock()
+		if time.Since(lastClaim) >= minIdle {
+			b.claimPending(conn, minIdle)
+			lastClaim = time.Now()
+		}
+
+		reply, err := conn.Do("XREADGROUP", "GROUP", b.group, b.consumer,
+			"COUNT", redisStreamReadCount, "BLOCK", redisStreamBlock,
+			"STREAMS", b.stream, id)
+		if err != nil {
+			b.logger().WithError(err).Errorf("Unable to read events")
+			if conn.Err() != nil {
+				// The connection is broken, get a new one from the pool.
+				conn.Close()
+				conn = b.pool.Get()
+			} else if strings.HasPrefix(err.Error(), "NOGROUP") {
+				// The stream or group has been deleted, recreate it.
+				if err := b.createGroup(conn); err != nil {
+					b.logger().WithError(err).Errorf("Unable to create group")
+				}
+			}
+			select {
+			case <-b.exit:
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		entries, err := parseRedisStreamReply(reply)
+		if err != nil {
+			b.logger().WithError(err).Errorf("Unable to parse events")
+			continue
+		}
+
+		// When there are no more old pending entries, read new ones.
+		if id == "0" && len(entries) == 0 {
+			id = ">"
+		}
+
+		for _, entry := range entries {
+			b.handleEntry(conn, entry)
+		}
+	}
+}
+
+// claimPending claims entries that have been pending on other consumers for
+// longer than minIdle and handles them. The pending entries are read in pages
+// of redisStreamReadCount.
+func (b *RedisStreamEventBus) claimPending(conn redis.Conn, minIdle time.Duration) {
+	start := "-"
+	for {
+		pending, err := redis.Values(conn.Do("XPENDING", b.stream, b.group,
+			start, "+", redisStreamReadCount))
+		if err != nil {
+			b.logger().WithError(err).Errorf("Unable to get pending events")
+			return
+		}
+
+		ids := []interface{}{}
+		for _, p := range pending {
+			info, err := redis.Values(p, nil)
+			if err != nil || len(info) < 3 {
+				continue
+			}
+			id, _ := redis.String(info[0], nil)
+			consumer, _ := redis.String(info[1], nil)
+			idle, _ := redis.Int64(info[2], nil)
+			start = nextRedisStreamID(id)
+			if consumer == b.consumer ||
+				time.Duration(idle)*time.Millisecond < minIdle {
+				continue
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) > 0 {
+			b.claim(conn, minIdle, ids)
+		}
+		if len(pending) < redisStreamReadCount || start == "" {
+			return
+		}
+	}
+}
+
+// claim claims pending entries and handles them.
+func (b *RedisStreamEventBus) claim(conn redis.Conn, minIdle time.Duration, ids []interface{}) {
+	args := []interface{}{b.stream, b.group, b.consumer,
+		int64(minIdle / time.Millisecond)}
+	args = append(args, ids...)
+	reply, err := redis.Values(conn.Do("XCLAIM", args...))
+	if err != nil {
+		b.logger().WithError(err).Errorf("Unable to claim pending events")
+		return
+	}
+
+	entries, err := parseRedisStreamEntries(reply)
+	if err != nil {
+		b.logger().WithError(err).Errorf("Unable to parse claimed events")
+		return
+	}
+	for _, entry := range entries {
+		b.handleEntry(conn, entry)
+	}
+}
+
+// nextRedisStreamID returns the smallest entry ID after id, or "" if id is
+// not a valid entry ID.
+func nextRedisStreamID(id string) string {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return ""
+	}
+	if seq == math.MaxUint64 {
+		ms, err := strconv.ParseUint(parts[0], 10, 64)
+		if err != nil {
+			return ""
+		}
+		return strconv.FormatUint(ms+1, 10) + "-0"
+	}
+	return parts[0] + "-" + strconv.FormatUint(seq+1, 10)
+}
+
+// handleEntry decodes a stream entry, passes the event to the handlers and
+// acknowledges the entry. Entries that can not be decoded, or that have been
+// trimmed from the stream, are acknowledged as well as they would never be
+// possible to handle.
+func (b *RedisStreamEventBus) handleEntry(conn redis.Conn, entry redisStreamEntry) {
+	defer func() {
+		if _, err := conn.Do("XACK", b.stream, b.group, entry.id); err != nil {
+			b.logger().WithError(err).With(map[string]string{"entryID": entry.id}).Errorf("Unable to acknowledge event")
+		}
+	}()
+
+	if entry.fields == nil {
+		return
+	}
+
+	// Get the registered factory function for creating events.
+	b.factoriesLock.RLock()
+	f, ok := b.factories[string(entry.fields["type"])]
+	b.factoriesLock.RUnlock()
+	if !ok {
+		b.logger().With(map[string]string{"eventType": string(entry.fields["type"])}).Warnf("No factory for event type")
+		return
+	}
+
+	// Manually decode the raw BSON event.
+	data := bson.Raw{3, entry.fields["data"]}
+	event := f()
+	if err := data.Unmarshal(event); err != nil {
+		b.logger().WithError(err).With(map[string]string{"eventType": string(entry.fields["type"])}).Errorf("Unable to unmarshal received event")
+		return
+	}
+
+	handlers := b.handlers.handlers(event,
+		eventTypeHandlers|matchingHandlers|globalHandlers)
+	b.dispatchEvent("redis_stream_event_bus", event,
+		parseTraceparent(string(entry.fields["traceparent"])), handlers)
+}
+
+// redisStreamEntry is a single entry read from a Redis stream.
+type redisStreamEntry struct {
+	id     string
+	fields map[string][]byte
+}
+
+// parseRedisStreamReply parses the reply of XREAD/XREADGROUP for one stream.
+func parseRedisStreamReply(reply interface{}) ([]redisStreamEntry, error) {
+	if reply == nil {
+		// Timeout without any new entries.
+		return nil, nil
+	}
+
+	streams, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []redisStreamEntry
+	for _, s := range streams {
+		stream, err := redis.Values(s, nil)
+		if err != nil || len(stream) != 2 {
+			return nil, ErrCouldNotUnmarshalEvent
+		}
+		values, err := redis.Values(stream[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		streamEntries, err := parseRedisStreamEntries(values)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, streamEntries...)
+	}
+	return entries, nil
+}
+
+// parseRedisStreamEntries parses a list of stream entries, as returned by
+// XRANGE and XCLAIM and as part of the XREADGROUP reply.
+func parseRedisStreamEntries(values []interface{}) ([]redisStreamEntry, error) {
+	entries := make([]redisStreamEntry, 0, len(values))
+	for _, v := range values {
+		entry, err := redis.Values(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) != 2 {
+			return nil, ErrCouldNotUnmarshalEvent
+		}
+
+		id, err := redis.String(entry[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		if entry[1] == nil {
+			// Entries deleted by trimming have no fields.
+			entries = append(entries, redisStreamEntry{id: id})
+			continue
+		}
+		fields, err := redis.ByteSlices(entry[1], nil)
+		if err != nil {
+			return nil, err
+		}
+
+		e := redisStreamEntry{
+			id:     id,
+			fields: make(map[string][]byte, len(fields)/2),
+		}
+		for i := 0; i+1 < len(fields); i += 2 {
+			e.fields[string(fields[i])] = fields[i+1]
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
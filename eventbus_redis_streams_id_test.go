@@ -0,0 +1,13 @@
+package eventhorizon
+
+import . "gopkg.in/check.v1"
+
+var _ = Suite(&RedisStreamIDSuite{})
+
+type RedisStreamIDSuite struct{}
+
+func (s *RedisStreamIDSuite) Test_NextRedisStreamID(c *C) {
+	c.Assert(nextRedisStreamID("1526919030474-55"), Equals, "1526919030474-56")
+	c.Assert(nextRedisStreamID("1526919030474-18446744073709551615"), Equals, "1526919030475-0")
+	c.Assert(nextRedisStreamID("invalid"), Equals, "")
+}
@@ -0,0 +1,125 @@
+// +build redis
+
+package eventhorizon
+
+import (
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/odeke-em/go-uuid"
+	"gopkg.in/mgo.v2/bson"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&RedisStreamEventBusSuite{})
+
+type RedisStreamEventBusSuite struct {
+	RedisEventBusSuite
+	pool *redis.Pool
+}
+
+func (s *RedisStreamEventBusSuite) SetUpTest(c *C) {
+	s.pool = &redis.Pool{
+		Dial: func() (redis.Conn, error) { return redis.Dial("tcp", s.url) },
+	}
+	conn := s.pool.Get()
+	_, err := conn.Do("DEL", "test:events:stream")
+	conn.Close()
+	c.Assert(err, IsNil)
+
+	// The buses use different groups, so that both receive all events.
+	s.bus, err = NewRedisStreamEventBusWithPool("test", "group1", "consumer", s.pool)
+	c.Assert(s.bus, NotNil)
+	c.Assert(err, IsNil)
+	err = s.bus.RegisterEventType(&TestEvent{}, func() Event { return &TestEvent{} })
+	c.Assert(err, IsNil)
+
+	s.bus2, err = NewRedisStreamEventBusWithPool("test", "group2", "consumer", s.pool)
+	c.Assert(s.bus2, NotNil)
+	c.Assert(err, IsNil)
+	err = s.bus2.RegisterEventType(&TestEvent{}, func() Event { return &TestEvent{} })
+	c.Assert(err, IsNil)
+
+	s.EventBusSuite.Bus = s.bus
+	s.EventBusSuite.Bus2 = s.bus2
+}
+
+func (s *RedisStreamEventBusSuite) TearDownTest(c *C) {
+	s.bus.Close()
+	s.bus2.Close()
+	s.pool.Close()
+}
+
+func (s *RedisStreamEventBusSuite) Test_NewHandlerEventBus(c *C) {
+	bus, err := NewRedisStreamEventBus("test", "group", "consumer", s.url, "")
+	c.Assert(err, IsNil)
+	c.Assert(bus, NotNil)
+	bus.Close()
+}
+
+func (s *RedisStreamEventBusSuite) Test_SameGroup_HandledOnce(c *C) {
+	bus, err := NewRedisStreamEventBusWithPool("test", "group1", "consumer2", s.pool)
+	c.Assert(err, IsNil)
+	defer bus.Close()
+	err = bus.RegisterEventType(&TestEvent{}, func() Event { return &TestEvent{} })
+	c.Assert(err, IsNil)
+
+	handler1 := NewMockEventHandler()
+	s.bus.AddGlobalHandler(handler1)
+	handler2 := NewMockEventHandler()
+	bus.AddGlobalHandler(handler2)
+
+	event1 := &TestEvent{uuid.New(), "event1"}
+	s.bus2.PublishEvent(event1)
+	select {
+	case <-handler1.recv:
+	case <-handler2.recv:
+	}
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(len(handler1.events)+len(handler2.events), Equals, 1)
+}
+
+func (s *RedisStreamEventBusSuite) Test_ClaimPending(c *C) {
+	// Read events as a consumer that crashes before acknowledging them. The
+	// group is only used by this test, so that the buses of the suite do
+	// not read the events first. There are more events than are claimed at
+	// a time.
+	conn := s.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("XGROUP", "CREATE", "test:events:stream", "claim", "$", "MKSTREAM")
+	c.Assert(err, IsNil)
+	var events []Event
+	for i := 0; i < redisStreamReadCount+5; i++ {
+		event := &TestEvent{uuid.New(), "event"}
+		data, err := bson.Marshal(event)
+		c.Assert(err, IsNil)
+		_, err = conn.Do("XADD", "test:events:stream", "*", "type", event.EventType(), "data", data)
+		c.Assert(err, IsNil)
+		events = append(events, event)
+	}
+	_, err = conn.Do("XREADGROUP", "GROUP", "claim", "crashed",
+		"STREAMS", "test:events:stream", ">")
+	c.Assert(err, IsNil)
+
+	bus, err := NewRedisStreamEventBusWithPool("test", "claim", "consumer2", s.pool)
+	c.Assert(err, IsNil)
+	defer bus.Close()
+	bus.SetClaimMinIdle(10 * time.Millisecond)
+	err = bus.RegisterEventType(&TestEvent{}, func() Event { return &TestEvent{} })
+	c.Assert(err, IsNil)
+	handler := NewMockEventHandler()
+	bus.AddGlobalHandler(handler)
+
+	for range events {
+		select {
+		case <-handler.recv:
+		case <-time.After(5 * time.Second):
+			c.Fatal("pending event was not claimed")
+		}
+	}
+	c.Assert(handler.events, DeepEquals, events)
+
+	pending, err := redis.Values(conn.Do("XPENDING", "test:events:stream", "claim"))
+	c.Assert(err, IsNil)
+	c.Assert(pending[0], Equals, int64(0))
+}
@@ -18,8 +18,11 @@ package eventhorizon
 
 import (
 	"os"
+	"time"
 
+	"github.com/odeke-em/go-uuid"
 	. "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
 )
 
 var _ = Suite(&RedisEventBusSuite{})
@@ -31,7 +34,7 @@ type RedisEventBusSuite struct {
 	bus2 RemoteEventBus
 }
 
-func (s *RedisEventBusSuite) SetUpSuite(c *C) {
+func redisURL() string {
 	// Support Wercker testing with Redis.
 	host := os.Getenv("REDIS_PORT_6379_TCP_ADDR")
 	if host == "" {
@@ -43,11 +46,15 @@ func (s *RedisEventBusSuite) SetUpSuite(c *C) {
 	}
 
 	if host != "" && port != "" {
-		s.url = host + ":" + port
-	} else {
-		s.url = ":6379"
+		return host + ":" + port
 	}
+	return ":6379"
 }
+
+func (s *RedisEventBusSuite) SetUpSuite(c *C) {
+	s.url = redisURL()
+}
+
 func (s *RedisEventBusSuite) SetUpTest(c *C) {
 	var err error
 	s.bus, err = NewRedisEventBus("test", s.url, "")
@@ -77,3 +84,56 @@ func (s *RedisEventBusSuite) Test_NewHandlerEventBus(c *C) {
 	c.Assert(bus, NotNil)
 	bus.Close()
 }
+
+// addingEventHandler adds a handler to a bus when it handles an event.
+type addingEventHandler struct {
+	bus     EventBus
+	handler EventHandler
+	added   chan struct{}
+}
+
+func (h *addingEventHandler) HandleEvent(event Event) {
+	h.bus.AddHandler(h.handler, &TestEventOther{})
+	close(h.added)
+}
+
+func (s *RedisEventBusSuite) Test_AddHandlerInHandler(c *C) {
+	handler := NewMockEventHandler()
+	adding := &addingEventHandler{s.bus, handler, make(chan struct{})}
+	s.bus.AddGlobalHandler(adding)
+
+	s.bus2.PublishEvent(&TestEvent{"1", "event1"})
+	select {
+	case <-adding.added:
+	case <-time.After(5 * time.Second):
+		c.Fatal("handler could not add a handler")
+	}
+}
+
+func (s *RedisEventBusSuite) Test_LegacyChannel(c *C) {
+	handler := NewMockEventHandler()
+	s.bus.AddHandler(handler, &TestEvent{})
+	globalHandler := NewMockEventHandler()
+	s.bus.AddGlobalHandler(globalHandler)
+
+	// Earlier versions publish on a channel of the event type only.
+	conn := newRedisPool(s.url, "").Get()
+	defer conn.Close()
+	event1 := &TestEvent{uuid.New(), "legacy"}
+	data, err := bson.Marshal(event1)
+	c.Assert(err, IsNil)
+	_, err = conn.Do("PUBLISH", "test:events:"+event1.EventType(), data)
+	c.Assert(err, IsNil)
+	event2 := &TestEvent{uuid.New(), "event2"}
+	s.bus2.PublishEvent(event2)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-globalHandler.recv:
+		case <-time.After(5 * time.Second):
+			c.Fatal("events not received")
+		}
+	}
+	c.Assert(handler.events, DeepEquals, []Event{event1, event2})
+	c.Assert(globalHandler.events, DeepEquals, []Event{event1, event2})
+}
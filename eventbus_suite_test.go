@@ -1,6 +1,9 @@
 package eventhorizon
 
 import (
+	"sync"
+	"time"
+
 	"github.com/odeke-em/go-uuid"
 	. "gopkg.in/check.v1"
 )
@@ -87,3 +90,89 @@ func (s *EventBusSuite) Test_PublishEvent_NoLocalOrGlobalHandler(c *C) {
 	c.Assert(handler.events, HasLen, 1)
 	c.Assert(handler.events[0], DeepEquals, event1)
 }
+
+func (s *EventBusSuite) Test_HandlerOrder(c *C) {
+	var order []string
+	var lock sync.Mutex
+	recv := make(chan struct{}, 10)
+	handler := func(name string) *orderEventHandler {
+		return &orderEventHandler{name: name, order: &order, lock: &lock, recv: recv}
+	}
+
+	s.Bus.AddHandler(handler("event b"), &TestEvent{})
+	s.Bus.AddHandler(handler("event a"), &TestEvent{})
+	s.Bus.AddGlobalHandler(handler("global b"))
+	s.Bus.AddGlobalHandler(WithPriority(handler("global a"), 1))
+
+	event1 := &TestEvent{uuid.New(), "event1"}
+	s.Bus.PublishEvent(event1)
+	for i := 0; i < 4; i++ {
+		<-recv
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	c.Assert(order, DeepEquals, []string{"global a", "event b", "event a", "global b"})
+}
+
+func (s *EventBusSuite) Test_MatchingHandler(c *C) {
+	bus, ok := s.Bus.(MatchingEventBus)
+	c.Assert(ok, Equals, true)
+
+	var order []string
+	var lock sync.Mutex
+	recv := make(chan struct{}, 10)
+	handler := func(name string) *orderEventHandler {
+		return &orderEventHandler{name: name, order: &order, lock: &lock, recv: recv}
+	}
+
+	bus.AddMatchingHandler(handler("pattern"), MatchEventType("Test*"))
+	bus.AddMatchingHandler(handler("other pattern"), MatchEventType("Invite*"))
+	bus.AddMatchingHandler(handler("aggregate"), MatchAggregateType("Test"))
+	bus.AddMatchingHandler(handler("other aggregate"), MatchAggregateType("Invite"))
+	bus.AddMatchingHandler(handler("func"), MatchFunc(func(event Event) bool {
+		return event.(*TestEvent).Content == "event2"
+	}))
+	bus.AddGlobalHandler(WithPriority(handler("global"), -1))
+
+	event1 := &TestEvent{uuid.New(), "event1"}
+	bus.PublishEvent(event1)
+	event2 := &TestEvent{uuid.New(), "event2"}
+	s.Bus2.PublishEvent(event2)
+	for i := 0; i < 7; i++ {
+		<-recv
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	c.Assert(order, DeepEquals, []string{
+		"pattern", "aggregate", "global",
+		"pattern", "aggregate", "func", "global",
+	})
+}
+
+func (s *EventBusSuite) Test_Tracing(c *C) {
+	tracer := NewMemoryTracer()
+	s.Bus2.(interface {
+		SetTracer(Tracer)
+	}).SetTracer(tracer)
+	globalHandler := NewMockEventHandler()
+	defer globalHandler.Close()
+	s.Bus2.AddGlobalHandler(globalHandler)
+
+	// The span context of the publisher is sent with the event, through a
+	// bus without a tracer.
+	event1 := &TestEvent{uuid.New(), "event1"}
+	parent := SpanContext{"0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"}
+	publishEvent(s.Bus, parent, event1)
+	<-globalHandler.recv
+
+	var spans []SpanData
+	for i := 0; i < 100 && len(spans) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		spans = tracer.Spans()
+	}
+	c.Assert(spans, HasLen, 1)
+	c.Assert(spans[0].Name, Equals, "handle_event")
+	c.Assert(spans[0].Parent, Equals, parent)
+	c.Assert(spans[0].Context.TraceID, Equals, parent.TraceID)
+	c.Assert(spans[0].Attributes["aggregateID"], Equals, event1.AggregateID())
+}
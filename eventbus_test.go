@@ -15,6 +15,10 @@
 package eventhorizon
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/odeke-em/go-uuid"
 	. "gopkg.in/check.v1"
 )
@@ -80,3 +84,257 @@ func (s *InternalEventBusSuite) Test_PublishEvent_NoLocalOrGlobalHandler(c *C) {
 	s.bus.PublishEvent(event1)
 	c.Assert(handler.events[0], Equals, event1)
 }
+
+func (s *InternalEventBusSuite) Test_RemoveHandler(c *C) {
+	handler := NewMockEventHandler()
+	localHandler := NewMockEventHandler()
+	globalHandler := NewMockEventHandler()
+	s.bus.AddHandler(handler, &TestEvent{})
+	s.bus.AddLocalHandler(localHandler)
+	s.bus.AddGlobalHandler(globalHandler)
+	s.bus.RemoveHandler(handler, &TestEvent{})
+	s.bus.RemoveLocalHandler(localHandler)
+	s.bus.RemoveGlobalHandler(globalHandler)
+
+	// Removing handlers that are not added does nothing.
+	s.bus.RemoveHandler(handler, &TestEventOther{})
+	s.bus.RemoveLocalHandler(handler)
+
+	event1 := &TestEvent{uuid.New(), "event1"}
+	s.bus.PublishEvent(event1)
+	c.Assert(handler.events, HasLen, 0)
+	c.Assert(localHandler.events, HasLen, 0)
+	c.Assert(globalHandler.events, HasLen, 0)
+}
+
+// lockedEventHandler is a handler that can be used concurrently.
+type lockedEventHandler struct {
+	events []Event
+	lock   sync.Mutex
+	wg     *sync.WaitGroup
+}
+
+func (h *lockedEventHandler) HandleEvent(event Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.events = append(h.events, event)
+	if h.wg != nil {
+		h.wg.Done()
+	}
+}
+
+func (s *InternalEventBusSuite) Test_Concurrent(c *C) {
+	// Run with the race detector to find unsafe access.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler := &lockedEventHandler{}
+			s.bus.AddHandler(handler, &TestEvent{})
+			s.bus.AddLocalHandler(handler)
+			s.bus.PublishEvent(&TestEvent{uuid.New(), "event"})
+			s.bus.RemoveHandler(handler, &TestEvent{})
+			s.bus.RemoveLocalHandler(handler)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *InternalEventBusSuite) Test_Async(c *C) {
+	bus, err := NewAsyncInternalEventBus(4, 10)
+	c.Assert(err, IsNil)
+	var wg sync.WaitGroup
+	handler := &lockedEventHandler{wg: &wg}
+	bus.AddHandler(handler, &TestEvent{})
+	bus.AddGlobalHandler(handler)
+
+	// Events of the same aggregate are handled in order.
+	var events []Event
+	id := uuid.New()
+	for i := 0; i < 20; i++ {
+		event := &TestEvent{id, "event"}
+		events = append(events, event, event)
+		wg.Add(2)
+		bus.PublishEvent(event)
+	}
+	wg.Wait()
+	handler.lock.Lock()
+	c.Assert(handler.events, DeepEquals, events)
+	handler.lock.Unlock()
+
+	c.Assert(bus.Close(), IsNil)
+	c.Assert(bus.Close(), IsNil)
+
+	// Events published after closing are dropped.
+	bus.PublishEvent(&TestEvent{id, "event"})
+	c.Assert(handler.events, HasLen, len(events))
+}
+
+func (s *InternalEventBusSuite) Test_Async_Close(c *C) {
+	bus, err := NewAsyncInternalEventBus(2, 100)
+	c.Assert(err, IsNil)
+	handler := &lockedEventHandler{}
+	bus.AddLocalHandler(handler)
+	for i := 0; i < 50; i++ {
+		bus.PublishEvent(&TestEvent{uuid.New(), "event"})
+	}
+
+	// Closing waits for the queued events to be handled.
+	c.Assert(bus.Close(), IsNil)
+	c.Assert(handler.events, HasLen, 50)
+}
+
+// republishingEventHandler publishes three other events for every TestEvent,
+// and records all events.
+type republishingEventHandler struct {
+	bus    EventBus
+	events []string
+	lock   sync.Mutex
+	wg     *sync.WaitGroup
+}
+
+func (h *republishingEventHandler) HandleEvent(event Event) {
+	if e, ok := event.(*TestEvent); ok {
+		for i := 1; i <= 3; i++ {
+			h.bus.PublishEvent(&TestEventOther{e.TestID, fmt.Sprintf("other%d", i)})
+		}
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	switch e := event.(type) {
+	case *TestEvent:
+		h.events = append(h.events, e.Content)
+	case *TestEventOther:
+		h.events = append(h.events, e.Content)
+	}
+	h.wg.Done()
+}
+
+func (s *InternalEventBusSuite) Test_Async_RepublishFullQueue(c *C) {
+	bus, err := NewAsyncInternalEventBus(1, 1)
+	c.Assert(err, IsNil)
+	defer bus.Close()
+	var wg sync.WaitGroup
+	handler := &republishingEventHandler{bus: bus, wg: &wg}
+	bus.AddLocalHandler(handler)
+
+	// The events that the handler publishes to its own full queue are handled
+	// in order.
+	wg.Add(4)
+	bus.PublishEvent(&TestEvent{uuid.New(), "event"})
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		c.Fatal("handling the events timed out")
+	}
+	handler.lock.Lock()
+	defer handler.lock.Unlock()
+	c.Assert(handler.events, DeepEquals, []string{"event", "other1", "other2", "other3"})
+}
+
+func (s *InternalEventBusSuite) Test_Async_InvalidWorkers(c *C) {
+	bus, err := NewAsyncInternalEventBus(0, 10)
+	c.Assert(err, Equals, ErrInvalidWorkerCount)
+	c.Assert(bus, IsNil)
+	bus, err = NewAsyncInternalEventBus(1, 0)
+	c.Assert(err, Equals, ErrInvalidQueueSize)
+	c.Assert(bus, IsNil)
+}
+
+// orderEventHandler records the order in which handlers handle events.
+type orderEventHandler struct {
+	name  string
+	order *[]string
+	lock  *sync.Mutex
+	recv  chan struct{}
+}
+
+func (h *orderEventHandler) HandleEvent(event Event) {
+	h.lock.Lock()
+	*h.order = append(*h.order, h.name)
+	h.lock.Unlock()
+	if h.recv != nil {
+		h.recv <- struct{}{}
+	}
+}
+
+func (s *InternalEventBusSuite) Test_HandlerOrder(c *C) {
+	var order []string
+	var lock sync.Mutex
+	handler := func(name string) *orderEventHandler {
+		return &orderEventHandler{name: name, order: &order, lock: &lock}
+	}
+
+	// Handlers are called in the order they were added, by kind.
+	for _, name := range []string{"e", "d", "c", "b", "a"} {
+		s.bus.AddHandler(handler("event "+name), &TestEvent{})
+		s.bus.AddGlobalHandler(handler("global " + name))
+		s.bus.AddLocalHandler(handler("local " + name))
+	}
+	for i := 0; i < 10; i++ {
+		order = nil
+		s.bus.PublishEvent(&TestEvent{uuid.New(), "event"})
+		c.Assert(order, DeepEquals, []string{
+			"event e", "event d", "event c", "event b", "event a",
+			"local e", "local d", "local c", "local b", "local a",
+			"global e", "global d", "global c", "global b", "global a",
+		})
+	}
+}
+
+func (s *InternalEventBusSuite) Test_HandlerPriority(c *C) {
+	var order []string
+	var lock sync.Mutex
+	handler := func(name string) *orderEventHandler {
+		return &orderEventHandler{name: name, order: &order, lock: &lock}
+	}
+
+	notifier := handler("notifier")
+	projector := WithPriority(handler("projector"), 10)
+	s.bus.AddHandler(notifier, &TestEvent{})
+	s.bus.AddGlobalHandler(WithPriority(handler("logger"), -1))
+	s.bus.AddGlobalHandler(projector)
+	s.bus.AddLocalHandler(handler("local"))
+	s.bus.PublishEvent(&TestEvent{uuid.New(), "event"})
+	c.Assert(order, DeepEquals, []string{"projector", "notifier", "local", "logger"})
+
+	// Handlers with a priority are removed with the same priority.
+	s.bus.RemoveGlobalHandler(projector)
+	order = nil
+	s.bus.PublishEvent(&TestEvent{uuid.New(), "event"})
+	c.Assert(order, DeepEquals, []string{"notifier", "local", "logger"})
+}
+
+func (s *InternalEventBusSuite) Test_MatchingHandler(c *C) {
+	var order []string
+	var lock sync.Mutex
+	handler := func(name string) *orderEventHandler {
+		return &orderEventHandler{name: name, order: &order, lock: &lock}
+	}
+
+	pattern := handler("pattern")
+	s.bus.AddMatchingHandler(pattern, MatchEventType("*Other"))
+	s.bus.AddMatchingHandler(pattern, MatchAggregateType("Test"))
+	s.bus.AddMatchingHandler(handler("func"), MatchFunc(func(event Event) bool {
+		return event.EventType() == "TestEvent"
+	}))
+	s.bus.AddHandler(handler("event"), &TestEvent{})
+
+	// Handlers with several matching matchers are called once.
+	s.bus.PublishEvent(&TestEvent{uuid.New(), "event"})
+	c.Assert(order, DeepEquals, []string{"event", "pattern", "func"})
+	order = nil
+	s.bus.PublishEvent(&TestEventOther{uuid.New(), "event"})
+	c.Assert(order, DeepEquals, []string{"pattern"})
+
+	s.bus.RemoveMatchingHandler(pattern)
+	order = nil
+	s.bus.PublishEvent(&TestEventOther{uuid.New(), "event"})
+	c.Assert(order, HasLen, 0)
+}
@@ -15,6 +15,7 @@
 package eventhorizon
 
 import (
+	"sync"
 	"testing"
 
 	. "gopkg.in/check.v1"
@@ -59,6 +60,16 @@ func (t *TestEventOther) AggregateID() string   { return t.TestID }
 func (t *TestEventOther) AggregateType() string { return "Test" }
 func (t *TestEventOther) EventType() string     { return "TestEventOther" }
 
+type TestEncryptedEvent struct {
+	TestID  string
+	Content string `eh:"encrypt"`
+	Data    []byte `eh:"encrypt"`
+}
+
+func (t *TestEncryptedEvent) AggregateID() string   { return t.TestID }
+func (t *TestEncryptedEvent) AggregateType() string { return "Test" }
+func (t *TestEncryptedEvent) EventType() string     { return "TestEncryptedEvent" }
+
 type TestCommand struct {
 	TestID  string
 	Content string
@@ -146,9 +157,12 @@ func (m *MockEventStore) Close() error {
 
 type MockEventBus struct {
 	events []Event
+	mu     sync.Mutex
 }
 
 func (m *MockEventBus) PublishEvent(event Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.events = append(m.events, event)
 }
 
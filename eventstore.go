@@ -25,6 +25,10 @@ var ErrNoEventsFound = errors.New("could not find events")
 // ErrNoEventStoreDefined returned if no event store has been defined.
 var ErrNoEventStoreDefined = errors.New("no event store defined")
 
+// ErrEventStoreNotVersioned returned by a VersionedEventStore that passes
+// calls on to an event store which is not versioned, see EventStoreDecorator.
+var ErrEventStoreNotVersioned = errors.New("event store is not versioned")
+
 // EventStore is an interface for an event sourcing event store.
 type EventStore interface {
 	// Save appends all events in the event stream to the store.
@@ -34,6 +38,16 @@ type EventStore interface {
 	Load(string) ([]Event, error)
 }
 
+// VersionedEventStore is an EventStore that can return the version of an
+// aggregate without loading its events.
+type VersionedEventStore interface {
+	EventStore
+
+	// AggregateVersion returns the version of the aggregate id, which is its
+	// number of events, or 0 if it has none.
+	AggregateVersion(string) (int, error)
+}
+
 // AggregateRecord is a stored record of an aggregate in form of its events.
 type AggregateRecord interface {
 	AggregateID() string
@@ -0,0 +1,99 @@
+package eventhorizon
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrInvalidCacheSize returned when a cache is created with a size less than
+// one.
+var ErrInvalidCacheSize = errors.New("invalid cache size")
+
+// CachingEventStore is an EventStore decorator that caches the events of the
+// most recently loaded aggregates. Saving events for an aggregate removes it
+// from the cache, so it must be the only writer of the decorated store. Loaded
+// events are copies, which can be changed without changing the cache. It is
+// safe for concurrent use.
+type CachingEventStore struct {
+	eventStoreDecorator
+
+	cache *lruCache
+	// generation is incremented by every save, loads that were started
+	// before a save are not cached.
+	generation uint64
+	lock       sync.Mutex
+}
+
+// NewCachingEventStore creates a new CachingEventStore that decorates an
+// event store and caches the events of up to size aggregates.
+func NewCachingEventStore(eventStore EventStore, size int) (*CachingEventStore, error) {
+	if size < 1 {
+		return nil, ErrInvalidCacheSize
+	}
+	s := &CachingEventStore{
+		eventStoreDecorator: eventStoreDecorator{eventStore},
+		cache:               newLRUCache(size),
+	}
+	return s, nil
+}
+
+// Save appends all events to the decorated store and removes their
+// aggregates from the cache.
+func (s *CachingEventStore) Save(events []Event) error {
+	return s.saveTraced(SpanContext{}, events)
+}
+
+// traced returns the store, see isTraced.
+func (s *CachingEventStore) traced() interface{} { return s }
+
+// saveTraced saves events as a child of parent.
+func (s *CachingEventStore) saveTraced(parent SpanContext, events []Event) error {
+	err := s.save(parent, events)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.generation++
+	for _, event := range events {
+		s.cache.remove(event.AggregateID())
+	}
+
+	return err
+}
+
+// Load loads all events for the aggregate id from the cache, or from the
+// decorated store if they are not cached.
+func (s *CachingEventStore) Load(id string) ([]Event, error) {
+	return s.loadTraced(SpanContext{}, id)
+}
+
+// loadTraced loads events as a child of parent, if they are not cached.
+func (s *CachingEventStore) loadTraced(parent SpanContext, id string) ([]Event, error) {
+	s.lock.Lock()
+	cached, ok := s.cache.get(id)
+	generation := s.generation
+	s.lock.Unlock()
+	if ok {
+		return copyEvents(cached.([]Event)), nil
+	}
+
+	events, err := s.load(parent, id)
+	if err != nil {
+		return events, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.generation == generation {
+		s.cache.add(id, copyEvents(events))
+	}
+	return events, nil
+}
+
+// copyEvents returns deep copies of events, see copyModel.
+func copyEvents(events []Event) []Event {
+	c := make([]Event, len(events))
+	for i, event := range events {
+		c[i] = copyModel(event).(Event)
+	}
+	return c
+}
@@ -0,0 +1,107 @@
+package eventhorizon
+
+import (
+	"github.com/odeke-em/go-uuid"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&CachingEventStoreSuite{})
+
+type CachingEventStoreSuite struct {
+	EventStoreSuite
+}
+
+func (s *CachingEventStoreSuite) SetUpTest(c *C) {
+	store, err := NewCachingEventStore(NewMemoryEventStore(nil), 2)
+	c.Assert(err, IsNil)
+	s.Store = store
+}
+
+// countingEventStore counts the loads of each aggregate.
+type countingEventStore struct {
+	EventStore
+	loads map[string]int
+}
+
+func (s *countingEventStore) Load(id string) ([]Event, error) {
+	s.loads[id]++
+	return s.EventStore.Load(id)
+}
+
+func (s *CachingEventStoreSuite) TestNewCachingEventStore(c *C) {
+	store, err := NewCachingEventStore(NewMemoryEventStore(nil), 0)
+	c.Assert(err, Equals, ErrInvalidCacheSize)
+	c.Assert(store, IsNil)
+}
+
+func (s *CachingEventStoreSuite) TestCache(c *C) {
+	base := &countingEventStore{NewMemoryEventStore(nil), map[string]int{}}
+	store, _ := NewCachingEventStore(base, 2)
+
+	event1 := &TestEvent{uuid.New(), "event1"}
+	event2 := &TestEvent{uuid.New(), "event2"}
+	event3 := &TestEvent{uuid.New(), "event3"}
+	err := store.Save([]Event{event1, event2, event3})
+	c.Assert(err, IsNil)
+
+	// Loaded aggregates are cached.
+	for i := 0; i < 2; i++ {
+		events, err := store.Load(event1.TestID)
+		c.Assert(err, IsNil)
+		c.Assert(events, DeepEquals, []Event{event1})
+	}
+	c.Assert(base.loads[event1.TestID], Equals, 1)
+
+	// The cached events can not be changed by the caller.
+	events, _ := store.Load(event1.TestID)
+	events[0] = event2
+	events, _ = store.Load(event1.TestID)
+	c.Assert(events, DeepEquals, []Event{event1})
+	events[0].(*TestEvent).Content = "changed"
+	events, _ = store.Load(event1.TestID)
+	c.Assert(events, DeepEquals, []Event{&TestEvent{event1.TestID, "event1"}})
+
+	// Aggregates without events are not cached.
+	id := uuid.New()
+	_, err = store.Load(id)
+	c.Assert(err, Equals, ErrNoEventsFound)
+	_, err = store.Load(id)
+	c.Assert(err, Equals, ErrNoEventsFound)
+	c.Assert(base.loads[id], Equals, 2)
+
+	// The least recently used aggregate is removed from a full cache.
+	store.Load(event2.TestID)
+	store.Load(event3.TestID)
+	store.Load(event1.TestID)
+	c.Assert(base.loads[event1.TestID], Equals, 2)
+	store.Load(event3.TestID)
+	c.Assert(base.loads[event3.TestID], Equals, 1)
+
+	// Saving removes the aggregate from the cache.
+	event4 := &TestEvent{event3.TestID, "event4"}
+	err = store.Save([]Event{event4})
+	c.Assert(err, IsNil)
+	events, err = store.Load(event3.TestID)
+	c.Assert(err, IsNil)
+	c.Assert(events, DeepEquals, []Event{event3, event4})
+	c.Assert(base.loads[event3.TestID], Equals, 2)
+}
+
+func (s *CachingEventStoreSuite) TestLRUCache(c *C) {
+	cache := newLRUCache(2)
+	cache.add("a", 1)
+	cache.add("b", 2)
+	v, ok := cache.get("a")
+	c.Assert(ok, Equals, true)
+	c.Assert(v, Equals, 1)
+	cache.add("c", 3)
+	_, ok = cache.get("b")
+	c.Assert(ok, Equals, false)
+	cache.add("a", 4)
+	v, _ = cache.get("a")
+	c.Assert(v, Equals, 4)
+	c.Assert(cache.len(), Equals, 2)
+	cache.remove("a")
+	cache.remove("x")
+	c.Assert(cache.len(), Equals, 1)
+}
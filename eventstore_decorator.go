@@ -0,0 +1,82 @@
+package eventhorizon
+
+// EventStoreDecorator is an EventStore that adds behaviour to another
+// EventStore, which it passes the calls on to. Decorators can be stacked
+// around any event store, see DecorateEventStore. Decorators that change the
+// saved events, like the EncryptingEventStore, must decorate a store without
+// an event bus and be below a PublishingEventStore, or the changed events are
+// published.
+type EventStoreDecorator interface {
+	EventStore
+
+	// Decorate sets the event store that the decorator passes calls on to.
+	// It must be called before the decorator is used.
+	Decorate(EventStore)
+}
+
+// DecorateEventStore stacks decorators around an event store, the first
+// decorator is the outermost one. It returns the outermost event store.
+//
+// An example would be:
+//     cache, _ := NewCachingEventStore(nil, 1000)
+//     trace := NewTraceEventStore(nil)
+//     store := DecorateEventStore(mongoStore, trace, cache)
+// where trace records the events saved to cache, which saves them to
+// mongoStore.
+func DecorateEventStore(eventStore EventStore, decorators ...EventStoreDecorator) EventStore {
+	for i := len(decorators) - 1; i >= 0; i-- {
+		decorators[i].Decorate(eventStore)
+		eventStore = decorators[i]
+	}
+	return eventStore
+}
+
+// eventStoreDecorator holds the decorated event store of a decorator. It is
+// embedded to add a Decorate method.
+type eventStoreDecorator struct {
+	eventStore EventStore
+}
+
+// Decorate implements the Decorate method of the EventStoreDecorator
+// interface.
+func (d *eventStoreDecorator) Decorate(eventStore EventStore) {
+	d.eventStore = eventStore
+}
+
+// save saves events to the decorated store, as a child of parent. Returns
+// ErrNoEventStoreDefined if there is none.
+func (d *eventStoreDecorator) save(parent SpanContext, events []Event) error {
+	if d.eventStore == nil {
+		return ErrNoEventStoreDefined
+	}
+	return saveEvents(d.eventStore, parent, events)
+}
+
+// load loads events from the decorated store, as a child of parent. Returns
+// ErrNoEventStoreDefined if there is none.
+func (d *eventStoreDecorator) load(parent SpanContext, id string) ([]Event, error) {
+	if d.eventStore == nil {
+		return nil, ErrNoEventStoreDefined
+	}
+	return loadEvents(d.eventStore, parent, id)
+}
+
+// AggregateVersion implements the AggregateVersion method of the
+// VersionedEventStore interface by passing it on to the decorated event
+// store. Returns ErrEventStoreNotVersioned if it is not a VersionedEventStore.
+func (d *eventStoreDecorator) AggregateVersion(id string) (int, error) {
+	return d.aggregateVersionTraced(SpanContext{}, id)
+}
+
+// aggregateVersionTraced loads the version from the decorated event store,
+// as a child of parent.
+func (d *eventStoreDecorator) aggregateVersionTraced(parent SpanContext, id string) (int, error) {
+	if d.eventStore == nil {
+		return 0, ErrNoEventStoreDefined
+	}
+	store, ok := d.eventStore.(VersionedEventStore)
+	if !ok {
+		return 0, ErrEventStoreNotVersioned
+	}
+	return aggregateVersion(store, parent, id)
+}
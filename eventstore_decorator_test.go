@@ -0,0 +1,95 @@
+package eventhorizon
+
+import (
+	"github.com/odeke-em/go-uuid"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&EventStoreDecoratorSuite{})
+
+type EventStoreDecoratorSuite struct {
+	baseStore *MemoryEventStore
+}
+
+func (s *EventStoreDecoratorSuite) SetUpTest(c *C) {
+	s.baseStore = NewMemoryEventStore(nil)
+}
+
+func (s *EventStoreDecoratorSuite) TestDecorateEventStore(c *C) {
+	c.Assert(DecorateEventStore(s.baseStore), Equals, s.baseStore)
+
+	outer := NewTraceEventStore(nil)
+	inner := NewReadOnlyEventStore(nil)
+	store := DecorateEventStore(s.baseStore, outer, inner)
+	c.Assert(store, Equals, outer)
+	c.Assert(outer.eventStore, Equals, inner)
+	c.Assert(inner.eventStore, Equals, s.baseStore)
+
+	// The read only store is decorated by the trace store, which does not
+	// trace the events that could not be saved.
+	outer.StartTracing()
+	err := store.Save([]Event{&TestEvent{uuid.New(), "event1"}})
+	c.Assert(err, Equals, ErrReadOnlyEventStore)
+	c.Assert(outer.GetTrace(), HasLen, 0)
+}
+
+func (s *EventStoreDecoratorSuite) TestNoEventStore(c *C) {
+	store := NewReadOnlyEventStore(nil)
+	_, err := store.Load(uuid.New())
+	c.Assert(err, Equals, ErrNoEventStoreDefined)
+	cache, _ := NewCachingEventStore(nil, 1)
+	err = cache.Save([]Event{&TestEvent{uuid.New(), "event1"}})
+	c.Assert(err, Equals, ErrNoEventStoreDefined)
+}
+
+func (s *EventStoreDecoratorSuite) TestReadOnlyEventStore(c *C) {
+	event1 := &TestEvent{uuid.New(), "event1"}
+	err := s.baseStore.Save([]Event{event1})
+	c.Assert(err, IsNil)
+
+	store := NewReadOnlyEventStore(s.baseStore)
+	err = store.Save([]Event{&TestEvent{event1.TestID, "event2"}})
+	c.Assert(err, Equals, ErrReadOnlyEventStore)
+	events, err := store.Load(event1.TestID)
+	c.Assert(err, IsNil)
+	c.Assert(events, DeepEquals, []Event{event1})
+}
+
+func (s *EventStoreDecoratorSuite) TestPublishingEventStore(c *C) {
+	bus := &MockEventBus{}
+	store := NewPublishingEventStore(s.baseStore, bus)
+	event1 := &TestEvent{uuid.New(), "event1"}
+	err := store.Save([]Event{event1})
+	c.Assert(err, IsNil)
+	c.Assert(bus.events, DeepEquals, []Event{event1})
+	events, err := store.Load(event1.TestID)
+	c.Assert(err, IsNil)
+	c.Assert(events, DeepEquals, []Event{event1})
+
+	// Events that are not saved are not published.
+	err = store.Save(nil)
+	c.Assert(err, Equals, ErrNoEventsToAppend)
+	c.Assert(bus.events, HasLen, 1)
+}
+
+func (s *EventStoreDecoratorSuite) TestMetricsEventStore(c *C) {
+	store := NewMetricsEventStore(s.baseStore, "cached_event_store")
+	metrics := &mockMetrics{}
+	store.SetMetrics(metrics)
+	tracer := NewMemoryTracer()
+	store.SetTracer(tracer)
+
+	id := uuid.New()
+	err := store.Save([]Event{&TestEvent{id, "event1"}})
+	c.Assert(err, IsNil)
+	_, err = store.Load(id)
+	c.Assert(err, IsNil)
+	err = store.Save(nil)
+	c.Assert(err, Equals, ErrNoEventsToAppend)
+	c.Assert(metrics.Observations(), DeepEquals, []string{
+		"store cached_event_store save ok",
+		"store cached_event_store load ok",
+		"store cached_event_store save error",
+	})
+	c.Assert(tracer.Spans(), HasLen, 3)
+}
@@ -0,0 +1,226 @@
+package eventhorizon
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidEncryptedField returned when a field tagged for encryption is not
+// an exported string or []byte field.
+var ErrInvalidEncryptedField = errors.New("invalid encrypted field")
+
+// ErrDecryptEvent returned when an encrypted field of a loaded event could
+// not be decrypted.
+var ErrDecryptEvent = errors.New("could not decrypt event")
+
+// EncryptingEventStore is an EventStore decorator that encrypts the fields
+// of events that are tagged with `eh:"encrypt"` with AES-GCM, so that they
+// are stored encrypted. Only string and []byte fields can be encrypted,
+// strings are stored base64 encoded. A field can only be decrypted for the
+// aggregate it was saved for.
+//
+// Saved events are copied before they are encrypted, they are not changed.
+// An event store would publish the encrypted copies, so the decorated store
+// should be created without an event bus and the events published by a
+// PublishingEventStore above the EncryptingEventStore.
+//
+// An example would be:
+//     type EmailChanged struct {
+//         UserID string
+//         Email  string `eh:"encrypt"`
+//     }
+//
+//     encrypting, _ := NewEncryptingEventStore(nil, key)
+//     store := DecorateEventStore(NewMemoryEventStore(nil),
+//         NewPublishingEventStore(nil, bus), encrypting)
+type EncryptingEventStore struct {
+	eventStoreDecorator
+
+	aead      cipher.AEAD
+	plans     map[reflect.Type][]int
+	plansLock sync.RWMutex
+}
+
+// NewEncryptingEventStore creates a new EncryptingEventStore that decorates
+// an event store. The key must be 16, 24 or 32 bytes to use AES-128, AES-192
+// or AES-256.
+func NewEncryptingEventStore(eventStore EventStore, key []byte) (*EncryptingEventStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &EncryptingEventStore{
+		eventStoreDecorator: eventStoreDecorator{eventStore},
+		aead:                aead,
+		plans:               make(map[reflect.Type][]int),
+	}
+	return s, nil
+}
+
+// Save encrypts the tagged fields of the events and appends them to the
+// decorated store. Returns ErrInvalidEncryptedField if a tagged field can
+// not be encrypted.
+func (s *EncryptingEventStore) Save(events []Event) error {
+	return s.saveTraced(SpanContext{}, events)
+}
+
+// traced returns the store, see isTraced.
+func (s *EncryptingEventStore) traced() interface{} { return s }
+
+// saveTraced encrypts and saves events as a child of parent.
+func (s *EncryptingEventStore) saveTraced(parent SpanContext, events []Event) error {
+	encrypted := make([]Event, len(events))
+	for i, event := range events {
+		var err error
+		if encrypted[i], err = s.crypt(event, s.encryptField); err != nil {
+			return err
+		}
+	}
+	return s.save(parent, encrypted)
+}
+
+// Load loads all events for the aggregate id from the decorated store and
+// decrypts their tagged fields. Returns ErrDecryptEvent if a field could not
+// be decrypted.
+func (s *EncryptingEventStore) Load(id string) ([]Event, error) {
+	return s.loadTraced(SpanContext{}, id)
+}
+
+// loadTraced loads and decrypts events as a child of parent.
+func (s *EncryptingEventStore) loadTraced(parent SpanContext, id string) ([]Event, error) {
+	events, err := s.load(parent, id)
+	if err != nil {
+		return events, err
+	}
+	decrypted := make([]Event, len(events))
+	for i, event := range events {
+		if decrypted[i], err = s.crypt(event, s.decryptField); err != nil {
+			return nil, err
+		}
+	}
+	return decrypted, nil
+}
+
+// crypt returns a copy of an event with its tagged fields encrypted or
+// decrypted, or the event itself if it has no tagged fields.
+func (s *EncryptingEventStore) crypt(event Event, f func(reflect.Value, []byte) error) (Event, error) {
+	fields, err := s.plan(reflect.TypeOf(event))
+	if err != nil || len(fields) == 0 {
+		return event, err
+	}
+
+	v := reflect.ValueOf(event)
+	c := reflect.New(v.Type().Elem())
+	c.Elem().Set(v.Elem())
+	for _, i := range fields {
+		if err := f(c.Elem().Field(i), []byte(event.AggregateID())); err != nil {
+			return nil, err
+		}
+	}
+	return c.Interface().(Event), nil
+}
+
+// encryptField encrypts a string or []byte field.
+func (s *EncryptingEventStore) encryptField(field reflect.Value, data []byte) error {
+	if field.Kind() == reflect.String {
+		sealed := s.seal([]byte(field.String()), data)
+		field.SetString(base64.StdEncoding.EncodeToString(sealed))
+	} else if !field.IsNil() {
+		field.SetBytes(s.seal(field.Bytes(), data))
+	}
+	return nil
+}
+
+// decryptField decrypts a string or []byte field.
+func (s *EncryptingEventStore) decryptField(field reflect.Value, data []byte) error {
+	if field.Kind() == reflect.String {
+		sealed, err := base64.StdEncoding.DecodeString(field.String())
+		if err != nil {
+			return ErrDecryptEvent
+		}
+		plaintext, err := s.open(sealed, data)
+		if err != nil {
+			return err
+		}
+		field.SetString(string(plaintext))
+	} else if !field.IsNil() {
+		plaintext, err := s.open(field.Bytes(), data)
+		if err != nil {
+			return err
+		}
+		field.SetBytes(plaintext)
+	}
+	return nil
+}
+
+// seal encrypts plaintext with a random nonce, which is prepended.
+func (s *EncryptingEventStore) seal(plaintext, data []byte) []byte {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(plaintext)+s.aead.Overhead())
+	rand.Read(nonce)
+	return s.aead.Seal(nonce, nonce, plaintext, data)
+}
+
+// open decrypts the result of seal.
+func (s *EncryptingEventStore) open(sealed, data []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, ErrDecryptEvent
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, data)
+	if err != nil {
+		return nil, ErrDecryptEvent
+	}
+	return plaintext, nil
+}
+
+// plan returns the indexes of the tagged fields of an event type, which are
+// found once per type.
+func (s *EncryptingEventStore) plan(t reflect.Type) ([]int, error) {
+	s.plansLock.RLock()
+	fields, ok := s.plans[t]
+	s.plansLock.RUnlock()
+	if ok {
+		return fields, nil
+	}
+
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		for i := 0; i < t.Elem().NumField(); i++ {
+			field := t.Elem().Field(i)
+			if !hasEncryptTag(field.Tag.Get("eh")) {
+				continue
+			}
+			kind := field.Type.Kind()
+			bytes := kind == reflect.Slice && field.Type.Elem().Kind() == reflect.Uint8
+			if field.PkgPath != "" || (kind != reflect.String && !bytes) {
+				return nil, ErrInvalidEncryptedField
+			}
+			fields = append(fields, i)
+		}
+	}
+
+	s.plansLock.Lock()
+	defer s.plansLock.Unlock()
+	s.plans[t] = fields
+	return fields, nil
+}
+
+// hasEncryptTag checks if an eh tag has the encrypt rule.
+func hasEncryptTag(tag string) bool {
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == "encrypt" {
+			return true
+		}
+	}
+	return false
+}
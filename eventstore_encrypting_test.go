@@ -0,0 +1,91 @@
+package eventhorizon
+
+import (
+	"crypto/aes"
+
+	"github.com/odeke-em/go-uuid"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&EncryptingEventStoreSuite{})
+
+type EncryptingEventStoreSuite struct {
+	EventStoreSuite
+	baseStore *MemoryEventStore
+	store     *EncryptingEventStore
+}
+
+var testEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func (s *EncryptingEventStoreSuite) SetUpTest(c *C) {
+	s.baseStore = NewMemoryEventStore(nil)
+	var err error
+	s.store, err = NewEncryptingEventStore(s.baseStore, testEncryptionKey)
+	c.Assert(err, IsNil)
+	s.Store = s.store
+}
+
+func (s *EncryptingEventStoreSuite) TestNewEncryptingEventStore(c *C) {
+	store, err := NewEncryptingEventStore(s.baseStore, []byte("short"))
+	c.Assert(err, Equals, aes.KeySizeError(5))
+	c.Assert(store, IsNil)
+}
+
+func (s *EncryptingEventStoreSuite) TestEncrypt(c *C) {
+	event1 := &TestEncryptedEvent{uuid.New(), "secret", []byte("data")}
+	event2 := &TestEncryptedEvent{event1.TestID, "", nil}
+	err := s.store.Save([]Event{event1, event2})
+	c.Assert(err, IsNil)
+
+	// The saved events are not changed.
+	c.Assert(event1, DeepEquals, &TestEncryptedEvent{event1.TestID, "secret", []byte("data")})
+
+	stored, err := s.baseStore.Load(event1.TestID)
+	c.Assert(err, IsNil)
+	c.Assert(stored, HasLen, 2)
+	e := stored[0].(*TestEncryptedEvent)
+	c.Assert(e.TestID, Equals, event1.TestID)
+	c.Assert(e.Content, Not(Equals), "secret")
+	c.Assert(string(e.Data), Not(Equals), "data")
+	c.Assert(stored[1].(*TestEncryptedEvent).Data, IsNil)
+
+	events, err := s.store.Load(event1.TestID)
+	c.Assert(err, IsNil)
+	c.Assert(events, DeepEquals, []Event{event1, event2})
+
+	// The stored events are not changed by decrypting them.
+	c.Assert(stored[0].(*TestEncryptedEvent).Content, Equals, e.Content)
+}
+
+func (s *EncryptingEventStoreSuite) TestDecryptError(c *C) {
+	event1 := &TestEncryptedEvent{uuid.New(), "secret", nil}
+	err := s.store.Save([]Event{event1})
+	c.Assert(err, IsNil)
+
+	// Another key can not decrypt the events.
+	store, _ := NewEncryptingEventStore(s.baseStore, []byte("fedcba9876543210fedcba9876543210"))
+	events, err := store.Load(event1.TestID)
+	c.Assert(err, Equals, ErrDecryptEvent)
+	c.Assert(events, IsNil)
+
+	// Events that were not encrypted can not be decrypted.
+	event2 := &TestEncryptedEvent{uuid.New(), "plaintext", nil}
+	err = s.baseStore.Save([]Event{event2})
+	c.Assert(err, IsNil)
+	_, err = s.store.Load(event2.TestID)
+	c.Assert(err, Equals, ErrDecryptEvent)
+}
+
+type testInvalidEncryptedEvent struct {
+	TestID string
+	Count  int `eh:"encrypt"`
+}
+
+func (t *testInvalidEncryptedEvent) AggregateID() string   { return t.TestID }
+func (t *testInvalidEncryptedEvent) AggregateType() string { return "Test" }
+func (t *testInvalidEncryptedEvent) EventType() string     { return "testInvalidEncryptedEvent" }
+
+func (s *EncryptingEventStoreSuite) TestInvalidField(c *C) {
+	err := s.store.Save([]Event{&testInvalidEncryptedEvent{uuid.New(), 1}})
+	c.Assert(err, Equals, ErrInvalidEncryptedField)
+}
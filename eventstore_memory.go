@@ -1,11 +1,18 @@
 package eventhorizon
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
-// MemoryEventStore implements EventStore as an in memory structure.
+// MemoryEventStore implements EventStore as an in memory structure. It is
+// safe for concurrent use.
 type MemoryEventStore struct {
 	eventBus         EventBus
 	aggregateRecords map[string]*memoryAggregateRecord
+	mu               sync.RWMutex
+
+	instrumentation
 }
 
 // NewMemoryEventStore creates a new MemoryEventStore.
@@ -17,17 +24,30 @@ func NewMemoryEventStore(eventBus EventBus) *MemoryEventStore {
 	return s
 }
 
-// Save appends all events in the event stream to the memory store.
+// Save appends all events in the event stream to the memory store. The
+// events are copied, so the caller can not change them once stored.
 func (s *MemoryEventStore) Save(events []Event) error {
+	return s.saveTraced(SpanContext{}, events)
+}
+
+// traced returns the store, see isTraced.
+func (s *MemoryEventStore) traced() interface{} { return s }
+
+// saveTraced saves events as a child of parent.
+func (s *MemoryEventStore) saveTraced(parent SpanContext, events []Event) (err error) {
+	context, done := s.observeEventStore("memory_event_store", parent, "save", eventsAggregateID(events))
+	defer done(&err)
+
 	if len(events) == 0 {
 		return ErrNoEventsToAppend
 	}
 
+	s.mu.Lock()
 	for _, event := range events {
 		r := &memoryEventRecord{
 			eventType: event.EventType(),
 			timestamp: time.Now(),
-			event:     event,
+			event:     copyModel(event).(Event),
 		}
 
 		if a, ok := s.aggregateRecords[event.AggregateID()]; ok {
@@ -41,23 +61,38 @@ func (s *MemoryEventStore) Save(events []Event) error {
 				events:      []*memoryEventRecord{r},
 			}
 		}
+	}
+	s.mu.Unlock()
 
-		// Publish event on the bus.
-		if s.eventBus != nil {
-			s.eventBus.PublishEvent(event)
+	// Publish events on the bus, without holding the lock as handlers may
+	// use the store.
+	if s.eventBus != nil {
+		for _, event := range events {
+			publishEvent(s.eventBus, context, event)
 		}
 	}
 
 	return nil
 }
 
-// Load loads all events for the aggregate id from the memory store.
+// Load loads copies of all events for the aggregate id from the memory store.
 // Returns ErrNoEventsFound if no events can be found.
 func (s *MemoryEventStore) Load(id string) ([]Event, error) {
+	return s.loadTraced(SpanContext{}, id)
+}
+
+// loadTraced loads events as a child of parent.
+func (s *MemoryEventStore) loadTraced(parent SpanContext, id string) (events []Event, err error) {
+	_, done := s.observeEventStore("memory_event_store", parent, "load", id)
+	defer done(&err)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if a, ok := s.aggregateRecords[id]; ok {
 		events := make([]Event, len(a.events))
 		for i, r := range a.events {
-			events[i] = r.event
+			events[i] = copyModel(r.event).(Event)
 		}
 		return events, nil
 	}
@@ -65,6 +100,25 @@ func (s *MemoryEventStore) Load(id string) ([]Event, error) {
 	return nil, ErrNoEventsFound
 }
 
+// AggregateVersion returns the number of events of the aggregate id.
+func (s *MemoryEventStore) AggregateVersion(id string) (int, error) {
+	return s.aggregateVersionTraced(SpanContext{}, id)
+}
+
+// aggregateVersionTraced loads the version as a child of parent.
+func (s *MemoryEventStore) aggregateVersionTraced(parent SpanContext, id string) (version int, err error) {
+	_, done := s.observeEventStore("memory_event_store", parent, "version", id)
+	defer done(&err)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if a, ok := s.aggregateRecords[id]; ok {
+		return len(a.events), nil
+	}
+	return 0, nil
+}
+
 // Close closes the store.
 func (s *MemoryEventStore) Close() error {
 	return nil
@@ -1,6 +1,7 @@
 package eventhorizon
 
 import (
+	"github.com/odeke-em/go-uuid"
 	. "gopkg.in/check.v1"
 )
 
@@ -24,3 +25,19 @@ func (s *MemoryEventStoreSuite) Test_NewMemoryEventStore(c *C) {
 	store := NewMemoryEventStore(bus)
 	c.Assert(store, NotNil)
 }
+
+func (s *MemoryEventStoreSuite) Test_Copies(c *C) {
+	event1 := &TestEvent{uuid.New(), "event1"}
+	err := s.Store.Save([]Event{event1})
+	c.Assert(err, IsNil)
+
+	// Neither the saved nor the loaded events change the stored events.
+	event1.Content = "changed"
+	events, err := s.Store.Load(event1.TestID)
+	c.Assert(err, IsNil)
+	c.Assert(events, DeepEquals, []Event{&TestEvent{event1.TestID, "event1"}})
+	events[0].(*TestEvent).Content = "changed"
+	events, err = s.Store.Load(event1.TestID)
+	c.Assert(err, IsNil)
+	c.Assert(events, DeepEquals, []Event{&TestEvent{event1.TestID, "event1"}})
+}
@@ -0,0 +1,61 @@
+package eventhorizon
+
+// MetricsEventStore is an EventStore decorator that observes and traces the
+// saving and loading of events as a component, see SetMetrics and SetTracer.
+// It measures the decorators that it wraps, for example a cache, as well as
+// the store.
+type MetricsEventStore struct {
+	eventStoreDecorator
+	component string
+
+	instrumentation
+}
+
+// NewMetricsEventStore creates a new MetricsEventStore that decorates an
+// event store, with a component name like "cached_event_store".
+func NewMetricsEventStore(eventStore EventStore, component string) *MetricsEventStore {
+	return &MetricsEventStore{
+		eventStoreDecorator: eventStoreDecorator{eventStore},
+		component:           component,
+	}
+}
+
+// Save appends all events to the decorated store.
+func (s *MetricsEventStore) Save(events []Event) error {
+	return s.saveTraced(SpanContext{}, events)
+}
+
+// traced returns the store, see isTraced.
+func (s *MetricsEventStore) traced() interface{} { return s }
+
+// saveTraced saves events as a child of parent.
+func (s *MetricsEventStore) saveTraced(parent SpanContext, events []Event) (err error) {
+	context, done := s.observeEventStore(s.component, parent, "save", eventsAggregateID(events))
+	defer done(&err)
+	return s.save(context, events)
+}
+
+// Load loads all events for the aggregate id from the decorated store.
+func (s *MetricsEventStore) Load(id string) ([]Event, error) {
+	return s.loadTraced(SpanContext{}, id)
+}
+
+// loadTraced loads events as a child of parent.
+func (s *MetricsEventStore) loadTraced(parent SpanContext, id string) (events []Event, err error) {
+	context, done := s.observeEventStore(s.component, parent, "load", id)
+	defer done(&err)
+	return s.load(context, id)
+}
+
+// AggregateVersion implements the AggregateVersion method of the
+// VersionedEventStore interface.
+func (s *MetricsEventStore) AggregateVersion(id string) (int, error) {
+	return s.aggregateVersionTraced(SpanContext{}, id)
+}
+
+// aggregateVersionTraced loads the version as a child of parent.
+func (s *MetricsEventStore) aggregateVersionTraced(parent SpanContext, id string) (version int, err error) {
+	context, done := s.observeEventStore(s.component, parent, "version", id)
+	defer done(&err)
+	return s.eventStoreDecorator.aggregateVersionTraced(context, id)
+}
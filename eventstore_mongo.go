@@ -13,6 +13,8 @@ type MongoEventStore struct {
 	session   *mgo.Session
 	db        string
 	factories map[string]func() Event
+
+	instrumentation
 }
 
 // NewMongoEventStore creates a new MongoEventStore.
@@ -62,6 +64,17 @@ type mongoEventRecord struct {
 
 // Save appends all events in the event stream to the database.
 func (s *MongoEventStore) Save(events []Event) error {
+	return s.saveTraced(SpanContext{}, events)
+}
+
+// traced returns the store, see isTraced.
+func (s *MongoEventStore) traced() interface{} { return s }
+
+// saveTraced saves events as a child of parent.
+func (s *MongoEventStore) saveTraced(parent SpanContext, events []Event) (err error) {
+	context, done := s.observeEventStore("mongo_event_store", parent, "save", eventsAggregateID(events))
+	defer done(&err)
+
 	if len(events) == 0 {
 		return ErrNoEventsToAppend
 	}
@@ -127,7 +140,7 @@ func (s *MongoEventStore) Save(events []Event) error {
 
 		// Publish event on the bus.
 		if s.eventBus != nil {
-			s.eventBus.PublishEvent(event)
+			publishEvent(s.eventBus, context, event)
 		}
 	}
 
@@ -137,16 +150,26 @@ func (s *MongoEventStore) Save(events []Event) error {
 // Load loads all events for the aggregate id from the database.
 // Returns ErrNoEventsFound if no events can be found.
 func (s *MongoEventStore) Load(id string) ([]Event, error) {
+	return s.loadTraced(SpanContext{}, id)
+}
+
+// loadTraced loads events as a child of parent.
+func (s *MongoEventStore) loadTraced(parent SpanContext, id string) (events []Event, err error) {
+	_, done := s.observeEventStore("mongo_event_store", parent, "load", id)
+	defer done(&err)
+
 	sess := s.session.Copy()
 	defer sess.Close()
 
 	var aggregate mongoAggregateRecord
-	err := sess.DB(s.db).C("events").FindId(id).One(&aggregate)
-	if err != nil {
+	err = sess.DB(s.db).C("events").FindId(id).One(&aggregate)
+	if err == mgo.ErrNotFound {
 		return nil, ErrNoEventsFound
+	} else if err != nil {
+		return nil, err
 	}
 
-	events := make([]Event, len(aggregate.Events))
+	events = make([]Event, len(aggregate.Events))
 	for i, record := range aggregate.Events {
 		// Get the registered factory function for creating events.
 		f, ok := s.factories[record.Type]
@@ -171,6 +194,29 @@ func (s *MongoEventStore) Load(id string) ([]Event, error) {
 	return events, nil
 }
 
+// AggregateVersion returns the number of events of the aggregate id.
+func (s *MongoEventStore) AggregateVersion(id string) (int, error) {
+	return s.aggregateVersionTraced(SpanContext{}, id)
+}
+
+// aggregateVersionTraced loads the version as a child of parent.
+func (s *MongoEventStore) aggregateVersionTraced(parent SpanContext, id string) (version int, err error) {
+	_, done := s.observeEventStore("mongo_event_store", parent, "version", id)
+	defer done(&err)
+
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	var aggregate mongoAggregateRecord
+	err = sess.DB(s.db).C("events").FindId(id).Select(bson.M{"version": 1}).One(&aggregate)
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return aggregate.Version, nil
+}
+
 // RegisterEventType registers an event factory for a event type. The factory is
 // used to create concrete event types when loading from the database.
 //
@@ -6,7 +6,6 @@ import (
 	"errors"
 	"time"
 
-	"github.com/doubledutch/lager"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -19,7 +18,8 @@ type PostgresEventStore struct {
 	db        *sqlx.DB
 	factories map[string]func() Event
 
-	lgr lager.ContextLager
+	logging
+	instrumentation
 }
 
 type postgresAggregateRecord struct {
@@ -35,13 +35,11 @@ type postgresEventRecord struct {
 	Data         []byte
 }
 
-// NewPostgresEventStore creates a new PostgresEventStore.
+// NewPostgresEventStore creates a new PostgresEventStore. It logs to lager
+// until another logger is set with SetLogger.
 func NewPostgresEventStore(eventBus EventBus, conn string) (*PostgresEventStore, error) {
-	lgr := lager.Child()
-
 	db, err := initDB(conn)
 	if err != nil {
-		lgr.WithError(err).Errorf("Unable to initialize database")
 		return nil, err
 	}
 
@@ -62,20 +60,31 @@ CREATE TABLE IF NOT EXISTS events(
 )
     `); err != nil {
 		db.Close()
-		lgr.WithError(err).Errorf("Unable to initialize tables")
 		return nil, ErrCouldNotCreateTables
 	}
 
-	return &PostgresEventStore{
+	s := &PostgresEventStore{
 		eventBus:  eventBus,
 		db:        db,
 		factories: make(map[string]func() Event),
-		lgr:       lgr,
-	}, nil
+	}
+	s.logToLager()
+	return s, nil
 }
 
 // Save appends all events in the event stream to the store.
 func (s *PostgresEventStore) Save(events []Event) error {
+	return s.saveTraced(SpanContext{}, events)
+}
+
+// traced returns the store, see isTraced.
+func (s *PostgresEventStore) traced() interface{} { return s }
+
+// saveTraced saves events as a child of parent.
+func (s *PostgresEventStore) saveTraced(parent SpanContext, events []Event) (err error) {
+	context, done := s.observeEventStore("postgres_event_store", parent, "save", eventsAggregateID(events))
+	defer done(&err)
+
 	if len(events) == 0 {
 		return ErrNoEventsToAppend
 	}
@@ -92,12 +101,16 @@ func (s *PostgresEventStore) Save(events []Event) error {
 		err := s.db.Select(&existing,
 			`SELECT * FROM aggregrates WHERE id=$1 LIMIT 2`, event.AggregateID())
 		if (err != nil && err != sql.ErrNoRows) || len(existing) > 1 {
+			s.logger().WithError(err).With(eventFields(event)).
+				Errorf("Unable to load aggregate")
 			return ErrCouldNotLoadAggregate
 		}
 
 		// Marshal event data
 		b, err := json.Marshal(event)
 		if err != nil {
+			s.logger().WithError(err).With(eventFields(event)).
+				Errorf("Unable to marshal event")
 			return ErrCouldNotMarshalEvent
 		}
 
@@ -121,6 +134,8 @@ func (s *PostgresEventStore) Save(events []Event) error {
 				`INSERT INTO aggregrates (id,version)
         VALUES (:id,:version)`, aggregrate)
 			if err != nil {
+				s.logger().WithError(err).With(eventFields(event)).
+					Errorf("Unable to save aggregate")
 				return ErrCouldNotSaveAggregate
 			}
 
@@ -128,6 +143,8 @@ func (s *PostgresEventStore) Save(events []Event) error {
 				`INSERT INTO events (aggregrateid,type,version,timestamp,data)
         VALUES (:aggregrateid,:type,:version,:timestamp,:data)`, r)
 			if err != nil {
+				s.logger().WithError(err).With(eventFields(event)).
+					Errorf("Unable to save event")
 				return ErrCouldNotSaveEvent
 			}
 		} else {
@@ -136,6 +153,8 @@ func (s *PostgresEventStore) Save(events []Event) error {
 			_, err = s.db.NamedExec(
 				`UPDATE aggregrates SET version=:version WHERE id=:id`, existing[0])
 			if err != nil {
+				s.logger().WithError(err).With(eventFields(event)).
+					Errorf("Unable to save aggregate")
 				return ErrCouldNotSaveAggregate
 			}
 			r.Version = version
@@ -143,6 +162,8 @@ func (s *PostgresEventStore) Save(events []Event) error {
 				`INSERT INTO events (aggregrateid,type,version,timestamp,data)
         VALUES (:aggregrateid,:type,:version,:timestamp,:data)`, r)
 			if err != nil {
+				s.logger().WithError(err).With(eventFields(event)).
+					Errorf("Unable to save event")
 				return ErrCouldNotSaveEvent
 			}
 		}
@@ -156,7 +177,7 @@ func (s *PostgresEventStore) Save(events []Event) error {
 	for _, event := range events {
 		// Publish event on the bus.
 		if s.eventBus != nil {
-			s.eventBus.PublishEvent(event)
+			publishEvent(s.eventBus, context, event)
 		}
 	}
 
@@ -165,21 +186,34 @@ func (s *PostgresEventStore) Save(events []Event) error {
 
 // Load loads all events for the aggregate id from the store.
 func (s *PostgresEventStore) Load(id string) ([]Event, error) {
+	return s.loadTraced(SpanContext{}, id)
+}
+
+// loadTraced loads events as a child of parent.
+func (s *PostgresEventStore) loadTraced(parent SpanContext, id string) (events []Event, err error) {
+	_, done := s.observeEventStore("postgres_event_store", parent, "load", id)
+	defer done(&err)
+
 	var aggregrate postgresAggregateRecord
-	err := s.db.Get(&aggregrate,
+	err = s.db.Get(&aggregrate,
 		`SELECT * FROM aggregrates WHERE id=$1 LIMIT 1`, id)
-	if err != nil {
+	if err == sql.ErrNoRows {
 		return nil, ErrNoEventsFound
+	} else if err != nil {
+		return nil, err
 	}
 
 	var rawEvents []*postgresEventRecord
 	err = s.db.Select(&rawEvents,
 		`SELECT * FROM events WHERE aggregrateid=$1 ORDER BY timestamp ASC`, id)
 	if err != nil {
+		return nil, err
+	}
+	if len(rawEvents) == 0 {
 		return nil, ErrNoEventsFound
 	}
 
-	events := make([]Event, len(rawEvents))
+	events = make([]Event, len(rawEvents))
 	for i, rawEvent := range rawEvents {
 		// Get the registered factory function for creating events.
 		f, ok := s.factories[rawEvent.Type]
@@ -190,6 +224,10 @@ func (s *PostgresEventStore) Load(id string) ([]Event, error) {
 		// Unmarshal JSON
 		event := f()
 		if err := json.Unmarshal(rawEvent.Data, event); err != nil {
+			s.logger().WithError(err).With(map[string]string{
+				"eventType":   rawEvent.Type,
+				"aggregateID": id,
+			}).Errorf("Unable to unmarshal event")
 			return nil, ErrCouldNotUnmarshalEvent
 		}
 		if events[i], ok = event.(Event); !ok {
@@ -206,6 +244,25 @@ func (s *PostgresEventStore) Load(id string) ([]Event, error) {
 	return events, nil
 }
 
+// AggregateVersion returns the number of events of the aggregate id.
+func (s *PostgresEventStore) AggregateVersion(id string) (int, error) {
+	return s.aggregateVersionTraced(SpanContext{}, id)
+}
+
+// aggregateVersionTraced loads the version as a child of parent.
+func (s *PostgresEventStore) aggregateVersionTraced(parent SpanContext, id string) (version int, err error) {
+	_, done := s.observeEventStore("postgres_event_store", parent, "version", id)
+	defer done(&err)
+
+	err = s.db.Get(&version, `SELECT version FROM aggregrates WHERE id=$1`, id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
 // RegisterEventType registers an event factory for a event type. The factory is
 // used to create concrete event types when loading from the database.
 //
@@ -0,0 +1,49 @@
+package eventhorizon
+
+// PublishingEventStore is an EventStore decorator that publishes the events
+// on an event bus once the decorated store has saved them. It is used above
+// decorators that change the saved events, like the EncryptingEventStore, so
+// that handlers get the events as they were saved by the caller.
+type PublishingEventStore struct {
+	eventStoreDecorator
+
+	eventBus EventBus
+}
+
+// NewPublishingEventStore creates a new PublishingEventStore that decorates
+// an event store and publishes on an event bus.
+func NewPublishingEventStore(eventStore EventStore, eventBus EventBus) *PublishingEventStore {
+	return &PublishingEventStore{eventStoreDecorator{eventStore}, eventBus}
+}
+
+// Save appends the events to the decorated store and publishes them on the
+// event bus, if they were saved.
+func (s *PublishingEventStore) Save(events []Event) error {
+	return s.saveTraced(SpanContext{}, events)
+}
+
+// traced returns the store, see isTraced.
+func (s *PublishingEventStore) traced() interface{} { return s }
+
+// saveTraced saves and publishes events as a child of parent.
+func (s *PublishingEventStore) saveTraced(parent SpanContext, events []Event) error {
+	if err := s.save(parent, events); err != nil {
+		return err
+	}
+	if s.eventBus != nil {
+		for _, event := range events {
+			publishEvent(s.eventBus, parent, event)
+		}
+	}
+	return nil
+}
+
+// Load loads all events for the aggregate id from the decorated store.
+func (s *PublishingEventStore) Load(id string) ([]Event, error) {
+	return s.load(SpanContext{}, id)
+}
+
+// loadTraced loads events from the decorated store as a child of parent.
+func (s *PublishingEventStore) loadTraced(parent SpanContext, id string) ([]Event, error) {
+	return s.load(parent, id)
+}
@@ -0,0 +1,42 @@
+package eventhorizon
+
+import "errors"
+
+// ErrReadOnlyEventStore returned when saving events to a read only event
+// store.
+var ErrReadOnlyEventStore = errors.New("event store is read only")
+
+// ReadOnlyEventStore is an EventStore decorator that only loads events, for
+// example for a replica or while migrating a store.
+type ReadOnlyEventStore struct {
+	eventStoreDecorator
+}
+
+// NewReadOnlyEventStore creates a new ReadOnlyEventStore that decorates an
+// event store.
+func NewReadOnlyEventStore(eventStore EventStore) *ReadOnlyEventStore {
+	return &ReadOnlyEventStore{eventStoreDecorator{eventStore}}
+}
+
+// Save returns ErrReadOnlyEventStore.
+func (s *ReadOnlyEventStore) Save(events []Event) error {
+	return ErrReadOnlyEventStore
+}
+
+// Load loads all events for the aggregate id from the decorated store.
+func (s *ReadOnlyEventStore) Load(id string) ([]Event, error) {
+	return s.load(SpanContext{}, id)
+}
+
+// traced returns the store, see isTraced.
+func (s *ReadOnlyEventStore) traced() interface{} { return s }
+
+// saveTraced returns ErrReadOnlyEventStore.
+func (s *ReadOnlyEventStore) saveTraced(parent SpanContext, events []Event) error {
+	return ErrReadOnlyEventStore
+}
+
+// loadTraced loads events from the decorated store as a child of parent.
+func (s *ReadOnlyEventStore) loadTraced(parent SpanContext, id string) ([]Event, error) {
+	return s.load(parent, id)
+}
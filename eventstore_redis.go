@@ -0,0 +1,233 @@
+package eventhorizon
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// redisAppendScript appends event records to an aggregate list, but only if
+// the list still has the length (version) that the records were created for.
+// This makes the version check and append one atomic operation.
+var redisAppendScript = redis.NewScript(1, `
+local version = redis.call("LLEN", KEYS[1])
+if version ~= tonumber(ARGV[1]) then
+	return redis.error_reply("version mismatch")
+end
+for i = 2, #ARGV do
+	redis.call("RPUSH", KEYS[1], ARGV[i])
+end
+return version + #ARGV - 1
+`)
+
+// RedisEventStore implements an EventStore for Redis. The events of each
+// aggregate are stored as JSON records in a list.
+type RedisEventStore struct {
+	eventBus  EventBus
+	pool      *redis.Pool
+	prefix    string
+	factories map[string]func() Event
+
+	instrumentation
+}
+
+// NewRedisEventStore creates a new RedisEventStore.
+func NewRedisEventStore(eventBus EventBus, appID, server, password string) (*RedisEventStore, error) {
+	pool := newRedisPool(server, password)
+	return NewRedisEventStoreWithPool(eventBus, appID, pool)
+}
+
+// NewRedisEventStoreWithPool creates a new RedisEventStore with a pool.
+func NewRedisEventStoreWithPool(eventBus EventBus, appID string, pool *redis.Pool) (*RedisEventStore, error) {
+	if pool == nil {
+		return nil, ErrNoDBSession
+	}
+
+	s := &RedisEventStore{
+		eventBus:  eventBus,
+		pool:      pool,
+		prefix:    appID + ":aggregates:",
+		factories: make(map[string]func() Event),
+	}
+
+	return s, nil
+}
+
+type redisEventRecord struct {
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Save appends all events in the event stream to the store.
+func (s *RedisEventStore) Save(events []Event) error {
+	return s.saveTraced(SpanContext{}, events)
+}
+
+// traced returns the store, see isTraced.
+func (s *RedisEventStore) traced() interface{} { return s }
+
+// saveTraced saves events as a child of parent.
+func (s *RedisEventStore) saveTraced(parent SpanContext, events []Event) (err error) {
+	context, done := s.observeEventStore("redis_event_store", parent, "save", eventsAggregateID(events))
+	defer done(&err)
+
+	if len(events) == 0 {
+		return ErrNoEventsToAppend
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	// Group the events per aggregate, keeping their order.
+	var ids []string
+	aggregates := make(map[string][]Event)
+	for _, event := range events {
+		id := event.AggregateID()
+		if _, ok := aggregates[id]; !ok {
+			ids = append(ids, id)
+		}
+		aggregates[id] = append(aggregates[id], event)
+	}
+
+	for _, id := range ids {
+		key := s.prefix + id
+
+		// Get the current version of the aggregate.
+		version, err := redis.Int(conn.Do("LLEN", key))
+		if err != nil {
+			return ErrCouldNotLoadAggregate
+		}
+
+		// Create the event records with timestamps.
+		args := []interface{}{key, version}
+		for i, event := range aggregates[id] {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return ErrCouldNotMarshalEvent
+			}
+
+			r, err := json.Marshal(&redisEventRecord{
+				Type:      event.EventType(),
+				Version:   version + i + 1,
+				Timestamp: time.Now(),
+				Data:      data,
+			})
+			if err != nil {
+				return ErrCouldNotMarshalEvent
+			}
+			args = append(args, r)
+		}
+
+		// Only append if the version of the aggregate is matching (ie not
+		// changed since the query above).
+		if _, err := redisAppendScript.Do(conn, args...); err != nil {
+			return ErrCouldNotSaveAggregate
+		}
+
+		// Publish events on the bus.
+		if s.eventBus != nil {
+			for _, event := range aggregates[id] {
+				publishEvent(s.eventBus, context, event)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Load loads all events for the aggregate id from the store.
+// Returns ErrNoEventsFound if no events can be found.
+func (s *RedisEventStore) Load(id string) ([]Event, error) {
+	return s.loadTraced(SpanContext{}, id)
+}
+
+// loadTraced loads events as a child of parent.
+func (s *RedisEventStore) loadTraced(parent SpanContext, id string) (events []Event, err error) {
+	_, done := s.observeEventStore("redis_event_store", parent, "load", id)
+	defer done(&err)
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	records, err := redis.ByteSlices(conn.Do("LRANGE", s.prefix+id, 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNoEventsFound
+	}
+
+	events = make([]Event, len(records))
+	for i, data := range records {
+		var record redisEventRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, ErrCouldNotUnmarshalEvent
+		}
+
+		// Get the registered factory function for creating events.
+		f, ok := s.factories[record.Type]
+		if !ok {
+			return nil, ErrEventNotRegistered
+		}
+
+		event := f()
+		if err := json.Unmarshal(record.Data, event); err != nil {
+			return nil, ErrCouldNotUnmarshalEvent
+		}
+		if events[i], ok = event.(Event); !ok {
+			return nil, ErrInvalidEvent
+		}
+	}
+
+	return events, nil
+}
+
+// AggregateVersion returns the number of events of the aggregate id.
+func (s *RedisEventStore) AggregateVersion(id string) (int, error) {
+	return s.aggregateVersionTraced(SpanContext{}, id)
+}
+
+// aggregateVersionTraced loads the version as a child of parent.
+func (s *RedisEventStore) aggregateVersionTraced(parent SpanContext, id string) (version int, err error) {
+	_, done := s.observeEventStore("redis_event_store", parent, "version", id)
+	defer done(&err)
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	return redis.Int(conn.Do("LLEN", s.prefix+id))
+}
+
+// RegisterEventType registers an event factory for a event type. The factory is
+// used to create concrete event types when loading from the database.
+//
+// An example would be:
+//     eventStore.RegisterEventType(&MyEvent{}, func() Event { return &MyEvent{} })
+func (s *RedisEventStore) RegisterEventType(event Event, factory func() Event) error {
+	if _, ok := s.factories[event.EventType()]; ok {
+		return ErrHandlerAlreadySet
+	}
+
+	s.factories[event.EventType()] = factory
+
+	return nil
+}
+
+// Clear clears the event storage.
+func (s *RedisEventStore) Clear() error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	if err := redisDeletePrefix(conn, s.prefix); err != nil {
+		return ErrCouldNotClearDB
+	}
+	return nil
+}
+
+// Close closes the connection pool.
+func (s *RedisEventStore) Close() error {
+	return s.pool.Close()
+}
@@ -0,0 +1,49 @@
+// +build redis
+
+package eventhorizon
+
+import (
+	"github.com/odeke-em/go-uuid"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&RedisEventStoreSuite{})
+
+type RedisEventStoreSuite struct {
+	url string
+	RemoteEventStoreSuite
+}
+
+func (s *RedisEventStoreSuite) SetUpSuite(c *C) {
+	s.url = redisURL()
+}
+
+func (s *RedisEventStoreSuite) SetUpTest(c *C) {
+	bus := &MockEventBus{
+		events: make([]Event, 0),
+	}
+	store, err := NewRedisEventStore(bus, "test", s.url, "")
+	c.Assert(err, IsNil)
+
+	s.RemoteEventStoreSuite.Setup(store, c)
+}
+
+func (s *RedisEventStoreSuite) Test_NewRedisEventStore(c *C) {
+	bus := &MockEventBus{
+		events: make([]Event, 0),
+	}
+	store, err := NewRedisEventStore(bus, "test", s.url, "")
+	c.Assert(store, NotNil)
+	c.Assert(err, IsNil)
+}
+
+func (s *RedisEventStoreSuite) Test_Clear(c *C) {
+	event1 := &TestEvent{uuid.New(), "event1"}
+	err := s.Store.Save([]Event{event1})
+	c.Assert(err, IsNil)
+	err = s.Store.Clear()
+	c.Assert(err, IsNil)
+	events, err := s.Store.Load(event1.TestID)
+	c.Assert(err, Equals, ErrNoEventsFound)
+	c.Assert(events, IsNil)
+}
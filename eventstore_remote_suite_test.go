@@ -13,6 +13,8 @@ type RemoteEventStoreSuite struct {
 func (s *RemoteEventStoreSuite) Setup(store RemoteEventStore, c *C) {
 	err := store.RegisterEventType(&TestEvent{}, func() Event { return &TestEvent{} })
 	c.Assert(err, IsNil)
+	err = store.RegisterEventType(&TestEncryptedEvent{}, func() Event { return &TestEncryptedEvent{} })
+	c.Assert(err, IsNil)
 	store.Clear()
 
 	s.Store = store
@@ -1,6 +1,8 @@
 package eventhorizon
 
 import (
+	"sync"
+
 	"github.com/odeke-em/go-uuid"
 	. "gopkg.in/check.v1"
 )
@@ -57,3 +59,74 @@ func (s *EventStoreSuite) Test_LoadNoEvents(c *C) {
 	c.Assert(err, ErrorMatches, "could not find events")
 	c.Assert(events, DeepEquals, []Event(nil))
 }
+
+func (s *EventStoreSuite) Test_Concurrent(c *C) {
+	// Run with the race detector to find unsafe access.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			event1 := &TestEvent{uuid.New(), "event1"}
+			event2 := &TestEvent{event1.TestID, "event2"}
+			c.Check(s.Store.Save([]Event{event1, event2}), IsNil)
+			events, err := s.Store.Load(event1.TestID)
+			c.Check(err, IsNil)
+			c.Check(events, DeepEquals, []Event{event1, event2})
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *EventStoreSuite) Test_Decorated(c *C) {
+	trace := NewTraceEventStore(nil)
+	cache, err := NewCachingEventStore(nil, 10)
+	c.Assert(err, IsNil)
+	encrypting, err := NewEncryptingEventStore(nil, []byte("0123456789abcdef"))
+	c.Assert(err, IsNil)
+	bus := &MockEventBus{}
+	store := DecorateEventStore(s.Store,
+		NewMetricsEventStore(nil, "decorated_event_store"),
+		NewPublishingEventStore(nil, bus), trace, cache, encrypting)
+
+	trace.StartTracing()
+	event1 := &TestEncryptedEvent{uuid.New(), "event1", []byte("data1")}
+	event2 := &TestEvent{event1.TestID, "event2"}
+	err = store.Save([]Event{event1, event2})
+	c.Assert(err, IsNil)
+	c.Assert(trace.GetTrace(), DeepEquals, []Event{event1, event2})
+
+	// The bus gets the decrypted events.
+	c.Assert(bus.events, DeepEquals, []Event{event1, event2})
+	for i := 0; i < 2; i++ {
+		events, err := store.Load(event1.TestID)
+		c.Assert(err, IsNil)
+		c.Assert(events, DeepEquals, []Event{event1, event2})
+	}
+
+	// The store only has the encrypted fields.
+	events, err := s.Store.Load(event1.TestID)
+	c.Assert(err, IsNil)
+	c.Assert(events, HasLen, 2)
+	c.Assert(events[0].(*TestEncryptedEvent).Content, Not(Equals), "event1")
+	c.Assert(events[1], DeepEquals, event2)
+}
+
+func (s *EventStoreSuite) Test_AggregateVersion(c *C) {
+	store, ok := s.Store.(VersionedEventStore)
+	if !ok {
+		c.Skip("not a versioned event store")
+	}
+
+	id := uuid.New()
+	version, err := store.AggregateVersion(id)
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, 0)
+	err = store.Save([]Event{&TestEvent{id, "event1"}})
+	c.Assert(err, IsNil)
+	err = store.Save([]Event{&TestEvent{id, "event2"}, &TestEvent{id, "event3"}})
+	c.Assert(err, IsNil)
+	version, err = store.AggregateVersion(id)
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, 3)
+}
@@ -1,60 +1,108 @@
 package eventhorizon
 
-// TraceEventStore wraps an EventStore and adds debug tracing.
+import "sync"
+
+// TraceEventStore is an EventStore decorator that records the saved events
+// while tracing, mostly useful for tests. It is safe for concurrent use.
 type TraceEventStore struct {
-	eventStore EventStore
+	eventStoreDecorator
+
 	tracing    bool
+	aggregates map[string]bool
 	trace      []Event
+	lock       sync.RWMutex
 }
 
-// NewTraceEventStore creates a new TraceEventStore.
+// NewTraceEventStore creates a new TraceEventStore that decorates an event
+// store. Without an event store the events are only traced.
 func NewTraceEventStore(eventStore EventStore) *TraceEventStore {
 	s := &TraceEventStore{
-		eventStore: eventStore,
-		trace:      make([]Event, 0),
+		eventStoreDecorator: eventStoreDecorator{eventStore},
+		trace:               make([]Event, 0),
 	}
 	return s
 }
 
-// Save appends all events to the base store and trace them if enabled.
+// Save appends all events to the decorated store and traces them if enabled
+// and they were saved.
 func (s *TraceEventStore) Save(events []Event) error {
-	if s.tracing {
-		s.trace = append(s.trace, events...)
-	}
+	return s.saveTraced(SpanContext{}, events)
+}
+
+// traced returns the store, see isTraced.
+func (s *TraceEventStore) traced() interface{} { return s }
 
+// saveTraced saves and traces events as a child of parent.
+func (s *TraceEventStore) saveTraced(parent SpanContext, events []Event) error {
 	if s.eventStore != nil {
-		return s.eventStore.Save(events)
+		if err := saveEvents(s.eventStore, parent, events); err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.tracing {
+		for _, event := range events {
+			if s.aggregates == nil || s.aggregates[event.AggregateID()] {
+				s.trace = append(s.trace, event)
+			}
+		}
 	}
 
 	return nil
 }
 
-// Load loads all events for the aggregate id from the base store.
+// Load loads all events for the aggregate id from the decorated store.
 // Returns ErrNoEventStoreDefined if no event store could be found.
 func (s *TraceEventStore) Load(id string) ([]Event, error) {
-	if s.eventStore != nil {
-		return s.eventStore.Load(id)
-	}
+	return s.load(SpanContext{}, id)
+}
 
-	return nil, ErrNoEventStoreDefined
+// loadTraced loads events from the decorated store as a child of parent.
+func (s *TraceEventStore) loadTraced(parent SpanContext, id string) ([]Event, error) {
+	return s.load(parent, id)
 }
 
 // StartTracing starts the tracing of events.
 func (s *TraceEventStore) StartTracing() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	s.tracing = true
 }
 
 // StopTracing stops the tracing of events.
 func (s *TraceEventStore) StopTracing() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	s.tracing = false
 }
 
+// TraceAggregates limits the tracing to the events of the aggregates with
+// the ids. Without ids the events of all aggregates are traced.
+func (s *TraceEventStore) TraceAggregates(ids ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(ids) == 0 {
+		s.aggregates = nil
+		return
+	}
+	s.aggregates = make(map[string]bool)
+	for _, id := range ids {
+		s.aggregates[id] = true
+	}
+}
+
 // GetTrace returns the events that happened during the tracing.
 func (s *TraceEventStore) GetTrace() []Event {
-	return s.trace
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append(make([]Event, 0, len(s.trace)), s.trace...)
 }
 
 // ResetTrace resets the trace.
 func (s *TraceEventStore) ResetTrace() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	s.trace = make([]Event, 0)
 }
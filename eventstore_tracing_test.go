@@ -1,6 +1,8 @@
 package eventhorizon
 
 import (
+	"sync"
+
 	"github.com/odeke-em/go-uuid"
 	. "gopkg.in/check.v1"
 )
@@ -175,3 +177,35 @@ func (s *TraceEventStoreSuite) Test_ResetTrace(c *C) {
 	trace = s.store.GetTrace()
 	c.Assert(trace, HasLen, 0)
 }
+
+func (s *TraceEventStoreSuite) Test_TraceAggregates(c *C) {
+	event1 := &TestEvent{uuid.New(), "event1"}
+	event2 := &TestEvent{uuid.New(), "event2"}
+	event3 := &TestEvent{event1.TestID, "event3"}
+	s.store.TraceAggregates(event1.TestID)
+	s.store.StartTracing()
+	err := s.store.Save([]Event{event1, event2})
+	c.Assert(err, IsNil)
+	s.store.TraceAggregates()
+	err = s.store.Save([]Event{event2, event3})
+	c.Assert(err, IsNil)
+	s.store.StopTracing()
+	c.Assert(s.store.GetTrace(), DeepEquals, []Event{event1, event2, event3})
+}
+
+func (s *TraceEventStoreSuite) Test_Concurrent(c *C) {
+	// Run with the race detector to find unsafe access.
+	s.store.StartTracing()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			event1 := &TestEvent{uuid.New(), "event1"}
+			c.Check(s.store.Save([]Event{event1}), IsNil)
+			s.store.GetTrace()
+		}()
+	}
+	wg.Wait()
+	c.Assert(s.store.GetTrace(), HasLen, 10)
+}
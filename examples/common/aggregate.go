@@ -38,55 +38,61 @@ func (i *InvitationAggregate) AggregateType() string {
 	return "Invitation"
 }
 
-func (i *InvitationAggregate) HandleCommand(command eventhorizon.Command) error {
-	switch command := command.(type) {
-	case *CreateInvite:
-		i.StoreEvent(&InviteCreated{command.InvitationID, command.EventID, command.Name, command.Age})
-		return nil
+func init() {
+	// Check that the aggregate has a Handle method for the commands set for it.
+	eventhorizon.RegisterRoutes(&InvitationAggregate{})
+}
 
-	case *AcceptInvite:
-		if i.name == "" {
-			return fmt.Errorf("invitee does not exist")
-		}
+// HandleCommand routes commands to the Handle methods of the aggregate.
+func (i *InvitationAggregate) HandleCommand(command eventhorizon.Command) error {
+	return i.RouteCommand(i, command)
+}
 
-		if i.declined {
-			return fmt.Errorf("%s already declined", i.name)
-		}
+func (i *InvitationAggregate) HandleCreateInvite(command *CreateInvite) error {
+	i.StoreEvent(&InviteCreated{command.InvitationID, command.EventID, command.Name, command.Age})
+	return nil
+}
 
-		if i.accepted {
-			return nil
-		}
+func (i *InvitationAggregate) HandleAcceptInvite(command *AcceptInvite) error {
+	if i.declined {
+		return fmt.Errorf("%s already declined", i.name)
+	}
 
-		i.StoreEvent(&InviteAccepted{i.AggregateID()})
+	if i.accepted {
 		return nil
+	}
 
-	case *DeclineInvite:
-		if i.name == "" {
-			return fmt.Errorf("invitee does not exist")
-		}
-
-		if i.accepted {
-			return fmt.Errorf("%s already accepted", i.name)
-		}
+	i.StoreEvent(&InviteAccepted{i.AggregateID()})
+	return nil
+}
 
-		if i.declined {
-			return nil
-		}
+func (i *InvitationAggregate) HandleDeclineInvite(command *DeclineInvite) error {
+	if i.accepted {
+		return fmt.Errorf("%s already accepted", i.name)
+	}
 
-		i.StoreEvent(&InviteDeclined{i.AggregateID()})
+	if i.declined {
 		return nil
 	}
-	return fmt.Errorf("couldn't handle command")
+
+	i.StoreEvent(&InviteDeclined{i.AggregateID()})
+	return nil
 }
 
+// ApplyEvent routes events to the Apply methods of the aggregate.
 func (i *InvitationAggregate) ApplyEvent(event eventhorizon.Event) {
-	switch event := event.(type) {
-	case *InviteCreated:
-		i.name = event.Name
-		i.age = event.Age
-	case *InviteAccepted:
-		i.accepted = true
-	case *InviteDeclined:
-		i.declined = true
-	}
+	i.RouteEvent(i, event)
+}
+
+func (i *InvitationAggregate) ApplyInviteCreated(event *InviteCreated) {
+	i.name = event.Name
+	i.age = event.Age
+}
+
+func (i *InvitationAggregate) ApplyInviteAccepted(event *InviteAccepted) {
+	i.accepted = true
+}
+
+func (i *InvitationAggregate) ApplyInviteDeclined(event *InviteDeclined) {
+	i.declined = true
 }
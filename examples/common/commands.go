@@ -14,6 +14,10 @@
 
 package common
 
+import (
+	"github.com/looplab/eventhorizon"
+)
+
 type CreateInvite struct {
 	InvitationID string
 	EventID      string
@@ -25,6 +29,10 @@ func (c *CreateInvite) AggregateID() string   { return c.InvitationID }
 func (c *CreateInvite) AggregateType() string { return "Invitation" }
 func (c *CreateInvite) CommandType() string   { return "CreateInvite" }
 
+func (c *CreateInvite) AggregateExistence() eventhorizon.AggregateExistence {
+	return eventhorizon.AggregateMustNotExist
+}
+
 type AcceptInvite struct {
 	InvitationID string
 }
@@ -33,6 +41,10 @@ func (c *AcceptInvite) AggregateID() string   { return c.InvitationID }
 func (c *AcceptInvite) AggregateType() string { return "Invitation" }
 func (c *AcceptInvite) CommandType() string   { return "AcceptInvite" }
 
+func (c *AcceptInvite) AggregateExistence() eventhorizon.AggregateExistence {
+	return eventhorizon.AggregateMustExist
+}
+
 type DeclineInvite struct {
 	InvitationID string
 }
@@ -40,3 +52,7 @@ type DeclineInvite struct {
 func (c *DeclineInvite) AggregateID() string   { return c.InvitationID }
 func (c *DeclineInvite) AggregateType() string { return "Invitation" }
 func (c *DeclineInvite) CommandType() string   { return "DeclineInvite" }
+
+func (c *DeclineInvite) AggregateExistence() eventhorizon.AggregateExistence {
+	return eventhorizon.AggregateMustExist
+}
@@ -29,10 +29,10 @@ type Invitation struct {
 // Projector that writes to a read model
 
 type InvitationProjector struct {
-	repository eventhorizon.ReadRepository
+	repository eventhorizon.UpdateReadRepository
 }
 
-func NewInvitationProjector(repository eventhorizon.ReadRepository) *InvitationProjector {
+func NewInvitationProjector(repository eventhorizon.UpdateReadRepository) *InvitationProjector {
 	p := &InvitationProjector{
 		repository: repository,
 	}
@@ -50,33 +50,25 @@ func (p *InvitationProjector) HandleEvent(event eventhorizon.Event) {
 			log.Fatalf("Unable to save event for invitation created: %s", err)
 		}
 	case *InviteAccepted:
-		m, err := p.repository.Find(event.InvitationID)
+		err := p.repository.Update(event.InvitationID,
+			eventhorizon.FieldUpdate{Field: "status", Op: eventhorizon.UpdateSet, Value: "accepted"})
 		if err != nil {
-			log.Fatalf("Unable to find model for invite accepted: %s", err)
-		}
-		i := m.(*Invitation)
-		i.Status = "accepted"
-		if err := p.repository.Save(i.ID, i); err != nil {
 			log.Fatalf("Unable to save invite accepted event: %s", err)
 		}
 	case *InviteDeclined:
-		m, err := p.repository.Find(event.InvitationID)
+		err := p.repository.Update(event.InvitationID,
+			eventhorizon.FieldUpdate{Field: "status", Op: eventhorizon.UpdateSet, Value: "declined"})
 		if err != nil {
-			log.Fatalf("Unable to find model for invite declined: %s", err)
-		}
-		i := m.(*Invitation)
-		i.Status = "declined"
-		if err := p.repository.Save(i.ID, i); err != nil {
 			log.Fatalf("Unable to save invite declined event: %s", err)
 		}
 	}
 }
 
 type GuestList struct {
-	ID          string `json:"id"`
-	NumGuests   int    `json:"num_guests"`
-	NumAccepted int    `json:"num_accepted"`
-	NumDeclined int    `json:"num_declined"`
+	ID          string `json:"id" bson:"id"`
+	NumGuests   int    `json:"num_guests" bson:"num_guests"`
+	NumAccepted int    `json:"num_accepted" bson:"num_accepted"`
+	NumDeclined int    `json:"num_declined" bson:"num_declined"`
 }
 
 // Projector that writes to a read model
@@ -84,12 +76,12 @@ type GuestList struct {
 // GuestListProjector projects guest lists. Note, it currently only works for
 // one guest list.
 type GuestListProjector struct {
-	repository eventhorizon.ReadRepository
+	repository eventhorizon.UpdateReadRepository
 	eventID    string
 }
 
 // NewGuestListProjector creates a new GuestListProjector.
-func NewGuestListProjector(repository eventhorizon.ReadRepository, eventID string) *GuestListProjector {
+func NewGuestListProjector(repository eventhorizon.UpdateReadRepository, eventID string) *GuestListProjector {
 	p := &GuestListProjector{
 		repository: repository,
 		eventID:    eventID,
@@ -116,23 +108,15 @@ func (p *GuestListProjector) HandleEvent(event eventhorizon.Event) {
 			log.Fatalf("guest list: unable to save event: %s", err)
 		}
 	case *InviteAccepted:
-		m, err := p.repository.Find(p.eventID)
+		err := p.repository.Update(p.eventID,
+			eventhorizon.FieldUpdate{Field: "num_accepted", Op: eventhorizon.UpdateInc, Value: 1})
 		if err != nil {
-			log.Fatalf("guest list: unable to find model for invite accepted: %s", err)
-		}
-		g := m.(*GuestList)
-		g.NumAccepted++
-		if err := p.repository.Save(p.eventID, g); err != nil {
 			log.Fatalf("guest list: unable to save event: %s", err)
 		}
 	case *InviteDeclined:
-		m, err := p.repository.Find(p.eventID)
+		err := p.repository.Update(p.eventID,
+			eventhorizon.FieldUpdate{Field: "num_declined", Op: eventhorizon.UpdateInc, Value: 1})
 		if err != nil {
-			log.Fatalf("guest list: unable to find model for invite declined: %s", err)
-		}
-		g := m.(*GuestList)
-		g.NumDeclined++
-		if err := p.repository.Save(p.eventID, g); err != nil {
 			log.Fatalf("guest list: unable to save event: %s", err)
 		}
 	}
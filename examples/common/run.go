@@ -13,7 +13,7 @@ import (
 type NewEventStoreFunc func() (eventhorizon.EventStore, error)
 
 // NewReadRepositoryFunc creates a new ReadRepository
-type NewReadRepositoryFunc func(string) (eventhorizon.ReadRepository, error)
+type NewReadRepositoryFunc func(string) (eventhorizon.UpdateReadRepository, error)
 
 // Run runs the test scenario with the given EventStore and CommandBus.
 // EventStores and ReadRepositories are created as needed with the given functions.
@@ -29,7 +29,7 @@ func main() {
 		return eventhorizon.NewMemoryEventStore(eventBus), nil
 	}
 
-	newReadRepository := func(app string) (eventhorizon.ReadRepository, error) {
+	newReadRepository := func(app string) (eventhorizon.UpdateReadRepository, error) {
 		return eventhorizon.NewMemoryReadRepository(), nil
 	}
 
@@ -33,7 +33,7 @@ func main() {
 		return eventhorizon.NewMongoEventStore(eventBus, addr, db)
 	}
 
-	newReadRepository := func(name string) (eventhorizon.ReadRepository, error) {
+	newReadRepository := func(name string) (eventhorizon.UpdateReadRepository, error) {
 		return eventhorizon.NewMongoReadRepository(addr, db, name)
 	}
 
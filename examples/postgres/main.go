@@ -11,6 +11,7 @@ import (
 
 func main() {
 	lager.SetLevels(lager.LevelsFromString(os.Getenv("LOG_LEVELS")))
+	logger := eventhorizon.NewLagerLogger(lager.Child())
 
 	var eventBus eventhorizon.EventBus
 	var commandBus eventhorizon.CommandBus
@@ -20,6 +21,7 @@ func main() {
 			log.Fatalln("Unable to create rabbitmq event bus:", err)
 		}
 		defer remoteEventBus.Close()
+		remoteEventBus.SetLogger(logger)
 		eventBus = remoteEventBus
 
 		remoteCommandBus, err := eventhorizon.NewRabbitMQCommandBus(uri, "test", "test")
@@ -27,6 +29,7 @@ func main() {
 			log.Fatalln("Unable to create rabbitmq command bus:", err)
 		}
 		defer remoteEventBus.Close()
+		remoteCommandBus.SetLogger(logger)
 		commandBus = remoteCommandBus
 	} else {
 		eventBus = eventhorizon.NewInternalEventBus()
@@ -36,11 +39,21 @@ func main() {
 	conn := os.Getenv("POSTGRES_URL")
 
 	newEventStore := func() (eventhorizon.EventStore, error) {
-		return eventhorizon.NewPostgresEventStore(eventBus, conn)
+		eventStore, err := eventhorizon.NewPostgresEventStore(eventBus, conn)
+		if err != nil {
+			return nil, err
+		}
+		eventStore.SetLogger(logger)
+		return eventStore, nil
 	}
 
-	newReadRepository := func(name string) (eventhorizon.ReadRepository, error) {
-		return eventhorizon.NewPostgresReadRepository(conn, name)
+	newReadRepository := func(name string) (eventhorizon.UpdateReadRepository, error) {
+		readRepository, err := eventhorizon.NewPostgresReadRepository(conn, name)
+		if err != nil {
+			return nil, err
+		}
+		readRepository.SetLogger(logger)
+		return readRepository, nil
 	}
 
 	common.Run(eventBus, commandBus, newEventStore, newReadRepository)
@@ -0,0 +1,145 @@
+package eventhorizon
+
+import (
+	"sync/atomic"
+
+	"github.com/doubledutch/lager"
+)
+
+// Logger is a structured logger used by all components. Components log
+// nothing until a logger is set with their SetLogger method, except the
+// Postgres and RabbitMQ components and the RedisEventBus, which log to lager
+// like earlier versions did.
+//
+// Fields are added with With and WithError, which return a new logger. The
+// fields used by the components are "commandType", "eventType",
+// "aggregateID" and "aggregateType".
+//
+// An example would be:
+//     logger.With(map[string]string{"eventType": event.EventType()}).
+//         WithError(err).Errorf("Unable to publish event")
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+
+	// With returns a logger with additional fields.
+	With(fields map[string]string) Logger
+
+	// WithError returns a logger with an error field.
+	WithError(err error) Logger
+}
+
+// NopLogger is a Logger that discards everything, it is the default of the
+// components that do not log to lager. It can be set to silence the others.
+type NopLogger struct{}
+
+// Debugf implements the Debugf method of the Logger interface.
+func (NopLogger) Debugf(format string, args ...interface{}) {}
+
+// Infof implements the Infof method of the Logger interface.
+func (NopLogger) Infof(format string, args ...interface{}) {}
+
+// Warnf implements the Warnf method of the Logger interface.
+func (NopLogger) Warnf(format string, args ...interface{}) {}
+
+// Errorf implements the Errorf method of the Logger interface.
+func (NopLogger) Errorf(format string, args ...interface{}) {}
+
+// With implements the With method of the Logger interface.
+func (l NopLogger) With(fields map[string]string) Logger { return l }
+
+// WithError implements the WithError method of the Logger interface.
+func (l NopLogger) WithError(err error) Logger { return l }
+
+// NewLagerLogger creates a Logger that logs to a lager.ContextLager.
+//
+// An example would be:
+//     bus.SetLogger(NewLagerLogger(lager.Child()))
+func NewLagerLogger(lgr lager.ContextLager) Logger {
+	return lagerLogger{lgr}
+}
+
+type lagerLogger struct {
+	lgr lager.ContextLager
+}
+
+// Debugf implements the Debugf method of the Logger interface.
+func (l lagerLogger) Debugf(format string, args ...interface{}) {
+	l.lgr.Debugf(format, args...)
+}
+
+// Infof implements the Infof method of the Logger interface.
+func (l lagerLogger) Infof(format string, args ...interface{}) {
+	l.lgr.Infof(format, args...)
+}
+
+// Warnf implements the Warnf method of the Logger interface.
+func (l lagerLogger) Warnf(format string, args ...interface{}) {
+	l.lgr.Warnf(format, args...)
+}
+
+// Errorf implements the Errorf method of the Logger interface.
+func (l lagerLogger) Errorf(format string, args ...interface{}) {
+	l.lgr.Errorf(format, args...)
+}
+
+// With implements the With method of the Logger interface.
+func (l lagerLogger) With(fields map[string]string) Logger {
+	return lagerLogger{l.lgr.With(fields)}
+}
+
+// WithError implements the WithError method of the Logger interface.
+func (l lagerLogger) WithError(err error) Logger {
+	return lagerLogger{l.lgr.WithError(err)}
+}
+
+// logging holds the logger of a component, which can be set while the
+// component is in use. It is embedded to add a SetLogger method.
+type logging struct {
+	value atomic.Value
+}
+
+// loggerValue wraps loggers, atomic.Value needs values of the same type.
+type loggerValue struct {
+	Logger
+}
+
+// SetLogger sets the logger, the default is a NopLogger or a lager logger,
+// see Logger.
+func (l *logging) SetLogger(logger Logger) {
+	l.value.Store(loggerValue{logger})
+}
+
+// logToLager sets a logger of lager.Child, the default of the components
+// that logged to lager before they had a Logger.
+func (l *logging) logToLager() {
+	l.SetLogger(NewLagerLogger(lager.Child()))
+}
+
+// logger returns the logger.
+func (l *logging) logger() Logger {
+	if v, ok := l.value.Load().(loggerValue); ok {
+		return v.Logger
+	}
+	return NopLogger{}
+}
+
+// eventFields returns the log fields of an event.
+func eventFields(event Event) map[string]string {
+	return map[string]string{
+		"eventType":     event.EventType(),
+		"aggregateID":   event.AggregateID(),
+		"aggregateType": event.AggregateType(),
+	}
+}
+
+// commandFields returns the log fields of a command.
+func commandFields(command Command) map[string]string {
+	return map[string]string{
+		"commandType":   command.CommandType(),
+		"aggregateID":   command.AggregateID(),
+		"aggregateType": command.AggregateType(),
+	}
+}
@@ -0,0 +1,134 @@
+package eventhorizon
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/doubledutch/lager"
+	"github.com/odeke-em/go-uuid"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&LoggerSuite{})
+
+type LoggerSuite struct{}
+
+// mockLogger records log entries, with their fields, for tests.
+type mockLogger struct {
+	fields  map[string]string
+	entries *[]mockLogEntry
+	lock    *sync.Mutex
+}
+
+type mockLogEntry struct {
+	level   string
+	message string
+	fields  map[string]string
+}
+
+func newMockLogger() *mockLogger {
+	return &mockLogger{
+		fields:  map[string]string{},
+		entries: &[]mockLogEntry{},
+		lock:    &sync.Mutex{},
+	}
+}
+
+func (l *mockLogger) log(level, format string, args ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	*l.entries = append(*l.entries, mockLogEntry{level, fmt.Sprintf(format, args...), l.fields})
+}
+
+func (l *mockLogger) Debugf(format string, args ...interface{}) { l.log("debug", format, args...) }
+func (l *mockLogger) Infof(format string, args ...interface{})  { l.log("info", format, args...) }
+func (l *mockLogger) Warnf(format string, args ...interface{})  { l.log("warn", format, args...) }
+func (l *mockLogger) Errorf(format string, args ...interface{}) { l.log("error", format, args...) }
+
+func (l *mockLogger) With(fields map[string]string) Logger {
+	f := make(map[string]string)
+	for k, v := range l.fields {
+		f[k] = v
+	}
+	for k, v := range fields {
+		f[k] = v
+	}
+	return &mockLogger{f, l.entries, l.lock}
+}
+
+func (l *mockLogger) WithError(err error) Logger {
+	return l.With(map[string]string{"error": err.Error()})
+}
+
+func (l *mockLogger) Entries() []mockLogEntry {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]mockLogEntry(nil), *l.entries...)
+}
+
+func (s *LoggerSuite) TestNopLogger(c *C) {
+	var l Logger = NopLogger{}
+	l = l.With(map[string]string{"eventType": "TestEvent"}).WithError(errors.New("error"))
+	l.Errorf("Unable to publish event")
+	c.Assert(l, Equals, NopLogger{})
+}
+
+func (s *LoggerSuite) TestLagerLogger(c *C) {
+	l := NewLagerLogger(lager.Child())
+	l = l.With(map[string]string{"eventType": "TestEvent"}).WithError(errors.New("error"))
+	c.Assert(l, FitsTypeOf, lagerLogger{})
+	l.Debugf("Debug %d", 1)
+}
+
+func (s *LoggerSuite) TestSetLogger(c *C) {
+	var l logging
+	c.Assert(l.logger(), Equals, NopLogger{})
+	logger := newMockLogger()
+	l.SetLogger(logger)
+	c.Assert(l.logger(), Equals, logger)
+}
+
+func (s *LoggerSuite) TestLogToLager(c *C) {
+	var l logging
+	l.logToLager()
+	c.Assert(l.logger(), FitsTypeOf, lagerLogger{})
+	l.SetLogger(NopLogger{})
+	c.Assert(l.logger(), Equals, NopLogger{})
+}
+
+func (s *LoggerSuite) TestCommandHandler(c *C) {
+	repo := &MockRepository{
+		aggregates: make(map[string]Aggregate),
+	}
+	handler, _ := NewAggregateCommandHandler(repo)
+	logger := newMockLogger()
+	handler.SetLogger(logger)
+	aggregate := &TestDispatcherAggregate{
+		AggregateBase: NewAggregateBase(uuid.New()),
+	}
+	repo.aggregates[aggregate.AggregateID()] = aggregate
+	handler.SetAggregate(aggregate, &TestCommand{})
+
+	// Nothing is written to stdout.
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	c.Assert(err, IsNil)
+	os.Stdout = w
+	err = handler.HandleCommand(&TestCommand{aggregate.AggregateID(), "command1"})
+	os.Stdout = stdout
+	w.Close()
+	c.Assert(err, IsNil)
+	out, _ := ioutil.ReadAll(r)
+	c.Assert(string(out), Equals, "")
+
+	c.Assert(logger.Entries(), DeepEquals, []mockLogEntry{
+		{"debug", "Handling command", map[string]string{
+			"commandType":   "TestCommand",
+			"aggregateID":   aggregate.AggregateID(),
+			"aggregateType": "Test",
+		}},
+	})
+}
@@ -0,0 +1,61 @@
+package eventhorizon
+
+import "container/list"
+
+// lruCache keeps a number of values, the least recently used value is
+// removed when a value is added to a full cache. It is not safe for
+// concurrent use.
+type lruCache struct {
+	size  int
+	list  *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		list:  list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns the value of a key and marks it as recently used.
+func (c *lruCache) get(key string) (interface{}, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.list.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+// add adds or replaces the value of a key.
+func (c *lruCache) add(key string, value interface{}) {
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruEntry).value = value
+		c.list.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.list.PushFront(&lruEntry{key, value})
+	if c.list.Len() > c.size {
+		c.remove(c.list.Back().Value.(*lruEntry).key)
+	}
+}
+
+// remove removes the value of a key, if any.
+func (c *lruCache) remove(key string) {
+	if e, ok := c.items[key]; ok {
+		c.list.Remove(e)
+		delete(c.items, key)
+	}
+}
+
+// len returns the number of values.
+func (c *lruCache) len() int {
+	return c.list.Len()
+}
@@ -0,0 +1,145 @@
+package eventhorizon
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics receives measurements from the components, which report nothing
+// until metrics are set with their SetMetrics method. See PrometheusMetrics.
+//
+// Components are named like "aggregate_command_handler", "rabbitmq_event_bus"
+// or "postgres_event_store". Outcomes are "ok" or "error".
+type Metrics interface {
+	// ObserveCommand is called when a command bus or command handler has
+	// handled a command.
+	ObserveCommand(component, commandType, outcome string, duration time.Duration)
+
+	// ObserveEventDispatch is called when an event bus has passed an event to
+	// its handlers.
+	ObserveEventDispatch(component, eventType string, duration time.Duration)
+
+	// ObserveEventStore is called when an event store has saved or loaded
+	// events, or loaded the version of an aggregate. The operation is "save",
+	// "load" or "version".
+	ObserveEventStore(component, operation, outcome string, duration time.Duration)
+
+	// ObserveConsumerLag is called when a message has been received from a
+	// queue, with the time since it was published.
+	ObserveConsumerLag(component, messageType string, lag time.Duration)
+}
+
+// NopMetrics is a Metrics that discards everything, it is the default of all
+// components.
+type NopMetrics struct{}
+
+// ObserveCommand implements the ObserveCommand method of the Metrics
+// interface.
+func (NopMetrics) ObserveCommand(component, commandType, outcome string, duration time.Duration) {}
+
+// ObserveEventDispatch implements the ObserveEventDispatch method of the
+// Metrics interface.
+func (NopMetrics) ObserveEventDispatch(component, eventType string, duration time.Duration) {}
+
+// ObserveEventStore implements the ObserveEventStore method of the Metrics
+// interface.
+func (NopMetrics) ObserveEventStore(component, operation, outcome string, duration time.Duration) {}
+
+// ObserveConsumerLag implements the ObserveConsumerLag method of the Metrics
+// interface.
+func (NopMetrics) ObserveConsumerLag(component, messageType string, lag time.Duration) {}
+
+// instrumentation holds the metrics and tracer of a component, which can be
+// set while the component is in use. It is embedded to add SetMetrics and
+// SetTracer methods.
+type instrumentation struct {
+	currentMetrics atomic.Value
+	currentTracer  atomic.Value
+}
+
+// metricsValue wraps metrics, atomic.Value needs values of the same type.
+type metricsValue struct {
+	Metrics
+}
+
+// SetMetrics sets the metrics, the default is NopMetrics.
+func (i *instrumentation) SetMetrics(metrics Metrics) {
+	i.currentMetrics.Store(metricsValue{metrics})
+}
+
+// metrics returns the metrics.
+func (i *instrumentation) metrics() Metrics {
+	if v, ok := i.currentMetrics.Load().(metricsValue); ok {
+		return v.Metrics
+	}
+	return NopMetrics{}
+}
+
+// observeCommand starts observing the handling of a command, as a child of
+// parent. It returns the context of its span and a function that ends it with
+// the error that *err has when it is called, typically deferred:
+//     context, done := b.observeCommand("internal_command_bus", parent, command)
+//     defer done(&err)
+func (i *instrumentation) observeCommand(component string, parent SpanContext, command Command) (SpanContext, func(*error)) {
+	start := time.Now()
+	span := i.startSpan("handle_command", parent,
+		spanAttributes(component, commandFields(command)))
+	return span.Context(), func(err *error) {
+		span.end(err)
+		i.metrics().ObserveCommand(component, command.CommandType(), outcome(*err), time.Since(start))
+	}
+}
+
+// observeEventStore starts observing an event store operation on the events
+// of an aggregate, as a child of parent. It returns the context of its span
+// and a function that ends it with the error that *err has when it is called,
+// typically deferred. Loading an aggregate without events, or the version
+// from a decorated store that is not versioned, is not an error. The span is
+// named after the operation, like "load_events" or "version_events".
+func (i *instrumentation) observeEventStore(component string, parent SpanContext, operation, aggregateID string) (SpanContext, func(*error)) {
+	start := time.Now()
+	span := i.startSpan(operation+"_events", parent,
+		spanAttributes(component, map[string]string{"aggregateID": aggregateID}))
+	return span.Context(), func(err *error) {
+		e := *err
+		if e == ErrNoEventsFound || e == ErrEventStoreNotVersioned {
+			e = nil
+		}
+		span.end(&e)
+		i.metrics().ObserveEventStore(component, operation, outcome(e), time.Since(start))
+	}
+}
+
+// eventsAggregateID returns the aggregate id of the first event, if any.
+func eventsAggregateID(events []Event) string {
+	if len(events) == 0 {
+		return ""
+	}
+	return events[0].AggregateID()
+}
+
+// dispatchEvent passes an event to handlers, in order, and observes the time
+// it takes. Every handler has a span, as a child of parent.
+func (i *instrumentation) dispatchEvent(component string, event Event, parent SpanContext, handlers []EventHandler) {
+	if len(handlers) == 0 {
+		return
+	}
+	start := time.Now()
+	for _, handler := range handlers {
+		attributes := spanAttributes(component, eventFields(event))
+		attributes["handler"] = fmt.Sprintf("%T", handler)
+		span := i.startSpan("handle_event", parent, attributes)
+		handler.HandleEvent(event)
+		span.end(nil)
+	}
+	i.metrics().ObserveEventDispatch(component, event.EventType(), time.Since(start))
+}
+
+// outcome returns the outcome label of an error.
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
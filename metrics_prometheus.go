@@ -0,0 +1,174 @@
+package eventhorizon
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prometheusBuckets are the upper bounds of the histogram buckets, in
+// seconds, the same as the default of the Prometheus client libraries.
+var prometheusBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is a Metrics that keeps histograms of the measurements,
+// labeled by component, type and outcome. It is an http.Handler that serves
+// them in the Prometheus text format.
+//
+// An example would be:
+//     metrics := NewPrometheusMetrics("eventhorizon")
+//     commandHandler.SetMetrics(metrics)
+//     eventStore.SetMetrics(metrics)
+//     http.Handle("/metrics", metrics)
+type PrometheusMetrics struct {
+	commands   *prometheusHistogram
+	dispatches *prometheusHistogram
+	stores     *prometheusHistogram
+	lags       *prometheusHistogram
+}
+
+// NewPrometheusMetrics creates a PrometheusMetrics with metric names prefixed
+// by namespace.
+func NewPrometheusMetrics(namespace string) *PrometheusMetrics {
+	name := func(n string) string {
+		if namespace == "" {
+			return n
+		}
+		return namespace + "_" + n
+	}
+	return &PrometheusMetrics{
+		commands: newPrometheusHistogram(name("command_duration_seconds"),
+			"Time to handle commands.", "component", "command_type", "outcome"),
+		dispatches: newPrometheusHistogram(name("event_dispatch_duration_seconds"),
+			"Time to pass events to the handlers of event buses.", "component", "event_type"),
+		stores: newPrometheusHistogram(name("event_store_duration_seconds"),
+			"Time to save and load events.", "component", "operation", "outcome"),
+		lags: newPrometheusHistogram(name("consumer_lag_seconds"),
+			"Time from publishing to receiving queued messages.", "component", "message_type"),
+	}
+}
+
+// ObserveCommand implements the ObserveCommand method of the Metrics
+// interface.
+func (m *PrometheusMetrics) ObserveCommand(component, commandType, outcome string, duration time.Duration) {
+	m.commands.observe(duration.Seconds(), component, commandType, outcome)
+}
+
+// ObserveEventDispatch implements the ObserveEventDispatch method of the
+// Metrics interface.
+func (m *PrometheusMetrics) ObserveEventDispatch(component, eventType string, duration time.Duration) {
+	m.dispatches.observe(duration.Seconds(), component, eventType)
+}
+
+// ObserveEventStore implements the ObserveEventStore method of the Metrics
+// interface.
+func (m *PrometheusMetrics) ObserveEventStore(component, operation, outcome string, duration time.Duration) {
+	m.stores.observe(duration.Seconds(), component, operation, outcome)
+}
+
+// ObserveConsumerLag implements the ObserveConsumerLag method of the Metrics
+// interface.
+func (m *PrometheusMetrics) ObserveConsumerLag(component, messageType string, lag time.Duration) {
+	m.lags.observe(lag.Seconds(), component, messageType)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var b bytes.Buffer
+	for _, h := range []*prometheusHistogram{m.commands, m.dispatches, m.stores, m.lags} {
+		h.write(&b)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// prometheusHistogram is a histogram with a series per set of label values.
+type prometheusHistogram struct {
+	name   string
+	help   string
+	labels []string
+	series map[string]*prometheusSeries
+	lock   sync.Mutex
+}
+
+type prometheusSeries struct {
+	values  []string
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func newPrometheusHistogram(name, help string, labels ...string) *prometheusHistogram {
+	return &prometheusHistogram{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*prometheusSeries),
+	}
+}
+
+// observe adds a value to the series of the label values.
+func (h *prometheusHistogram) observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &prometheusSeries{
+			values:  labelValues,
+			buckets: make([]uint64, len(prometheusBuckets)),
+		}
+		h.series[key] = s
+	}
+	for i, upper := range prometheusBuckets {
+		if value <= upper {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// write writes the histogram in the Prometheus text format, with the series
+// sorted by their label values.
+func (h *prometheusHistogram) write(w io.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", h.name, h.help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		labels := make([]string, len(h.labels))
+		for i, label := range h.labels {
+			labels[i] = label + `="` + prometheusLabelEscaper.Replace(s.values[i]) + `"`
+		}
+		l := strings.Join(labels, ",")
+
+		for i, upper := range prometheusBuckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", h.name, l, formatFloat(upper), s.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", h.name, l, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, l, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, l, s.count)
+	}
+}
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,150 @@
+package eventhorizon
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/odeke-em/go-uuid"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&MetricsSuite{})
+
+type MetricsSuite struct{}
+
+// mockMetrics records the observations, without durations, for tests.
+type mockMetrics struct {
+	observations []string
+	lock         sync.Mutex
+}
+
+func (m *mockMetrics) observe(values ...string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.observations = append(m.observations, strings.Join(values, " "))
+}
+
+func (m *mockMetrics) ObserveCommand(component, commandType, outcome string, duration time.Duration) {
+	m.observe("command", component, commandType, outcome)
+}
+
+func (m *mockMetrics) ObserveEventDispatch(component, eventType string, duration time.Duration) {
+	m.observe("dispatch", component, eventType)
+}
+
+func (m *mockMetrics) ObserveEventStore(component, operation, outcome string, duration time.Duration) {
+	m.observe("store", component, operation, outcome)
+}
+
+func (m *mockMetrics) ObserveConsumerLag(component, messageType string, lag time.Duration) {
+	m.observe("lag", component, messageType)
+}
+
+func (m *mockMetrics) Observations() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]string(nil), m.observations...)
+}
+
+func (s *MetricsSuite) TestSetMetrics(c *C) {
+	var i instrumentation
+	c.Assert(i.metrics(), Equals, NopMetrics{})
+	metrics := &mockMetrics{}
+	i.SetMetrics(metrics)
+	c.Assert(i.metrics(), Equals, metrics)
+}
+
+func (s *MetricsSuite) TestCommandHandler(c *C) {
+	repo := &MockRepository{
+		aggregates: make(map[string]Aggregate),
+	}
+	handler, _ := NewAggregateCommandHandler(repo)
+	aggregate := &TestDispatcherAggregate{
+		AggregateBase: NewAggregateBase(uuid.New()),
+	}
+	repo.aggregates[aggregate.AggregateID()] = aggregate
+	handler.SetAggregate(aggregate, &TestCommand{})
+
+	bus := NewInternalCommandBus()
+	bus.SetHandler(handler, &TestCommand{})
+
+	metrics := &mockMetrics{}
+	handler.SetMetrics(metrics)
+	bus.SetMetrics(metrics)
+
+	err := bus.HandleCommand(&TestCommand{aggregate.AggregateID(), "command1"})
+	c.Assert(err, IsNil)
+	err = bus.HandleCommand(&TestCommand{aggregate.AggregateID(), ""})
+	c.Assert(err, NotNil)
+	err = bus.HandleCommand(&TestCommandOther{aggregate.AggregateID(), "command2"})
+	c.Assert(err, Equals, ErrHandlerNotFound)
+	c.Assert(metrics.Observations(), DeepEquals, []string{
+		"command aggregate_command_handler TestCommand ok",
+		"command internal_command_bus TestCommand ok",
+		"command aggregate_command_handler TestCommand error",
+		"command internal_command_bus TestCommand error",
+		"command internal_command_bus TestCommandOther error",
+	})
+}
+
+func (s *MetricsSuite) TestEventStore(c *C) {
+	store := NewMemoryEventStore(nil)
+	metrics := &mockMetrics{}
+	store.SetMetrics(metrics)
+
+	id := uuid.New()
+	_, err := store.Load(id)
+	c.Assert(err, Equals, ErrNoEventsFound)
+	err = store.Save([]Event{&TestEvent{id, "event1"}})
+	c.Assert(err, IsNil)
+	err = store.Save([]Event{})
+	c.Assert(err, Equals, ErrNoEventsToAppend)
+	c.Assert(metrics.Observations(), DeepEquals, []string{
+		"store memory_event_store load ok",
+		"store memory_event_store save ok",
+		"store memory_event_store save error",
+	})
+}
+
+func (s *MetricsSuite) TestEventBus(c *C) {
+	bus := NewInternalEventBus()
+	metrics := &mockMetrics{}
+	bus.SetMetrics(metrics)
+
+	// Events without handlers are not observed.
+	bus.PublishEvent(&TestEvent{uuid.New(), "event1"})
+	bus.AddHandler(NewMockEventHandler(), &TestEvent{})
+	bus.PublishEvent(&TestEvent{uuid.New(), "event2"})
+	c.Assert(metrics.Observations(), DeepEquals, []string{
+		"dispatch internal_event_bus TestEvent",
+	})
+}
+
+func (s *MetricsSuite) TestPrometheusMetrics(c *C) {
+	metrics := NewPrometheusMetrics("eh")
+	metrics.ObserveCommand("internal_command_bus", "TestCommand", "ok", 20*time.Millisecond)
+	metrics.ObserveCommand("internal_command_bus", "TestCommand", "ok", 2*time.Second)
+	metrics.ObserveEventStore("memory_event_store", "load", "error", time.Millisecond)
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	c.Assert(w.Header().Get("Content-Type"), Equals, "text/plain; version=0.0.4; charset=utf-8")
+	out := w.Body.String()
+	for _, line := range []string{
+		"# HELP eh_command_duration_seconds Time to handle commands.",
+		"# TYPE eh_command_duration_seconds histogram",
+		`eh_command_duration_seconds_bucket{component="internal_command_bus",command_type="TestCommand",outcome="ok",le="0.01"} 0`,
+		`eh_command_duration_seconds_bucket{component="internal_command_bus",command_type="TestCommand",outcome="ok",le="0.025"} 1`,
+		`eh_command_duration_seconds_bucket{component="internal_command_bus",command_type="TestCommand",outcome="ok",le="2.5"} 2`,
+		`eh_command_duration_seconds_bucket{component="internal_command_bus",command_type="TestCommand",outcome="ok",le="+Inf"} 2`,
+		`eh_command_duration_seconds_sum{component="internal_command_bus",command_type="TestCommand",outcome="ok"} 2.02`,
+		`eh_command_duration_seconds_count{component="internal_command_bus",command_type="TestCommand",outcome="ok"} 2`,
+		"# TYPE eh_event_dispatch_duration_seconds histogram",
+		`eh_event_store_duration_seconds_count{component="memory_event_store",operation="load",outcome="error"} 1`,
+		"# TYPE eh_consumer_lag_seconds histogram",
+	} {
+		c.Assert(strings.Contains(out, line+"\n"), Equals, true, Commentf("missing line: %s", line))
+	}
+}
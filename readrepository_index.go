@@ -0,0 +1,96 @@
+package eventhorizon
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// ErrInvalidIndex returned when an index has an invalid name or fields.
+var ErrInvalidIndex = errors.New("invalid index")
+
+// Index is a secondary index on one or more fields of the read models.
+//
+// Fields are named like in a Filter, with the JSON name for the Postgres
+// repository and the BSON name for the MongoDB repository, and nested fields
+// separated by dots.
+type Index struct {
+	// Name identifies the index, it must be lower case letters, digits or
+	// underscores.
+	Name string
+
+	// Fields are the indexed fields, in order.
+	Fields []string
+
+	// Unique prevents two models from having the same values for the fields.
+	Unique bool
+
+	// GIN indexes the contents of a single array or object field, or of
+	// the whole model if there are no fields. It is a GIN index in Postgres
+	// and a regular (multikey) index in MongoDB.
+	GIN bool
+}
+
+// IndexedReadRepository is a read repository with secondary indexes.
+type IndexedReadRepository interface {
+	ReadRepository
+
+	// SetIndexes creates the declared indexes and drops the indexes that
+	// were created by an earlier declaration but are no longer declared, or
+	// have been changed.
+	//
+	// An example would be:
+	//     repository.SetIndexes([]Index{
+	//         {Name: "email", Fields: []string{"email"}, Unique: true},
+	//         {Name: "city", Fields: []string{"address.city"}},
+	//     })
+	SetIndexes([]Index) error
+}
+
+// validate checks the name and fields of an index.
+func (i Index) validate() error {
+	if i.Name == "" {
+		return ErrInvalidIndex
+	}
+	for _, c := range i.Name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			return ErrInvalidIndex
+		}
+	}
+	if len(i.Fields) == 0 && !i.GIN {
+		return ErrInvalidIndex
+	}
+	if i.GIN && (len(i.Fields) > 1 || i.Unique) {
+		return ErrInvalidIndex
+	}
+	for _, f := range i.Fields {
+		if f == "" {
+			return ErrInvalidIndex
+		}
+	}
+	return nil
+}
+
+// key returns the name of the index followed by a hash of its declaration,
+// which makes a changed index get a new name.
+func (i Index) key() string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s|%t|%t", strings.Join(i.Fields, ","), i.Unique, i.GIN)
+	return fmt.Sprintf("%s_%08x", i.Name, h.Sum32())
+}
+
+// validateIndexes checks a list of indexes, and that the names are unique.
+func validateIndexes(indexes []Index) error {
+	names := make(map[string]bool)
+	for _, i := range indexes {
+		if err := i.validate(); err != nil {
+			return err
+		}
+		if names[i.Name] {
+			return ErrInvalidIndex
+		}
+		names[i.Name] = true
+	}
+	return nil
+}
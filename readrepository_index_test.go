@@ -0,0 +1,58 @@
+package eventhorizon
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&IndexSuite{})
+
+type IndexSuite struct{}
+
+func (s *IndexSuite) Test_Validate(c *C) {
+	c.Assert(validateIndexes([]Index{
+		{Name: "name_1", Fields: []string{"name", "address.city"}},
+		{Name: "tags", Fields: []string{"tags"}, GIN: true},
+		{Name: "all", GIN: true},
+	}), IsNil)
+
+	for _, i := range []Index{
+		{Fields: []string{"name"}},
+		{Name: "Name", Fields: []string{"name"}},
+		{Name: "name-1", Fields: []string{"name"}},
+		{Name: "name"},
+		{Name: "name", Fields: []string{""}},
+		{Name: "tags", Fields: []string{"tags", "name"}, GIN: true},
+		{Name: "tags", Fields: []string{"tags"}, GIN: true, Unique: true},
+	} {
+		c.Assert(validateIndexes([]Index{i}), Equals, ErrInvalidIndex, Commentf("%#v", i))
+	}
+
+	c.Assert(validateIndexes([]Index{
+		{Name: "name", Fields: []string{"name"}},
+		{Name: "name", Fields: []string{"age"}},
+	}), Equals, ErrInvalidIndex)
+}
+
+func (s *IndexSuite) Test_Key(c *C) {
+	i := Index{Name: "name", Fields: []string{"name"}}
+	c.Assert(strings.HasPrefix(i.key(), "name_"), Equals, true)
+	c.Assert(i.key(), Equals, Index{Name: "name", Fields: []string{"name"}}.key())
+
+	unique := i
+	unique.Unique = true
+	c.Assert(unique.key(), Not(Equals), i.key())
+	c.Assert(Index{Name: "name", Fields: []string{"age"}}.key(), Not(Equals), i.key())
+}
+
+// countPrefix counts the strings with a prefix.
+func countPrefix(names []string, prefix string) int {
+	n := 0
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) {
+			n++
+		}
+	}
+	return n
+}
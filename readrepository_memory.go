@@ -1,50 +1,404 @@
 package eventhorizon
 
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
 // MemoryReadRepository implements an in memory repository of read models.
+// It is safe for concurrent use. Models are copied when saved and returned,
+// so changing a model does not change the stored one until it is saved.
 type MemoryReadRepository struct {
-	data map[string]interface{}
+	data     map[string]interface{}
+	versions map[string]int
+	mu       sync.RWMutex
 }
 
 // NewMemoryReadRepository creates a new MemoryReadRepository.
 func NewMemoryReadRepository() *MemoryReadRepository {
 	r := &MemoryReadRepository{
-		data: make(map[string]interface{}),
+		data:     make(map[string]interface{}),
+		versions: make(map[string]int),
 	}
 	return r
 }
 
 // Save saves a read model with id to the repository.
 func (r *MemoryReadRepository) Save(id string, model interface{}) error {
+	model = copyModel(model)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.data[id] = model
+	delete(r.versions, id)
+	return nil
+}
+
+// SaveVersion saves a read model with id if it has the expected version.
+func (r *MemoryReadRepository) SaveVersion(id string, model interface{}, version int) error {
+	model = copyModel(model)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.versions[id] != version {
+		return &VersionConflictError{ID: id, Version: version}
+	}
+
 	r.data[id] = model
+	r.versions[id] = version + 1
 	return nil
 }
 
 // Find returns one read model with using an id. Returns
 // ErrModelNotFound if no model could be found.
 func (r *MemoryReadRepository) Find(id string) (interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	if model, ok := r.data[id]; ok {
-		return model, nil
+		return copyModel(model), nil
 	}
 
 	return nil, ErrModelNotFound
 }
 
+// FindVersion returns one read model and its version. Returns
+// ErrModelNotFound if no model could be found.
+func (r *MemoryReadRepository) FindVersion(id string) (interface{}, int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if model, ok := r.data[id]; ok {
+		return copyModel(model), r.versions[id], nil
+	}
+
+	return nil, 0, ErrModelNotFound
+}
+
 // FindAll returns all read models in the repository.
 func (r *MemoryReadRepository) FindAll() ([]interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	models := []interface{}{}
 	for _, model := range r.data {
-		models = append(models, model)
+		models = append(models, copyModel(model))
 	}
 	return models, nil
 }
 
+// FindAllPage returns a page of read models ordered by id.
+func (r *MemoryReadRepository) FindAllPage(pageSize int, token string) ([]interface{}, string, error) {
+	return findAllPage(r.page, pageSize, token)
+}
+
+// Iter returns an iterator over all read models ordered by id.
+func (r *MemoryReadRepository) Iter(pageSize int, token string) *ReadModelIter {
+	return newReadModelIter(r.page, pageSize, token)
+}
+
+func (r *MemoryReadRepository) page(after string, limit int) ([]string, []interface{}, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := []string{}
+	for id := range r.data {
+		if id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	models := make([]interface{}, len(ids))
+	for i, id := range ids {
+		models[i] = copyModel(r.data[id])
+	}
+	return ids, models, nil
+}
+
 // Remove removes a read model with id from the repository. Returns
 // ErrModelNotFound if no model could be found.
 func (r *MemoryReadRepository) Remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if _, ok := r.data[id]; ok {
 		delete(r.data, id)
+		delete(r.versions, id)
 		return nil
 	}
 
 	return ErrModelNotFound
 }
+
+// Update applies updates to the fields of a read model. The model is
+// converted to JSON and back to update it, the same way as it would be
+// stored by the Postgres repository. Returns ErrModelNotFound if no model
+// could be found.
+func (r *MemoryReadRepository) Update(id string, updates ...FieldUpdate) error {
+	if err := validateUpdates(updates); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	model, ok := r.data[id]
+	if !ok {
+		return ErrModelNotFound
+	}
+
+	v, err := toJSONValue(model)
+	if err != nil {
+		return err
+	}
+	doc, ok := v.(map[string]interface{})
+	if !ok {
+		return ErrInvalidUpdate
+	}
+	if err := updateJSON(doc, updates); err != nil {
+		return err
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	// Create a new model of the same type with the updated fields.
+	t := reflect.TypeOf(model)
+	if t.Kind() == reflect.Ptr {
+		updated := reflect.New(t.Elem())
+		if err := json.Unmarshal(b, updated.Interface()); err != nil {
+			return ErrInvalidUpdate
+		}
+		r.data[id] = updated.Interface()
+	} else {
+		updated := reflect.New(t)
+		if err := json.Unmarshal(b, updated.Interface()); err != nil {
+			return ErrInvalidUpdate
+		}
+		r.data[id] = updated.Elem().Interface()
+	}
+	r.versions[id]++
+	return nil
+}
+
+// FindQuery returns the read models matching a query. The models are
+// converted to JSON to compare their fields, the same way as they would be
+// stored by the Postgres repository.
+func (r *MemoryReadRepository) FindQuery(query Query) ([]interface{}, string, error) {
+	if err := query.validate(); err != nil {
+		return nil, "", err
+	}
+
+	// Convert the filter values to JSON to compare them with the models.
+	filters := make([]Filter, len(query.Filters))
+	for i, f := range query.Filters {
+		var err error
+		if f.Op == FilterIn {
+			f.Value, err = filterValues(f.Value)
+		}
+		if err == nil {
+			f.Value, err = toJSONValue(f.Value)
+		}
+		if err != nil {
+			return nil, "", ErrInvalidQuery
+		}
+		filters[i] = f
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var after *memoryQueryModel
+	if query.Cursor != "" {
+		c, err := decodeCursor(query.Cursor, len(query.Sort))
+		if err != nil {
+			return nil, "", err
+		}
+		after = &memoryQueryModel{id: c.ID, values: c.Values, present: c.Present}
+	}
+
+	var models []*memoryQueryModel
+	for id, model := range r.data {
+		doc, err := toJSONValue(model)
+		if err != nil {
+			return nil, "", err
+		}
+
+		match := true
+		for _, f := range filters {
+			if !matchJSON(doc, f) {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+
+		m := &memoryQueryModel{
+			id:      id,
+			model:   model,
+			values:  make([]interface{}, len(query.Sort)),
+			present: make([]bool, len(query.Sort)),
+		}
+		for i, s := range query.Sort {
+			m.values[i], m.present[i] = jsonField(doc, fieldPath(s.Field))
+		}
+		if after != nil && compareQueryModels(m, after, query.Sort) <= 0 {
+			continue
+		}
+		models = append(models, m)
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		return compareQueryModels(models[i], models[j], query.Sort) < 0
+	})
+
+	if query.Offset >= len(models) {
+		return []interface{}{}, "", nil
+	}
+	models = models[query.Offset:]
+
+	var cursor string
+	if query.Limit > 0 && len(models) > query.Limit {
+		models = models[:query.Limit]
+		last := models[len(models)-1]
+		var err error
+		if cursor, err = encodeCursor(queryCursor{last.values, last.present, last.id}); err != nil {
+			return nil, "", err
+		}
+	}
+
+	result := make([]interface{}, len(models))
+	for i, m := range models {
+		result[i] = copyModel(m.model)
+	}
+	return result, cursor, nil
+}
+
+// memoryQueryModel is a model with the values of its sort fields.
+type memoryQueryModel struct {
+	id      string
+	model   interface{}
+	values  []interface{}
+	present []bool
+}
+
+// compareQueryModels compares two models by their sort fields and then by
+// id. Models missing a field are ordered last, or first for a descending
+// sort, like Postgres does with NULL values.
+func compareQueryModels(a, b *memoryQueryModel, sorts []Sort) int {
+	for i, s := range sorts {
+		var c int
+		switch {
+		case a.present[i] && b.present[i]:
+			c = compareJSON(a.values[i], b.values[i])
+		case a.present[i]:
+			c = -1
+		case b.present[i]:
+			c = 1
+		}
+		if s.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a.id, b.id)
+}
+
+// copyModel returns a deep copy of a model. Unexported fields are copied
+// as they are, without copying what they point to. Pointers, maps and slices
+// that are reached more than once are copied once, which also copies cycles.
+func copyModel(model interface{}) interface{} {
+	if model == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(model), make(map[copyKey]reflect.Value)).Interface()
+}
+
+// copyKey identifies a pointer, map or slice that has been copied.
+type copyKey struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
+
+func copyValue(v reflect.Value, copies map[copyKey]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := copyKey{v.Type(), v.Pointer(), 0}
+		if c, ok := copies[key]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		copies[key] = c
+		c.Elem().Set(copyValue(v.Elem(), copies))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem(), copies))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i), copies))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		key := copyKey{v.Type(), v.Pointer(), v.Len()}
+		if c, ok := copies[key]; ok {
+			return c
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		copies[key] = c
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i), copies))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i), copies))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		key := copyKey{v.Type(), v.Pointer(), 0}
+		if c, ok := copies[key]; ok {
+			return c
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		copies[key] = c
+		for _, k := range v.MapKeys() {
+			c.SetMapIndex(k, copyValue(v.MapIndex(k), copies))
+		}
+		return c
+	}
+	return v
+}
@@ -15,17 +15,28 @@
 package eventhorizon
 
 import (
+	"reflect"
+
 	. "gopkg.in/check.v1"
 )
 
 type MemoryReadRepositorySuite struct {
 	ReadRepositorySuite
+	QueryReadRepositorySuite
+	PagedReadRepositorySuite
+	UpdateReadRepositorySuite
+	VersionedReadRepositorySuite
 }
 
 var _ = Suite(&MemoryReadRepositorySuite{})
 
 func (s *MemoryReadRepositorySuite) SetUpTest(c *C) {
-	s.Setup(NewMemoryReadRepository())
+	repo := NewMemoryReadRepository()
+	s.Setup(repo)
+	s.SetupQuery(repo)
+	s.SetupPaged(repo)
+	s.SetupUpdate(repo)
+	s.SetupVersioned(repo)
 }
 
 func (s *MemoryReadRepositorySuite) TestNewMemoryReadRepository(c *C) {
@@ -34,3 +45,49 @@ func (s *MemoryReadRepositorySuite) TestNewMemoryReadRepository(c *C) {
 	c.Assert(repo.data, Not(Equals), nil)
 	c.Assert(len(repo.data), Equals, 0)
 }
+
+func (s *MemoryReadRepositorySuite) TestCopyModels(c *C) {
+	repo := NewMemoryReadRepository()
+	model := &TestUpdateModel{ID: "1", Name: "athena", Visits: map[string]int{"athens": 1}}
+	err := repo.Save(model.ID, model)
+	c.Assert(err, IsNil)
+
+	// Changing the saved or found model does not change the stored one.
+	model.Name = "hades"
+	model.Visits["athens"] = 2
+	result, err := repo.Find("1")
+	c.Assert(err, IsNil)
+	c.Assert(result, DeepEquals, &TestUpdateModel{ID: "1", Name: "athena", Visits: map[string]int{"athens": 1}})
+	result.(*TestUpdateModel).Visits["athens"] = 3
+	result, err = repo.Find("1")
+	c.Assert(err, IsNil)
+	c.Assert(result.(*TestUpdateModel).Visits["athens"], Equals, 1)
+}
+
+type TestCyclicModel struct {
+	ID     string
+	Parent *TestCyclicModel
+	Shared *TestCyclicModel
+	Items  map[string]interface{}
+}
+
+func (s *MemoryReadRepositorySuite) TestCopyCyclicModels(c *C) {
+	repo := NewMemoryReadRepository()
+	model := &TestCyclicModel{ID: "1", Items: map[string]interface{}{}}
+	model.Parent = model
+	model.Shared = model
+	model.Items["self"] = model.Items
+	err := repo.Save(model.ID, model)
+	c.Assert(err, IsNil)
+
+	result, err := repo.Find("1")
+	c.Assert(err, IsNil)
+	copied := result.(*TestCyclicModel)
+	// The values are compared without checkers, which can not print them.
+	c.Assert(copied != model, Equals, true)
+	c.Assert(copied.Parent == copied, Equals, true)
+	c.Assert(copied.Shared == copied, Equals, true)
+	items := reflect.ValueOf(copied.Items).Pointer()
+	c.Assert(reflect.ValueOf(copied.Items["self"]).Pointer() == items, Equals, true)
+	c.Assert(reflect.ValueOf(model.Items).Pointer() != items, Equals, true)
+}
@@ -1,6 +1,12 @@
 package eventhorizon
 
-import "gopkg.in/mgo.v2"
+import (
+	"encoding/base64"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
 
 // MongoReadRepository implements an MongoDB repository of read models.
 type MongoReadRepository struct {
@@ -38,7 +44,8 @@ func NewMongoReadRepositoryWithSession(session *mgo.Session, database, collectio
 	return r, nil
 }
 
-// Save saves a read model with id to the repository.
+// Save saves a read model with id to the repository. The model is inserted,
+// or replaced if it exists, as one atomic upsert.
 func (r *MongoReadRepository) Save(id string, model interface{}) error {
 	sess := r.session.Copy()
 	defer sess.Close()
@@ -49,6 +56,79 @@ func (r *MongoReadRepository) Save(id string, model interface{}) error {
 	return nil
 }
 
+// mongoVersionField is the field of a document that stores its version.
+const mongoVersionField = "_version"
+
+// SaveVersion saves a read model with id if it has the expected version. The
+// version is stored in the document and checked by the same update.
+func (r *MongoReadRepository) SaveVersion(id string, model interface{}, version int) error {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	// Add the version to the document of the model.
+	b, err := bson.Marshal(model)
+	if err != nil {
+		return ErrCouldNotSaveModel
+	}
+	doc := bson.M{}
+	if err := bson.Unmarshal(b, doc); err != nil {
+		return ErrCouldNotSaveModel
+	}
+	doc[mongoVersionField] = version + 1
+
+	c := sess.DB(r.db).C(r.collection)
+	if version == 0 {
+		// Insert the model, or replace it if it was saved without a version.
+		// If it has a version the upsert fails with a duplicate id.
+		_, err = c.Upsert(bson.M{
+			"_id":             id,
+			mongoVersionField: bson.M{"$in": []interface{}{nil, 0}},
+		}, doc)
+		if mgo.IsDup(err) {
+			return &VersionConflictError{ID: id, Version: version}
+		}
+	} else {
+		err = c.Update(bson.M{"_id": id, mongoVersionField: version}, doc)
+		if err == mgo.ErrNotFound {
+			return &VersionConflictError{ID: id, Version: version}
+		}
+	}
+	if err != nil {
+		return ErrCouldNotSaveModel
+	}
+
+	return nil
+}
+
+// FindVersion returns one read model and its version. Returns
+// ErrModelNotFound if no model could be found.
+func (r *MongoReadRepository) FindVersion(id string) (interface{}, int, error) {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	if r.factory == nil {
+		return nil, 0, ErrModelNotSet
+	}
+
+	var doc bson.Raw
+	if err := sess.DB(r.db).C(r.collection).FindId(id).One(&doc); err != nil {
+		return nil, 0, ErrModelNotFound
+	}
+
+	var version struct {
+		Version int `bson:"_version"`
+	}
+	if err := doc.Unmarshal(&version); err != nil {
+		return nil, 0, err
+	}
+	model := r.factory()
+	if err := doc.Unmarshal(model); err != nil {
+		return nil, 0, err
+	}
+
+	return model, version.Version, nil
+}
+
 // Find returns one read model with using an id. Returns
 // ErrModelNotFound if no model could be found.
 func (r *MongoReadRepository) Find(id string) (interface{}, error) {
@@ -94,6 +174,98 @@ func (r *MongoReadRepository) FindCustom(callback func(*mgo.Collection) *mgo.Que
 	return result, nil
 }
 
+// FindQuery returns the read models matching a query. The fields are
+// compared by MongoDB using the BSON names of the fields.
+func (r *MongoReadRepository) FindQuery(query Query) ([]interface{}, string, error) {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	if r.factory == nil {
+		return nil, "", ErrModelNotSet
+	}
+	if err := query.validate(); err != nil {
+		return nil, "", err
+	}
+
+	and := []bson.M{}
+	for _, f := range query.Filters {
+		cond, err := mongoFilter(f)
+		if err != nil {
+			return nil, "", err
+		}
+		and = append(and, cond)
+	}
+
+	if query.Cursor != "" {
+		c, err := decodeMongoCursor(query.Cursor, len(query.Sort))
+		if err != nil {
+			return nil, "", err
+		}
+		and = append(and, mongoAfter(query.Sort, c))
+	}
+
+	var filter bson.M
+	if len(and) > 0 {
+		filter = bson.M{"$and": and}
+	}
+
+	var sort []string
+	for _, s := range query.Sort {
+		if s.Desc {
+			sort = append(sort, "-"+s.Field)
+		} else {
+			sort = append(sort, s.Field)
+		}
+	}
+	sort = append(sort, "_id")
+
+	q := sess.DB(r.db).C(r.collection).Find(filter).Sort(sort...).Skip(query.Offset)
+	if query.Limit > 0 {
+		// Get one more model to know if there is a next page.
+		q = q.Limit(query.Limit + 1)
+	}
+
+	iter := q.Iter()
+	var docs []bson.Raw
+	var doc bson.Raw
+	for iter.Next(&doc) {
+		docs = append(docs, bson.Raw{Kind: doc.Kind, Data: append([]byte(nil), doc.Data...)})
+	}
+	if err := iter.Close(); err != nil {
+		return nil, "", err
+	}
+
+	var cursor string
+	if query.Limit > 0 && len(docs) > query.Limit {
+		docs = docs[:query.Limit]
+
+		// The cursor is made from the sort fields of the last model.
+		var last bson.M
+		if err := docs[len(docs)-1].Unmarshal(&last); err != nil {
+			return nil, "", err
+		}
+		c := mongoCursor{Values: make([]interface{}, len(query.Sort))}
+		for i, s := range query.Sort {
+			c.Values[i] = mongoField(last, fieldPath(s.Field))
+		}
+		c.ID = last["_id"]
+		var err error
+		if cursor, err = encodeMongoCursor(c); err != nil {
+			return nil, "", err
+		}
+	}
+
+	result := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		model := r.factory()
+		if err := doc.Unmarshal(model); err != nil {
+			return nil, "", err
+		}
+		result[i] = model
+	}
+	return result, cursor, nil
+}
+
 // FindAll returns all read models in the repository.
 func (r *MongoReadRepository) FindAll() ([]interface{}, error) {
 	sess := r.session.Copy()
@@ -117,6 +289,86 @@ func (r *MongoReadRepository) FindAll() ([]interface{}, error) {
 	return result, nil
 }
 
+// FindAllPage returns a page of read models ordered by id.
+func (r *MongoReadRepository) FindAllPage(pageSize int, token string) ([]interface{}, string, error) {
+	return findAllPage(r.page, pageSize, token)
+}
+
+// Iter returns an iterator over all read models ordered by id.
+func (r *MongoReadRepository) Iter(pageSize int, token string) *ReadModelIter {
+	return newReadModelIter(r.page, pageSize, token)
+}
+
+func (r *MongoReadRepository) page(after string, limit int) ([]string, []interface{}, error) {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	if r.factory == nil {
+		return nil, nil, ErrModelNotSet
+	}
+
+	iter := sess.DB(r.db).C(r.collection).Find(bson.M{"_id": bson.M{"$gt": after}}).
+		Sort("_id").Limit(limit).Iter()
+	ids := []string{}
+	models := []interface{}{}
+	var doc bson.Raw
+	for iter.Next(&doc) {
+		var id struct {
+			ID string `bson:"_id"`
+		}
+		if err := doc.Unmarshal(&id); err != nil {
+			iter.Close()
+			return nil, nil, err
+		}
+		model := r.factory()
+		if err := doc.Unmarshal(model); err != nil {
+			iter.Close()
+			return nil, nil, err
+		}
+		ids = append(ids, id.ID)
+		models = append(models, model)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return ids, models, nil
+}
+
+// Update applies updates to the fields of a read model with $set and $inc.
+// Returns ErrModelNotFound if no model could be found.
+func (r *MongoReadRepository) Update(id string, updates ...FieldUpdate) error {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	if err := validateUpdates(updates); err != nil {
+		return err
+	}
+
+	set, inc := bson.M{}, bson.M{}
+	for _, u := range updates {
+		if u.Op == UpdateInc {
+			inc[u.Field] = u.Value
+		} else {
+			set[u.Field] = u.Value
+		}
+	}
+	change := bson.M{}
+	if len(set) > 0 {
+		change["$set"] = set
+	}
+	inc[mongoVersionField] = 1
+	change["$inc"] = inc
+
+	err := sess.DB(r.db).C(r.collection).UpdateId(id, change)
+	if err == mgo.ErrNotFound {
+		return ErrModelNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
 // Remove removes a read model with id from the repository. Returns
 // ErrModelNotFound if no model could be found.
 func (r *MongoReadRepository) Remove(id string) error {
@@ -154,3 +406,178 @@ func (r *MongoReadRepository) Close() error {
 	r.session.Close()
 	return nil
 }
+
+var mongoFilterOps = map[FilterOp]string{
+	FilterGt:  "$gt",
+	FilterGte: "$gte",
+	FilterLt:  "$lt",
+	FilterLte: "$lte",
+	FilterIn:  "$in",
+}
+
+func mongoFilter(f Filter) (bson.M, error) {
+	switch f.Op {
+	case FilterEq:
+		return bson.M{f.Field: f.Value}, nil
+	case FilterIn:
+		values, err := filterValues(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{f.Field: bson.M{"$in": values}}, nil
+	}
+	if op, ok := mongoFilterOps[f.Op]; ok {
+		return bson.M{f.Field: bson.M{op: f.Value}}, nil
+	}
+	return nil, ErrInvalidQuery
+}
+
+// mongoAfter returns a filter matching the models ordered after a cursor. A
+// nil value is a missing field, which MongoDB orders first, or last for a
+// descending sort.
+func mongoAfter(sorts []Sort, c mongoCursor) bson.M {
+	or := []bson.M{}
+	for i := 0; i <= len(sorts); i++ {
+		and := bson.M{}
+		for j := 0; j < i; j++ {
+			and[sorts[j].Field] = c.Values[j]
+		}
+		if i < len(sorts) {
+			field, value := sorts[i].Field, c.Values[i]
+			switch {
+			case value == nil && sorts[i].Desc:
+				// No model is ordered after a missing field.
+				continue
+			case value == nil:
+				and[field] = bson.M{"$ne": nil}
+			case sorts[i].Desc:
+				and["$or"] = []bson.M{
+					{field: bson.M{"$lt": value}},
+					{field: nil},
+				}
+			default:
+				and[field] = bson.M{"$gt": value}
+			}
+		} else {
+			and["_id"] = bson.M{"$gt": c.ID}
+		}
+		or = append(or, and)
+	}
+	return bson.M{"$or": or}
+}
+
+// mongoField returns the value of a nested field in a document.
+func mongoField(doc bson.M, path []string) interface{} {
+	var v interface{} = doc
+	for _, p := range path {
+		m, ok := v.(bson.M)
+		if !ok {
+			return nil
+		}
+		v = m[p]
+	}
+	return v
+}
+
+// mongoCursor is the position of the last model of a page. It is encoded as
+// BSON to keep the types of the values, like dates.
+type mongoCursor struct {
+	Values []interface{} `bson:"v"`
+	ID     interface{}   `bson:"id"`
+}
+
+func encodeMongoCursor(c mongoCursor) (string, error) {
+	b, err := bson.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+func decodeMongoCursor(s string, sorts int) (mongoCursor, error) {
+	var c mongoCursor
+	b, err := base64.URLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := bson.Unmarshal(b, &c); err != nil || len(c.Values) != sorts {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// mongoIndexPrefix prefixes the names of the indexes created by SetIndexes.
+const mongoIndexPrefix = "eh_"
+
+// mongoNamespaceNotFound is the error code for a missing collection.
+const mongoNamespaceNotFound = 26
+
+// SetIndexes creates the declared indexes and drops the indexes of earlier
+// declarations that are no longer declared. The id is always indexed by
+// MongoDB as _id, and GIN indexes are created as regular indexes, which are
+// multikey for arrays. GIN indexes of whole models are not supported.
+func (r *MongoReadRepository) SetIndexes(indexes []Index) error {
+	if err := validateIndexes(indexes); err != nil {
+		return err
+	}
+
+	declared := make(map[string]Index)
+	for _, i := range indexes {
+		if len(i.Fields) == 0 {
+			return ErrInvalidIndex
+		}
+		declared[mongoIndexPrefix+i.key()] = i
+	}
+
+	sess := r.session.Copy()
+	defer sess.Close()
+	c := sess.DB(r.db).C(r.collection)
+
+	// Drop the old indexes first, a changed index may have the same keys.
+	existing, err := c.Indexes()
+	if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == mongoNamespaceNotFound {
+		// The collection has not been created yet.
+		existing = nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, index := range existing {
+		if _, ok := declared[index.Name]; ok || !strings.HasPrefix(index.Name, mongoIndexPrefix) {
+			continue
+		}
+		if err := c.DropIndexName(index.Name); err != nil {
+			return err
+		}
+	}
+
+	for name, i := range declared {
+		err := c.EnsureIndex(mgo.Index{
+			Key:        i.Fields,
+			Unique:     i.Unique,
+			Background: true,
+			Name:       name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexNames returns the names of all indexes on the collection.
+func (r *MongoReadRepository) indexNames() ([]string, error) {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	indexes, err := sess.DB(r.db).C(r.collection).Indexes()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(indexes))
+	for i, index := range indexes {
+		names[i] = index.Name
+	}
+	return names, nil
+}
@@ -34,6 +34,10 @@ type MongoReadRepositorySuite struct {
 	url  string
 	repo *MongoReadRepository
 	RemoteReadRepositorySuite
+	QueryReadRepositorySuite
+	PagedReadRepositorySuite
+	UpdateReadRepositorySuite
+	VersionedReadRepositorySuite
 }
 
 func (s *MongoReadRepositorySuite) SetUpSuite(c *C) {
@@ -56,6 +60,10 @@ func (s *MongoReadRepositorySuite) SetUpTest(c *C) {
 	s.repo.Clear()
 
 	s.Setup(s.repo)
+	s.SetupQuery(s.repo)
+	s.SetupPaged(s.repo)
+	s.SetupUpdate(s.repo)
+	s.SetupVersioned(s.repo)
 }
 
 func (s *MongoReadRepositorySuite) TearDownTest(c *C) {
@@ -79,3 +87,27 @@ func (s *MongoReadRepositorySuite) Test_FindCustom(c *C) {
 	c.Assert(models, HasLen, 1)
 	c.Assert(models[0], DeepEquals, model1)
 }
+
+func (s *MongoReadRepositorySuite) Test_SetIndexes(c *C) {
+	err := s.repo.SetIndexes([]Index{
+		{Name: "content", Fields: []string{"content"}},
+		{Name: "content_id", Fields: []string{"content", "_id"}, Unique: true},
+	})
+	c.Assert(err, IsNil)
+	names, err := s.repo.indexNames()
+	c.Assert(err, IsNil)
+	c.Assert(countPrefix(names, "eh_"), Equals, 2)
+
+	// Changing a declaration replaces the index, undeclared ones are dropped.
+	err = s.repo.SetIndexes([]Index{
+		{Name: "content", Fields: []string{"content"}, Unique: true},
+	})
+	c.Assert(err, IsNil)
+	after, err := s.repo.indexNames()
+	c.Assert(err, IsNil)
+	c.Assert(countPrefix(after, "eh_"), Equals, 1)
+	c.Assert(countPrefix(after, "eh_content_"), Equals, 1)
+
+	err = s.repo.SetIndexes([]Index{{Name: "all", GIN: true}})
+	c.Assert(err, Equals, ErrInvalidIndex)
+}
@@ -0,0 +1,153 @@
+package eventhorizon
+
+import "encoding/base64"
+
+// PagedReadRepository is a read repository that can return its read models
+// one page at a time, ordered by id, instead of loading them all at once.
+type PagedReadRepository interface {
+	ReadRepository
+
+	// FindAllPage returns up to pageSize read models, starting after the
+	// position of a token. An empty token starts from the beginning. The
+	// returned token continues with the next page, it is empty when there
+	// are no more models.
+	FindAllPage(pageSize int, token string) ([]interface{}, string, error)
+
+	// Iter returns an iterator over all read models, starting after the
+	// position of a token. Models are fetched pageSize at a time.
+	Iter(pageSize int, token string) *ReadModelIter
+}
+
+// readModelPageFunc fetches up to limit models with an id after the given
+// one, ordered by id. It is implemented natively by each repository.
+type readModelPageFunc func(after string, limit int) ([]string, []interface{}, error)
+
+// encodePageToken encodes the id of the last model of a page as a token.
+func encodePageToken(id string) string {
+	return base64.URLEncoding.EncodeToString([]byte(id))
+}
+
+// decodePageToken decodes a token to the id to continue after.
+func decodePageToken(token string) (string, error) {
+	id, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	return string(id), nil
+}
+
+// findAllPage returns a page of models and the token for the next page.
+func findAllPage(fetch readModelPageFunc, pageSize int, token string) ([]interface{}, string, error) {
+	if pageSize < 1 {
+		return nil, "", ErrInvalidQuery
+	}
+	after, err := decodePageToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Get one more model to know if there is a next page.
+	ids, models, err := fetch(after, pageSize+1)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(models) > pageSize {
+		models = models[:pageSize]
+		next = encodePageToken(ids[pageSize-1])
+	}
+	return models, next, nil
+}
+
+// ReadModelIter iterates over the read models of a repository, fetching them
+// a page at a time.
+//
+// A typical iteration would be:
+//     iter := repository.Iter(100, "")
+//     for iter.Next() {
+//         export(iter.Model())
+//     }
+//     if err := iter.Err(); err != nil {
+//         // Retry later from iter.Token().
+//     }
+type ReadModelIter struct {
+	fetch    readModelPageFunc
+	pageSize int
+	after    string
+	ids      []string
+	models   []interface{}
+	pos      int
+	done     bool
+	err      error
+}
+
+// newReadModelIter creates an iterator that fetches pages with a function.
+func newReadModelIter(fetch readModelPageFunc, pageSize int, token string) *ReadModelIter {
+	i := &ReadModelIter{
+		fetch:    fetch,
+		pageSize: pageSize,
+		pos:      -1,
+	}
+	if pageSize < 1 {
+		i.err = ErrInvalidQuery
+	} else {
+		i.after, i.err = decodePageToken(token)
+	}
+	return i
+}
+
+// Next advances to the next read model. It returns false when there are no
+// more models or when an error occurred.
+func (i *ReadModelIter) Next() bool {
+	if i.err != nil {
+		return false
+	}
+
+	if i.pos >= 0 && i.pos < len(i.ids) {
+		i.after = i.ids[i.pos]
+	}
+	i.pos++
+
+	if i.pos >= len(i.ids) {
+		if i.done {
+			return false
+		}
+		i.ids, i.models, i.err = i.fetch(i.after, i.pageSize)
+		i.pos = 0
+		if i.err != nil {
+			i.ids, i.models = nil, nil
+			return false
+		}
+		// A short page is the last one.
+		i.done = len(i.ids) < i.pageSize
+		if len(i.ids) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Model returns the current read model.
+func (i *ReadModelIter) Model() interface{} {
+	if i.pos < 0 || i.pos >= len(i.models) {
+		return nil
+	}
+	return i.models[i.pos]
+}
+
+// Token returns a token that continues the iteration after the current read
+// model, or from the same position as the iterator started if Next has not
+// returned any model yet.
+func (i *ReadModelIter) Token() string {
+	if i.pos >= 0 && i.pos < len(i.ids) {
+		return encodePageToken(i.ids[i.pos])
+	}
+	return encodePageToken(i.after)
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (i *ReadModelIter) Err() error {
+	return i.err
+}
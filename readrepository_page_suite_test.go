@@ -0,0 +1,101 @@
+package eventhorizon
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type PagedReadRepositorySuite struct {
+	pagedRepo PagedReadRepository
+}
+
+func (s *PagedReadRepositorySuite) SetupPaged(repo PagedReadRepository) {
+	s.pagedRepo = repo
+}
+
+// savePagedModels saves five models, returned in id order.
+func (s *PagedReadRepositorySuite) savePagedModels(c *C) []interface{} {
+	var models []interface{}
+	for _, id := range []string{"c", "a", "e", "b", "d"} {
+		model := NewTestModelWithID(id, "model "+id)
+		err := s.pagedRepo.Save(id, model)
+		c.Assert(err, IsNil)
+	}
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		model, err := s.pagedRepo.Find(id)
+		c.Assert(err, IsNil)
+		models = append(models, model)
+	}
+	return models
+}
+
+func (s *PagedReadRepositorySuite) Test_FindAllPage(c *C) {
+	models := s.savePagedModels(c)
+
+	page, token, err := s.pagedRepo.FindAllPage(2, "")
+	c.Assert(err, IsNil)
+	c.Assert(page, DeepEquals, models[0:2])
+	c.Assert(token, Not(Equals), "")
+
+	page, token, err = s.pagedRepo.FindAllPage(2, token)
+	c.Assert(err, IsNil)
+	c.Assert(page, DeepEquals, models[2:4])
+	c.Assert(token, Not(Equals), "")
+
+	page, token, err = s.pagedRepo.FindAllPage(2, token)
+	c.Assert(err, IsNil)
+	c.Assert(page, DeepEquals, models[4:5])
+	c.Assert(token, Equals, "")
+}
+
+func (s *PagedReadRepositorySuite) Test_FindAllPage_Exact(c *C) {
+	models := s.savePagedModels(c)
+
+	page, token, err := s.pagedRepo.FindAllPage(5, "")
+	c.Assert(err, IsNil)
+	c.Assert(page, DeepEquals, models)
+	c.Assert(token, Equals, "")
+}
+
+func (s *PagedReadRepositorySuite) Test_FindAllPage_Invalid(c *C) {
+	_, _, err := s.pagedRepo.FindAllPage(0, "")
+	c.Assert(err, Equals, ErrInvalidQuery)
+	_, _, err = s.pagedRepo.FindAllPage(2, "not a token")
+	c.Assert(err, Equals, ErrInvalidCursor)
+}
+
+func (s *PagedReadRepositorySuite) Test_Iter(c *C) {
+	models := s.savePagedModels(c)
+
+	var all []interface{}
+	iter := s.pagedRepo.Iter(2, "")
+	for iter.Next() {
+		all = append(all, iter.Model())
+	}
+	c.Assert(iter.Err(), IsNil)
+	c.Assert(all, DeepEquals, models)
+}
+
+func (s *PagedReadRepositorySuite) Test_Iter_Resume(c *C) {
+	models := s.savePagedModels(c)
+
+	iter := s.pagedRepo.Iter(2, "")
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Next(), Equals, true)
+	c.Assert(iter.Model(), DeepEquals, models[2])
+
+	var rest []interface{}
+	iter = s.pagedRepo.Iter(2, iter.Token())
+	for iter.Next() {
+		rest = append(rest, iter.Model())
+	}
+	c.Assert(iter.Err(), IsNil)
+	c.Assert(rest, DeepEquals, models[3:])
+}
+
+func (s *PagedReadRepositorySuite) Test_Iter_Empty(c *C) {
+	iter := s.pagedRepo.Iter(2, "")
+	c.Assert(iter.Next(), Equals, false)
+	c.Assert(iter.Err(), IsNil)
+	c.Assert(iter.Model(), IsNil)
+}
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/doubledutch/lager"
 	"github.com/jmoiron/sqlx"
 	// PostgreSQL driver
 	_ "github.com/lib/pq"
@@ -16,6 +15,23 @@ import (
 // ErrCouldNotCreateTables returned when necessary tables could not be created.
 var ErrCouldNotCreateTables = errors.New("could not create tables")
 
+// ErrModelIDMismatch returned when a model is saved to a Postgres repository
+// with an id that is not the id field of the model, which Find uses.
+var ErrModelIDMismatch = errors.New("model id does not match")
+
+// DuplicateModelsError is returned by NewPostgresReadRepository when a table
+// of an earlier version has models with the same id, see
+// RemovePostgresDuplicateModels.
+type DuplicateModelsError struct {
+	Table string
+	IDs   []string
+}
+
+// Error implements the Error method of the error interface.
+func (e *DuplicateModelsError) Error() string {
+	return fmt.Sprintf("table %s has duplicate models: %s", e.Table, strings.Join(e.IDs, ", "))
+}
+
 func initDB(conn string) (*sqlx.DB, error) {
 	db, err := sqlx.Open("postgres", conn)
 	if err != nil {
@@ -39,14 +55,14 @@ type PostgresReadRepository struct {
 	factory func() interface{}
 	stmts   map[string]string
 
-	lgr lager.ContextLager
+	logging
 }
 
-// NewPostgresReadRepository creates a new PostgresReadRepository.
+// NewPostgresReadRepository creates a new PostgresReadRepository. Returns a
+// DuplicateModelsError if the table has models with the same id, which
+// earlier versions could save. It logs to lager until another logger is set
+// with SetLogger.
 func NewPostgresReadRepository(conn, table string) (*PostgresReadRepository, error) {
-	lgr := lager.Child()
-	lgr.Set("table", table)
-
 	db, err := initDB(conn)
 	if err != nil {
 		return nil, err
@@ -58,64 +74,224 @@ CREATE EXTENSION IF NOT EXISTS "uuid-ossp" WITH SCHEMA public;
 CREATE TABLE IF NOT EXISTS %s (
   data jsonb
 );
-`, table)
+
+ALTER TABLE %s ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 0;
+`, table, table)
 
 	_, err = db.Exec(create)
 	if err != nil {
 		return nil, ErrCouldNotCreateTables
 	}
 
+	if err = createPostgresIDIndex(db, table); err != nil {
+		if _, ok := err.(*DuplicateModelsError); ok {
+			db.Close()
+			return nil, err
+		}
+		return nil, ErrCouldNotCreateTables
+	}
+
 	stmts := map[string]string{
-		"save":    fmt.Sprintf("INSERT INTO %s (data) VALUES ($1)", table),
-		"find":    fmt.Sprintf("SELECT * FROM %s WHERE data->>'id'=$1", table),
-		"findall": fmt.Sprintf("SELECT * FROM %s", table),
-		"remove":  fmt.Sprintf("DELETE FROM %s WHERE data->>'id'=$1", table),
+		"save":    fmt.Sprintf("INSERT INTO %s (data) VALUES ($1) ON CONFLICT ((%s)) DO UPDATE SET data = EXCLUDED.data, version = 0", table, postgresQueryID),
+		"insert":  fmt.Sprintf("INSERT INTO %s (data, version) VALUES ($1, 1) ON CONFLICT ((%s)) DO UPDATE SET data = EXCLUDED.data, version = 1 WHERE %s.version = 0", table, postgresQueryID, table),
+		"replace": fmt.Sprintf("UPDATE %s SET data = $1, version = version + 1 WHERE %s = $2 AND version = $3", table, postgresQueryID),
+		"find":    fmt.Sprintf("SELECT data FROM %s WHERE %s = $1", table, postgresQueryID),
+		"findver": fmt.Sprintf("SELECT data, version FROM %s WHERE %s = $1", table, postgresQueryID),
+		"findall": fmt.Sprintf("SELECT data FROM %s", table),
+		"page":    fmt.Sprintf("SELECT data->>'id' AS id, data FROM %s WHERE %s > $1 ORDER BY %s LIMIT $2", table, postgresQueryID, postgresQueryID),
+		"remove":  fmt.Sprintf("DELETE FROM %s WHERE %s = $1", table, postgresQueryID),
 		"clear":   fmt.Sprintf("DELETE FROM %s", table),
-		"update":  fmt.Sprintf("UPDATE %s set data=$1 WHERE data->>'id'=$2", table),
+		"indexes": "SELECT indexname FROM pg_indexes WHERE schemaname = current_schema() AND tablename = $1",
 	}
 
-	return &PostgresReadRepository{
+	r := &PostgresReadRepository{
 		db:    db,
 		table: table,
 		stmts: stmts,
-		lgr:   lgr,
-	}, nil
+	}
+	r.logToLager()
+	return r, nil
 }
 
-// Save saves a read model with id to the repository.
-func (r *PostgresReadRepository) Save(id string, model interface{}) error {
-	b, err := json.Marshal(model)
+// createPostgresIDIndex indexes the id of the models, using the same
+// expression as the statements. It is unique to let Save upsert models.
+//
+// Tables of earlier versions have a non-unique index on the id, which is
+// dropped, and can have models with the same id, which are returned as a
+// DuplicateModelsError.
+func createPostgresIDIndex(db *sqlx.DB, table string) error {
+	var exists bool
+	err := db.Get(&exists, "SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE schemaname = current_schema() AND indexname = $1)",
+		strings.ToLower(table)+"_id_key")
+	if err != nil || exists {
+		return err
+	}
+
+	tx, err := db.Beginx()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	existing, err := r.Find(id)
-	if err != nil && err != ErrModelNotFound {
+	// Lock out writes until the index exists, so no duplicates can be saved
+	// after the check.
+	if _, err := tx.Exec(fmt.Sprintf("LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE", table)); err != nil {
+		return err
+	}
+	var ids []string
+	if err := tx.Select(&ids, fmt.Sprintf(`SELECT data->>'id' FROM %s
+WHERE data->>'id' IS NOT NULL GROUP BY 1 HAVING count(*) > 1 ORDER BY 1`, table)); err != nil {
 		return err
 	}
+	if len(ids) > 0 {
+		return &DuplicateModelsError{Table: table, IDs: ids}
+	}
 
-	if existing != nil {
-		// Update
-		_, err = r.db.Exec(r.stmts["update"], b, id)
-		if err != nil {
-			return ErrCouldNotSaveModel
+	for _, stmt := range []string{
+		fmt.Sprintf("DROP INDEX IF EXISTS %s_id", table),
+		fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s_id_key ON %s ((%s))",
+			table, table, postgresQueryID),
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RemovePostgresDuplicateModels removes the models with the same id from a
+// table of an earlier version, keeping the one that was written last, so
+// that NewPostgresReadRepository can index it. The removed models are lost.
+//
+// An example would be:
+//     repo, err := NewPostgresReadRepository(conn, "invitations")
+//     if _, ok := err.(*DuplicateModelsError); ok {
+//         err = RemovePostgresDuplicateModels(conn, "invitations")
+//         ...
+//     }
+func RemovePostgresDuplicateModels(conn, table string) error {
+	db, err := initDB(conn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		fmt.Sprintf("LOCK TABLE %s IN SHARE ROW EXCLUSIVE MODE", table),
+		fmt.Sprintf(`DELETE FROM %s a USING %s b
+WHERE (a.data->>'id') = (b.data->>'id')
+AND (a.xmin::text::bigint, a.ctid) < (b.xmin::text::bigint, b.ctid)`, table, table),
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
 		}
-		return nil
+	}
+	return tx.Commit()
+}
+
+// Save saves a read model with id to the repository. The model is inserted,
+// or replaced if it exists, as one atomic operation. Returns
+// ErrModelIDMismatch if id is not the id field of the model.
+func (r *PostgresReadRepository) Save(id string, model interface{}) error {
+	b, err := postgresModelData(id, model)
+	if err != nil {
+		return err
+	}
+
+	if _, err = r.db.Exec(r.stmts["save"], b); err != nil {
+		return ErrCouldNotSaveModel
+	}
+
+	return nil
+}
+
+// SaveVersion saves a read model with id if it has the expected version. The
+// version is checked and incremented by the same statement. Returns
+// ErrModelIDMismatch if id is not the id field of the model.
+func (r *PostgresReadRepository) SaveVersion(id string, model interface{}, version int) error {
+	b, err := postgresModelData(id, model)
+	if err != nil {
+		return err
 	}
 
-	// Insert
-	_, err = r.db.Exec(r.stmts["save"], b)
+	var result sql.Result
+	if version == 0 {
+		result, err = r.db.Exec(r.stmts["insert"], b)
+	} else {
+		result, err = r.db.Exec(r.stmts["replace"], b, id, version)
+	}
 	if err != nil {
 		return ErrCouldNotSaveModel
 	}
+	if num, err := result.RowsAffected(); err != nil {
+		return err
+	} else if num == 0 {
+		return &VersionConflictError{ID: id, Version: version}
+	}
 
 	return nil
 }
 
+// postgresModelData marshals a model, checking that its id field is id as
+// the statements find models by it.
+func postgresModelData(id string, model interface{}) ([]byte, error) {
+	b, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := toJSONValue(json.RawMessage(b))
+	if err != nil {
+		return nil, err
+	}
+	switch v, _ := jsonField(doc, []string{"id"}); v := v.(type) {
+	case string:
+		if v == id {
+			return b, nil
+		}
+	case json.Number:
+		if v.String() == id {
+			return b, nil
+		}
+	}
+	return nil, ErrModelIDMismatch
+}
+
 type postgresModel struct {
 	Data []byte
 }
 
+type postgresVersionModel struct {
+	Data    []byte
+	Version int
+}
+
+// FindVersion returns one read model and its version.
+func (r *PostgresReadRepository) FindVersion(id string) (interface{}, int, error) {
+	if r.factory == nil {
+		return nil, 0, ErrModelNotSet
+	}
+
+	var pModel postgresVersionModel
+	err := r.db.Get(&pModel, r.stmts["findver"], id)
+	if err == sql.ErrNoRows {
+		return nil, 0, ErrModelNotFound
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	model := r.factory()
+	if err := json.Unmarshal(pModel.Data, model); err != nil {
+		return nil, 0, err
+	}
+	return model, pModel.Version, nil
+}
+
 // Find returns one read model with using an id.
 func (r *PostgresReadRepository) Find(id string) (interface{}, error) {
 	if r.factory == nil {
@@ -159,6 +335,44 @@ func (r *PostgresReadRepository) FindAll() ([]interface{}, error) {
 	return models, nil
 }
 
+// FindAllPage returns a page of read models ordered by id.
+func (r *PostgresReadRepository) FindAllPage(pageSize int, token string) ([]interface{}, string, error) {
+	return findAllPage(r.page, pageSize, token)
+}
+
+// Iter returns an iterator over all read models ordered by id.
+func (r *PostgresReadRepository) Iter(pageSize int, token string) *ReadModelIter {
+	return newReadModelIter(r.page, pageSize, token)
+}
+
+type postgresPageModel struct {
+	ID   string
+	Data []byte
+}
+
+func (r *PostgresReadRepository) page(after string, limit int) ([]string, []interface{}, error) {
+	if r.factory == nil {
+		return nil, nil, ErrModelNotSet
+	}
+
+	var pModels []postgresPageModel
+	if err := r.db.Select(&pModels, r.stmts["page"], after, limit); err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]string, len(pModels))
+	models := make([]interface{}, len(pModels))
+	for i, pModel := range pModels {
+		model := r.factory()
+		if err := json.Unmarshal(pModel.Data, model); err != nil {
+			return nil, nil, err
+		}
+		ids[i] = pModel.ID
+		models[i] = model
+	}
+	return ids, models, nil
+}
+
 // Remove removes a read model with id from the repository.
 func (r *PostgresReadRepository) Remove(id string) error {
 	result, err := r.db.Exec(r.stmts["remove"], id)
@@ -172,7 +386,7 @@ func (r *PostgresReadRepository) Remove(id string) error {
 
 // SetModel sets a factory function that creates concrete model types.
 func (r *PostgresReadRepository) SetModel(factory func() interface{}) {
-	r.lgr.Debugf("Set model")
+	r.logger().With(map[string]string{"table": r.table}).Debugf("Set model")
 	r.factory = factory
 }
 
@@ -186,3 +400,399 @@ func (r *PostgresReadRepository) Clear() error {
 func (r *PostgresReadRepository) Close() error {
 	return r.db.Close()
 }
+
+// Update applies updates to the fields of a read model in one statement.
+// Nested objects are created as needed. Returns ErrModelNotFound if no model
+// could be found, or ErrModelIDMismatch if the id field is updated.
+func (r *PostgresReadRepository) Update(id string, updates ...FieldUpdate) error {
+	if err := validateUpdates(updates); err != nil {
+		return err
+	}
+	for _, u := range updates {
+		if u.Field == "id" {
+			return ErrModelIDMismatch
+		}
+	}
+
+	q := &postgresQuery{}
+	where := postgresQueryID + " = " + q.arg(id)
+	expr := "data"
+	for _, u := range updates {
+		// Create the missing parent objects of nested fields.
+		path := fieldPath(u.Field)
+		for i := 1; i < len(path); i++ {
+			parent := q.arg(postgresArray(path[:i])) + "::text[]"
+			expr = fmt.Sprintf("(SELECT jsonb_set(d, %s, COALESCE(d #> %s, '{}'::jsonb)) FROM (SELECT %s AS d) s)",
+				parent, parent, expr)
+		}
+
+		p := q.arg(postgresArray(path)) + "::text[]"
+		var value string
+		if u.Op == UpdateInc {
+			value = fmt.Sprintf("to_jsonb(COALESCE((data #>> %s)::numeric, 0) + %s::numeric)",
+				p, q.arg(fmt.Sprint(u.Value)))
+		} else {
+			v, err := q.jsonArg(u.Value)
+			if err != nil {
+				return ErrInvalidUpdate
+			}
+			value = v
+		}
+		expr = fmt.Sprintf("jsonb_set(%s, %s, %s)", expr, p, value)
+	}
+
+	stmt := fmt.Sprintf("UPDATE %s SET data = %s, version = version + 1 WHERE %s", r.table, expr, where)
+	result, err := r.db.Exec(stmt, q.args...)
+	if err != nil {
+		return err
+	}
+	if num, err := result.RowsAffected(); err != nil {
+		return err
+	} else if num == 0 {
+		return ErrModelNotFound
+	}
+	return nil
+}
+
+// postgresArray formats strings as a Postgres array literal.
+func postgresArray(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		v = strings.Replace(v, `\`, `\\`, -1)
+		quoted[i] = `"` + strings.Replace(v, `"`, `\"`, -1) + `"`
+	}
+	return "{" + strings.Join(quoted, ",") + "}"
+}
+
+// FindQuery returns the read models matching a query. Fields are compared
+// using the jsonb operators, so only values of the same JSON type match.
+func (r *PostgresReadRepository) FindQuery(query Query) ([]interface{}, string, error) {
+	if r.factory == nil {
+		return nil, "", ErrModelNotSet
+	}
+	if err := query.validate(); err != nil {
+		return nil, "", err
+	}
+
+	q := &postgresQuery{}
+	var where []string
+	for _, f := range query.Filters {
+		cond, err := q.filter(f)
+		if err != nil {
+			return nil, "", err
+		}
+		where = append(where, cond)
+	}
+
+	if query.Cursor != "" {
+		c, err := decodeCursor(query.Cursor, len(query.Sort))
+		if err != nil {
+			return nil, "", err
+		}
+		cond, err := q.after(query.Sort, c)
+		if err != nil {
+			return nil, "", err
+		}
+		where = append(where, cond)
+	}
+
+	var order []string
+	for _, s := range query.Sort {
+		dir := "ASC"
+		if s.Desc {
+			dir = "DESC"
+		}
+		order = append(order, q.field(s.Field)+" "+dir)
+	}
+	order = append(order, postgresQueryID+" ASC")
+
+	stmt := fmt.Sprintf("SELECT data FROM %s", r.table)
+	if len(where) > 0 {
+		stmt += " WHERE " + strings.Join(where, " AND ")
+	}
+	stmt += " ORDER BY " + strings.Join(order, ", ")
+	if query.Limit > 0 {
+		// Get one more model to know if there is a next page.
+		stmt += " LIMIT " + q.arg(query.Limit+1)
+	}
+	if query.Offset > 0 {
+		stmt += " OFFSET " + q.arg(query.Offset)
+	}
+
+	var pModels []postgresModel
+	if err := r.db.Select(&pModels, stmt, q.args...); err != nil {
+		return nil, "", err
+	}
+
+	var cursor string
+	if query.Limit > 0 && len(pModels) > query.Limit {
+		pModels = pModels[:query.Limit]
+
+		// The cursor is made from the sort fields of the last model.
+		doc, err := toJSONValue(json.RawMessage(pModels[len(pModels)-1].Data))
+		if err != nil {
+			return nil, "", err
+		}
+		c := queryCursor{
+			Values:  make([]interface{}, len(query.Sort)),
+			Present: make([]bool, len(query.Sort)),
+		}
+		for i, s := range query.Sort {
+			c.Values[i], c.Present[i] = jsonField(doc, fieldPath(s.Field))
+		}
+		id, _ := jsonField(doc, []string{"id"})
+		c.ID, _ = id.(string)
+		if cursor, err = encodeCursor(c); err != nil {
+			return nil, "", err
+		}
+	}
+
+	models := make([]interface{}, len(pModels))
+	for i, pModel := range pModels {
+		model := r.factory()
+		if err := json.Unmarshal(pModel.Data, model); err != nil {
+			return nil, "", err
+		}
+		models[i] = model
+	}
+	return models, cursor, nil
+}
+
+// postgresQueryID is the id of a model, compared bytewise like in the other
+// read repositories.
+const postgresQueryID = `(data->>'id') COLLATE "C"`
+
+// postgresQuery builds the conditions of a query, with all field names and
+// values passed as arguments.
+type postgresQuery struct {
+	args []interface{}
+}
+
+// arg adds an argument and returns its placeholder.
+func (q *postgresQuery) arg(v interface{}) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// jsonArg adds a value as a jsonb argument and returns its placeholder.
+func (q *postgresQuery) jsonArg(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", ErrInvalidQuery
+	}
+	return q.arg(string(b)) + "::jsonb", nil
+}
+
+// field returns the jsonb expression for a, possibly nested, field. The
+// field names are inlined to let Postgres match the expression with indexes.
+func (q *postgresQuery) field(field string) string {
+	return postgresField(field)
+}
+
+// compare returns a condition comparing a field with a value, matching only
+// values of the same JSON type.
+func (q *postgresQuery) compare(field, op string, value interface{}) (string, error) {
+	expr := q.field(field)
+	v, err := q.jsonArg(value)
+	if err != nil {
+		return "", err
+	}
+	if op == "=" {
+		return expr + " = " + v, nil
+	}
+	return fmt.Sprintf("(jsonb_typeof(%s) = jsonb_typeof(%s) AND %s %s %s)",
+		expr, v, expr, op, v), nil
+}
+
+func (q *postgresQuery) filter(f Filter) (string, error) {
+	switch f.Op {
+	case FilterEq:
+		return q.compare(f.Field, "=", f.Value)
+	case FilterGt:
+		return q.compare(f.Field, ">", f.Value)
+	case FilterGte:
+		return q.compare(f.Field, ">=", f.Value)
+	case FilterLt:
+		return q.compare(f.Field, "<", f.Value)
+	case FilterLte:
+		return q.compare(f.Field, "<=", f.Value)
+	case FilterIn:
+		values, err := filterValues(f.Value)
+		if err != nil {
+			return "", err
+		}
+		if len(values) == 0 {
+			return "FALSE", nil
+		}
+		expr := q.field(f.Field)
+		placeholders := make([]string, len(values))
+		for i, value := range values {
+			if placeholders[i], err = q.jsonArg(value); err != nil {
+				return "", err
+			}
+		}
+		return expr + " IN (" + strings.Join(placeholders, ", ") + ")", nil
+	}
+	return "", ErrInvalidQuery
+}
+
+// after returns a condition matching the models ordered after a cursor. The
+// values of the cursor are compared in the jsonb order, where a null value
+// is ordered first. A missing field is SQL NULL, which is ordered last, or
+// first for a descending sort.
+func (q *postgresQuery) after(sorts []Sort, c queryCursor) (string, error) {
+	var or []string
+	for i := 0; i <= len(sorts); i++ {
+		var and []string
+		for j := 0; j < i; j++ {
+			cond, err := q.cursorEqual(sorts[j].Field, c.Values[j], c.Present[j])
+			if err != nil {
+				return "", err
+			}
+			and = append(and, cond)
+		}
+
+		if i < len(sorts) {
+			cond, err := q.cursorAfter(sorts[i], c.Values[i], c.Present[i])
+			if err != nil {
+				return "", err
+			}
+			and = append(and, cond)
+		} else {
+			and = append(and, postgresQueryID+" > "+q.arg(c.ID))
+		}
+
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+	}
+	return "(" + strings.Join(or, " OR ") + ")", nil
+}
+
+// cursorEqual returns a condition matching a field with the value of a
+// cursor, or a missing field if the cursor has none.
+func (q *postgresQuery) cursorEqual(field string, value interface{}, present bool) (string, error) {
+	expr := q.field(field)
+	if !present {
+		return expr + " IS NULL", nil
+	}
+	v, err := q.jsonArg(value)
+	if err != nil {
+		return "", err
+	}
+	return expr + " = " + v, nil
+}
+
+// cursorAfter returns a condition matching a field ordered after the value
+// of a cursor, or after a missing field if the cursor has none.
+func (q *postgresQuery) cursorAfter(s Sort, value interface{}, present bool) (string, error) {
+	expr := q.field(s.Field)
+	if !present {
+		if s.Desc {
+			return expr + " IS NOT NULL", nil
+		}
+		return "FALSE", nil
+	}
+	v, err := q.jsonArg(value)
+	if err != nil {
+		return "", err
+	}
+	if s.Desc {
+		return expr + " < " + v, nil
+	}
+	return "(" + expr + " > " + v + " OR " + expr + " IS NULL)", nil
+}
+
+// postgresField returns the jsonb expression for a, possibly nested, field.
+func postgresField(field string) string {
+	expr := "data"
+	for _, p := range fieldPath(field) {
+		expr += "->" + postgresQuoteLiteral(p)
+	}
+	return "(" + expr + ")"
+}
+
+// postgresQuoteLiteral quotes a string as an SQL literal.
+func postgresQuoteLiteral(s string) string {
+	s = strings.Replace(s, "'", "''", -1)
+	if strings.Contains(s, `\`) {
+		// Use the escape string syntax to be independent of the
+		// standard_conforming_strings setting.
+		return `E'` + strings.Replace(s, `\`, `\\`, -1) + "'"
+	}
+	return "'" + s + "'"
+}
+
+// SetIndexes creates the declared indexes as expression indexes on the
+// fields, or GIN indexes, and drops the indexes of earlier declarations that
+// are no longer declared. The indexes are named after the table and the index.
+func (r *PostgresReadRepository) SetIndexes(indexes []Index) error {
+	if err := validateIndexes(indexes); err != nil {
+		return err
+	}
+
+	prefix := strings.ToLower(r.table) + "_ix_"
+	declared := make(map[string]Index)
+	for _, i := range indexes {
+		name := prefix + i.key()
+		if len(name) > 63 {
+			// Postgres would truncate the name.
+			return ErrInvalidIndex
+		}
+		declared[name] = i
+	}
+
+	existing, err := r.indexNames()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range existing {
+		if _, ok := declared[name]; ok || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if _, err := r.db.Exec("DROP INDEX IF EXISTS " + name); err != nil {
+			return err
+		}
+	}
+
+	for name, i := range declared {
+		create := "CREATE INDEX"
+		if i.Unique {
+			create = "CREATE UNIQUE INDEX"
+		}
+		var stmt string
+		if i.GIN {
+			expr := "data"
+			if len(i.Fields) > 0 {
+				expr = postgresField(i.Fields[0])
+			}
+			stmt = fmt.Sprintf("%s IF NOT EXISTS %s ON %s USING GIN (%s)",
+				create, name, r.table, expr)
+		} else {
+			exprs := make([]string, len(i.Fields))
+			for j, f := range i.Fields {
+				if f == "id" {
+					// Use the same expression as the statements.
+					exprs[j] = "(" + postgresQueryID + ")"
+				} else {
+					exprs[j] = postgresField(f)
+				}
+			}
+			stmt = fmt.Sprintf("%s IF NOT EXISTS %s ON %s (%s)",
+				create, name, r.table, strings.Join(exprs, ", "))
+		}
+		if _, err := r.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexNames returns the names of all indexes on the table.
+func (r *PostgresReadRepository) indexNames() ([]string, error) {
+	var names []string
+	if err := r.db.Select(&names, r.stmts["indexes"], strings.ToLower(r.table)); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
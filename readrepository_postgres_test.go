@@ -9,6 +9,10 @@ var _ = Suite(&PostgresReadRepositorySuite{})
 type PostgresReadRepositorySuite struct {
 	url string
 	RemoteReadRepositorySuite
+	QueryReadRepositorySuite
+	PagedReadRepositorySuite
+	UpdateReadRepositorySuite
+	VersionedReadRepositorySuite
 }
 
 func (s *PostgresReadRepositorySuite) SetUpSuite(c *C) {
@@ -22,6 +26,10 @@ func (s *PostgresReadRepositorySuite) SetUpTest(c *C) {
 	repo.Clear()
 
 	s.Setup(repo)
+	s.SetupQuery(repo)
+	s.SetupPaged(repo)
+	s.SetupUpdate(repo)
+	s.SetupVersioned(repo)
 }
 
 func (s *PostgresReadRepositorySuite) Test_NewPostgresReadRepository(c *C) {
@@ -29,3 +37,91 @@ func (s *PostgresReadRepositorySuite) Test_NewPostgresReadRepository(c *C) {
 	c.Assert(repo, NotNil)
 	c.Assert(err, IsNil)
 }
+
+func (s *PostgresReadRepositorySuite) Test_SetIndexes(c *C) {
+	repo, err := NewPostgresReadRepository(s.url, "testmodel")
+	c.Assert(err, IsNil)
+	defer repo.SetIndexes(nil)
+
+	err = repo.SetIndexes([]Index{
+		{Name: "content", Fields: []string{"content"}},
+		{Name: "unique_id", Fields: []string{"id"}, Unique: true},
+		{Name: "all", GIN: true},
+	})
+	c.Assert(err, IsNil)
+	names, err := repo.indexNames()
+	c.Assert(err, IsNil)
+	c.Assert(countPrefix(names, "testmodel_ix_"), Equals, 3)
+	c.Assert(countPrefix(names, "testmodel_ix_content_"), Equals, 1)
+
+	// Changing a declaration replaces the index, undeclared ones are dropped.
+	err = repo.SetIndexes([]Index{
+		{Name: "content", Fields: []string{"content"}, Unique: true},
+	})
+	c.Assert(err, IsNil)
+	after, err := repo.indexNames()
+	c.Assert(err, IsNil)
+	c.Assert(countPrefix(after, "testmodel_ix_"), Equals, 1)
+	c.Assert(countPrefix(after, "testmodel_ix_content_"), Equals, 1)
+	c.Assert(countPrefix(after, "testmodel_id"), Equals, 1)
+
+	err = repo.SetIndexes([]Index{{Name: "Invalid", Fields: []string{"content"}}})
+	c.Assert(err, Equals, ErrInvalidIndex)
+}
+
+func (s *PostgresReadRepositorySuite) Test_MigrateDuplicateIDs(c *C) {
+	// A table of an earlier version, with duplicate models and a non-unique
+	// index on the id.
+	db, err := initDB(s.url)
+	c.Assert(err, IsNil)
+	defer db.Close()
+	defer db.Exec("DROP TABLE IF EXISTS testmigrate")
+	for _, stmt := range []string{
+		"DROP TABLE IF EXISTS testmigrate",
+		"CREATE TABLE testmigrate (data jsonb)",
+		"CREATE INDEX testmigrate_id ON testmigrate ((" + postgresQueryID + "))",
+		`INSERT INTO testmigrate (data) VALUES ('{"id": "1", "content": "old"}')`,
+		`INSERT INTO testmigrate (data) VALUES ('{"id": "1", "content": "new"}')`,
+		`INSERT INTO testmigrate (data) VALUES ('{"id": "2", "content": "other"}')`,
+	} {
+		_, err := db.Exec(stmt)
+		c.Assert(err, IsNil)
+	}
+
+	repo, err := NewPostgresReadRepository(s.url, "testmigrate")
+	c.Assert(repo, IsNil)
+	c.Assert(err, DeepEquals, &DuplicateModelsError{Table: "testmigrate", IDs: []string{"1"}})
+	var count int
+	c.Assert(db.Get(&count, "SELECT count(*) FROM testmigrate"), IsNil)
+	c.Assert(count, Equals, 3)
+
+	c.Assert(RemovePostgresDuplicateModels(s.url, "testmigrate"), IsNil)
+	repo, err = NewPostgresReadRepository(s.url, "testmigrate")
+	c.Assert(err, IsNil)
+	repo.SetModel(func() interface{} { return &TestModel{} })
+	models, err := repo.FindAll()
+	c.Assert(err, IsNil)
+	c.Assert(models, HasLen, 2)
+	model, err := repo.Find("1")
+	c.Assert(err, IsNil)
+	c.Assert(model.(*TestModel).Content, Equals, "new")
+
+	names, err := repo.indexNames()
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, []string{"testmigrate_id_key"})
+	c.Assert(repo.Save("1", &TestModel{ID: "1", Content: "saved"}), IsNil)
+}
+
+func (s *PostgresReadRepositorySuite) Test_SaveIDMismatch(c *C) {
+	repo := s.repo.(*PostgresReadRepository)
+	err := repo.Save("1", &TestModel{ID: "2", Content: "content"})
+	c.Assert(err, Equals, ErrModelIDMismatch)
+	err = repo.SaveVersion("1", &TestModel{ID: "2", Content: "content"}, 0)
+	c.Assert(err, Equals, ErrModelIDMismatch)
+	_, err = repo.Find("2")
+	c.Assert(err, Equals, ErrModelNotFound)
+
+	c.Assert(repo.Save("1", &TestModel{ID: "1", Content: "content"}), IsNil)
+	err = repo.Update("1", FieldUpdate{Op: UpdateSet, Field: "id", Value: "2"})
+	c.Assert(err, Equals, ErrModelIDMismatch)
+}
@@ -0,0 +1,372 @@
+package eventhorizon
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidQuery returned when a query has a missing field or an unknown operator.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ErrInvalidCursor returned when a query cursor could not be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FilterOp is an operator comparing a model field with a value.
+type FilterOp string
+
+const (
+	// FilterEq matches fields equal to the value.
+	FilterEq FilterOp = "eq"
+	// FilterGt matches fields greater than the value.
+	FilterGt FilterOp = "gt"
+	// FilterGte matches fields greater than or equal to the value.
+	FilterGte FilterOp = "gte"
+	// FilterLt matches fields less than the value.
+	FilterLt FilterOp = "lt"
+	// FilterLte matches fields less than or equal to the value.
+	FilterLte FilterOp = "lte"
+	// FilterIn matches fields equal to any of the values in a slice.
+	FilterIn FilterOp = "in"
+)
+
+// Filter is a condition on a single field of a read model.
+//
+// Field is the name of the field as stored by the repository, which is the
+// JSON name for the memory and Postgres repositories and the BSON name for
+// the MongoDB repository. Nested fields are separated by dots, for example
+// "address.city".
+type Filter struct {
+	Field string
+	Op    FilterOp
+	Value interface{}
+}
+
+// Sort orders read models by a field, in ascending order unless Desc is set.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Query is a backend agnostic query for read models.
+//
+// An example would be:
+//     repository.FindQuery(Query{
+//         Filters: []Filter{{"status", FilterEq, "accepted"}},
+//         Sort:    []Sort{{Field: "name"}},
+//         Limit:   10,
+//     })
+//
+// Models are always ordered by their id after the sort fields, which makes
+// the order stable. Numbers are compared as numbers and strings using the
+// ordering of the backend. Where models missing a sort field end up in the
+// order is backend specific.
+type Query struct {
+	// Filters that must all match for a model to be returned.
+	Filters []Filter
+
+	// Sort is the fields to order the models by.
+	Sort []Sort
+
+	// Limit is the max number of models to return, 0 means no limit.
+	Limit int
+
+	// Offset is the number of models to skip.
+	Offset int
+
+	// Cursor continues a query after the last model of a previous page. It
+	// must be used with the same filters and sort as that query.
+	Cursor string
+}
+
+// QueryReadRepository is a read repository that can find read models using
+// a Query.
+type QueryReadRepository interface {
+	ReadRepository
+
+	// FindQuery returns the read models matching a query. If a limit is set
+	// and there are more models it also returns a cursor for the next page,
+	// otherwise the cursor is empty.
+	FindQuery(Query) ([]interface{}, string, error)
+}
+
+// validate checks that all fields and operators of a query are set.
+func (q Query) validate() error {
+	if q.Limit < 0 || q.Offset < 0 {
+		return ErrInvalidQuery
+	}
+	for _, f := range q.Filters {
+		if f.Field == "" {
+			return ErrInvalidQuery
+		}
+		switch f.Op {
+		case FilterEq, FilterGt, FilterGte, FilterLt, FilterLte:
+		case FilterIn:
+			if _, err := filterValues(f.Value); err != nil {
+				return err
+			}
+		default:
+			return ErrInvalidQuery
+		}
+	}
+	for _, s := range q.Sort {
+		if s.Field == "" {
+			return ErrInvalidQuery
+		}
+	}
+	return nil
+}
+
+// filterValues returns the values of an In filter, which can be any slice.
+func filterValues(value interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, ErrInvalidQuery
+	}
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values, nil
+}
+
+// fieldPath splits a dot separated field name into its parts.
+func fieldPath(field string) []string {
+	return strings.Split(field, ".")
+}
+
+// queryCursor is the position of the last model of a page, used to find the
+// models after it. Present tells if the model has the sort fields, which can
+// also hold null values.
+type queryCursor struct {
+	Values  []interface{} `json:"v"`
+	Present []bool        `json:"p"`
+	ID      string        `json:"id"`
+}
+
+// encodeCursor encodes a JSON cursor as an opaque string.
+func encodeCursor(c queryCursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor decodes a JSON cursor for a query with sorts sort fields.
+// Cursors of earlier versions have no Present, their nil values are missing
+// fields.
+func decodeCursor(s string, sorts int) (queryCursor, error) {
+	var c queryCursor
+	b, err := base64.URLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if err := d.Decode(&c); err != nil || len(c.Values) != sorts {
+		return c, ErrInvalidCursor
+	}
+	if c.Present == nil {
+		c.Present = make([]bool, sorts)
+		for i, v := range c.Values {
+			c.Present[i] = v != nil
+		}
+	} else if len(c.Present) != sorts {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// toJSONValue converts a value to how it looks after a roundtrip to JSON,
+// with numbers as json.Number.
+func toJSONValue(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var value interface{}
+	if err := d.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// jsonField returns the value of a nested field in a JSON document.
+func jsonField(doc interface{}, path []string) (interface{}, bool) {
+	for _, p := range path {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// jsonTypeRank orders JSON values of different types the same way as
+// Postgres orders jsonb values.
+func jsonTypeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case string:
+		return 1
+	case json.Number:
+		return 2
+	case bool:
+		return 3
+	case []interface{}:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// compareJSON compares two JSON values, returning -1, 0 or 1. Values of
+// different types are ordered by type.
+func compareJSON(a, b interface{}) int {
+	ra, rb := jsonTypeRank(a), jsonTypeRank(b)
+	if ra != rb {
+		return compareInts(ra, rb)
+	}
+
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case json.Number:
+		fa, _ := a.Float64()
+		fb, _ := b.(json.Number).Float64()
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	case bool:
+		if a == b.(bool) {
+			return 0
+		} else if !a {
+			return -1
+		}
+		return 1
+	case []interface{}:
+		return compareJSONArrays(a, b.([]interface{}))
+	case map[string]interface{}:
+		return compareJSONObjects(a, b.(map[string]interface{}))
+	}
+	return 0
+}
+
+// compareJSONArrays compares arrays like Postgres compares jsonb arrays, by
+// their length and then by their elements.
+func compareJSONArrays(a, b []interface{}) int {
+	if c := compareInts(len(a), len(b)); c != 0 {
+		return c
+	}
+	for i := range a {
+		if c := compareJSON(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareJSONObjects compares objects like Postgres compares jsonb objects,
+// by their number of keys and then by their keys and values, with the keys in
+// the jsonb storage order of shorter keys first.
+func compareJSONObjects(a, b map[string]interface{}) int {
+	if c := compareInts(len(a), len(b)); c != 0 {
+		return c
+	}
+	ka, kb := jsonObjectKeys(a), jsonObjectKeys(b)
+	for i := range ka {
+		if c := compareInts(len(ka[i]), len(kb[i])); c != 0 {
+			return c
+		}
+		if c := strings.Compare(ka[i], kb[i]); c != 0 {
+			return c
+		}
+	}
+	for _, k := range ka {
+		if c := compareJSON(a[k], b[k]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// jsonObjectKeys returns the keys of an object in the jsonb storage order.
+func jsonObjectKeys(o map[string]interface{}) []string {
+	keys := make([]string, 0, len(o))
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// matchJSON checks if a JSON document matches a filter. The filter value
+// must have been converted with toJSONValue.
+func matchJSON(doc interface{}, f Filter) bool {
+	v, ok := jsonField(doc, fieldPath(f.Field))
+	if !ok {
+		return false
+	}
+
+	if f.Op == FilterIn {
+		for _, value := range f.Value.([]interface{}) {
+			if sameJSONType(v, value) && compareJSON(v, value) == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Like in Postgres, only values of the same type match.
+	if !sameJSONType(v, f.Value) {
+		return false
+	}
+	c := compareJSON(v, f.Value)
+	switch f.Op {
+	case FilterEq:
+		return c == 0
+	case FilterGt:
+		return c > 0
+	case FilterGte:
+		return c >= 0
+	case FilterLt:
+		return c < 0
+	case FilterLte:
+		return c <= 0
+	}
+	return false
+}
+
+func sameJSONType(a, b interface{}) bool {
+	return jsonTypeRank(a) == jsonTypeRank(b)
+}
@@ -0,0 +1,201 @@
+package eventhorizon
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type QueryReadRepositorySuite struct {
+	queryRepo QueryReadRepository
+}
+
+func (s *QueryReadRepositorySuite) SetupQuery(repo QueryReadRepository) {
+	s.queryRepo = repo
+}
+
+type TestQueryModel struct {
+	ID   string `json:"id" bson:"id"`
+	Name string `json:"name" bson:"name"`
+	Age  int    `json:"age" bson:"age"`
+}
+
+// saveQueryModels saves models with the ids "1", "2", ... in order.
+func (s *QueryReadRepositorySuite) saveQueryModels(c *C, models ...*TestQueryModel) {
+	if repo, ok := s.queryRepo.(RemoteReadRepository); ok {
+		repo.SetModel(func() interface{} { return &TestQueryModel{} })
+	}
+	for _, model := range models {
+		err := s.queryRepo.Save(model.ID, model)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *QueryReadRepositorySuite) queryModels() []*TestQueryModel {
+	return []*TestQueryModel{
+		{"1", "athena", 42},
+		{"2", "hades", 35},
+		{"3", "zeus", 50},
+		{"4", "apollo", 35},
+	}
+}
+
+func (s *QueryReadRepositorySuite) Test_FindQuery_Eq(c *C) {
+	m := s.queryModels()
+	s.saveQueryModels(c, m...)
+	result, cursor, err := s.queryRepo.FindQuery(Query{
+		Filters: []Filter{{"name", FilterEq, "hades"}},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(cursor, Equals, "")
+	c.Assert(result, DeepEquals, []interface{}{m[1]})
+}
+
+func (s *QueryReadRepositorySuite) Test_FindQuery_Range(c *C) {
+	m := s.queryModels()
+	s.saveQueryModels(c, m...)
+	result, _, err := s.queryRepo.FindQuery(Query{
+		Filters: []Filter{
+			{"age", FilterGte, 35},
+			{"age", FilterLt, 50},
+		},
+		Sort: []Sort{{Field: "age"}},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(result, DeepEquals, []interface{}{m[1], m[3], m[0]})
+}
+
+func (s *QueryReadRepositorySuite) Test_FindQuery_In(c *C) {
+	m := s.queryModels()
+	s.saveQueryModels(c, m...)
+	result, _, err := s.queryRepo.FindQuery(Query{
+		Filters: []Filter{{"name", FilterIn, []string{"zeus", "athena", "ares"}}},
+		Sort:    []Sort{{Field: "name"}},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(result, DeepEquals, []interface{}{m[0], m[2]})
+
+	result, _, err = s.queryRepo.FindQuery(Query{
+		Filters: []Filter{{"name", FilterIn, []string{}}},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(result, HasLen, 0)
+}
+
+func (s *QueryReadRepositorySuite) Test_FindQuery_SortLimitOffset(c *C) {
+	m := s.queryModels()
+	s.saveQueryModels(c, m...)
+	result, cursor, err := s.queryRepo.FindQuery(Query{
+		Sort:   []Sort{{Field: "age", Desc: true}, {Field: "name"}},
+		Limit:  2,
+		Offset: 1,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(cursor, Not(Equals), "")
+	c.Assert(result, DeepEquals, []interface{}{m[0], m[3]})
+
+	result, cursor, err = s.queryRepo.FindQuery(Query{
+		Sort:   []Sort{{Field: "age", Desc: true}, {Field: "name"}},
+		Limit:  2,
+		Offset: 3,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(cursor, Equals, "")
+	c.Assert(result, DeepEquals, []interface{}{m[1]})
+}
+
+func (s *QueryReadRepositorySuite) Test_FindQuery_Cursor(c *C) {
+	m := s.queryModels()
+	s.saveQueryModels(c, m...)
+	query := Query{
+		Sort:  []Sort{{Field: "age"}},
+		Limit: 1,
+	}
+
+	var all []interface{}
+	for {
+		result, cursor, err := s.queryRepo.FindQuery(query)
+		c.Assert(err, IsNil)
+		all = append(all, result...)
+		if cursor == "" {
+			break
+		}
+		query.Cursor = cursor
+	}
+	c.Assert(all, DeepEquals, []interface{}{m[1], m[3], m[0], m[2]})
+}
+
+type TestQueryNickModel struct {
+	ID   string `json:"id" bson:"id"`
+	Nick string `json:"nick,omitempty" bson:"nick,omitempty"`
+}
+
+func (s *QueryReadRepositorySuite) Test_FindQuery_CursorMissingField(c *C) {
+	if repo, ok := s.queryRepo.(RemoteReadRepository); ok {
+		repo.SetModel(func() interface{} { return &TestQueryNickModel{} })
+	}
+	models := []*TestQueryNickModel{{"1", "x"}, {"2", ""}, {"3", "y"}, {"4", ""}}
+	for _, model := range models {
+		c.Assert(s.queryRepo.Save(model.ID, model), IsNil)
+	}
+
+	// Paging returns all models, in the order of a single page, when the
+	// last model of a page is missing the sort field.
+	s.checkCursorPaging(c, len(models))
+}
+
+type TestQueryNullModel struct {
+	ID   string  `json:"id" bson:"id"`
+	Nick *string `json:"nick" bson:"nick"`
+}
+
+func (s *QueryReadRepositorySuite) Test_FindQuery_CursorNullField(c *C) {
+	if repo, ok := s.queryRepo.(RemoteReadRepository); ok {
+		repo.SetModel(func() interface{} { return &TestQueryNullModel{} })
+	}
+	x, y := "x", "y"
+	models := []*TestQueryNullModel{{"1", &x}, {"2", nil}, {"3", &y}, {"4", nil}}
+	for _, model := range models {
+		c.Assert(s.queryRepo.Save(model.ID, model), IsNil)
+	}
+
+	// Paging returns all models when the last model of a page has a null
+	// sort field.
+	s.checkCursorPaging(c, len(models))
+}
+
+// checkCursorPaging checks that paging through the models sorted by nick
+// returns all of them, in the order of a single page.
+func (s *QueryReadRepositorySuite) checkCursorPaging(c *C, count int) {
+	for _, desc := range []bool{false, true} {
+		query := Query{Sort: []Sort{{Field: "nick", Desc: desc}}}
+		expected, _, err := s.queryRepo.FindQuery(query)
+		c.Assert(err, IsNil)
+		c.Assert(expected, HasLen, count)
+
+		query.Limit = 1
+		var all []interface{}
+		for {
+			result, cursor, err := s.queryRepo.FindQuery(query)
+			c.Assert(err, IsNil)
+			all = append(all, result...)
+			if cursor == "" {
+				break
+			}
+			query.Cursor = cursor
+		}
+		c.Assert(all, DeepEquals, expected, Commentf("desc: %v", desc))
+	}
+}
+
+func (s *QueryReadRepositorySuite) Test_FindQuery_Invalid(c *C) {
+	s.saveQueryModels(c)
+	_, _, err := s.queryRepo.FindQuery(Query{
+		Filters: []Filter{{"name", FilterOp("like"), "a%"}},
+	})
+	c.Assert(err, Equals, ErrInvalidQuery)
+	_, _, err = s.queryRepo.FindQuery(Query{
+		Filters: []Filter{{"name", FilterIn, "athena"}},
+	})
+	c.Assert(err, Equals, ErrInvalidQuery)
+	_, _, err = s.queryRepo.FindQuery(Query{Cursor: "invalid"})
+	c.Assert(err, Equals, ErrInvalidCursor)
+}
@@ -0,0 +1,33 @@
+package eventhorizon
+
+import (
+	"encoding/json"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&ReadRepositoryQuerySuite{})
+
+type ReadRepositoryQuerySuite struct{}
+
+func (s *ReadRepositoryQuerySuite) TestCompareJSON(c *C) {
+	values := []interface{}{
+		nil,
+		"a",
+		json.Number("1"),
+		true,
+		[]interface{}{json.Number("2")},
+		[]interface{}{json.Number("1"), json.Number("1")},
+		[]interface{}{json.Number("1"), json.Number("2")},
+		map[string]interface{}{"b": json.Number("1")},
+		map[string]interface{}{"b": json.Number("2")},
+		map[string]interface{}{"aa": json.Number("1")},
+		map[string]interface{}{"a": json.Number("1"), "b": json.Number("1")},
+	}
+	// The values are ordered, like Postgres orders jsonb values.
+	for i, a := range values {
+		for j, b := range values {
+			c.Assert(compareJSON(a, b), Equals, compareInts(i, j), Commentf("%v, %v", a, b))
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package eventhorizon
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// RedisReadRepository implements a Redis repository of read models. Models
+// are stored as JSON under a key per model, prefixed by the app and
+// collection name. The : and % of the collection name are escaped, so that
+// the keys of collections can not collide.
+type RedisReadRepository struct {
+	pool   *redis.Pool
+	prefix string
+
+	ttl         time.Duration
+	factory     func() interface{}
+	optionsLock sync.RWMutex
+}
+
+// NewRedisReadRepository creates a new RedisReadRepository.
+func NewRedisReadRepository(appID, collection, server, password string) (*RedisReadRepository, error) {
+	pool := newRedisPool(server, password)
+	return NewRedisReadRepositoryWithPool(appID, collection, pool)
+}
+
+// NewRedisReadRepositoryWithPool creates a new RedisReadRepository with a pool.
+func NewRedisReadRepositoryWithPool(appID, collection string, pool *redis.Pool) (*RedisReadRepository, error) {
+	if pool == nil {
+		return nil, ErrNoDBSession
+	}
+
+	r := &RedisReadRepository{
+		pool:   pool,
+		prefix: appID + ":readmodels:" + redisAggregateEscaper.Replace(collection) + ":",
+	}
+
+	return r, nil
+}
+
+// Save saves a read model with id to the repository. If a TTL is set the
+// model expires after that time.
+func (r *RedisReadRepository) Save(id string, model interface{}) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	data, err := json.Marshal(model)
+	if err != nil {
+		return ErrCouldNotSaveModel
+	}
+
+	r.optionsLock.RLock()
+	ttl := r.ttl
+	r.optionsLock.RUnlock()
+
+	args := []interface{}{r.prefix + id, data}
+	if ttl > 0 {
+		args = append(args, "PX", int64(ttl/time.Millisecond))
+	}
+	if _, err := conn.Do("SET", args...); err != nil {
+		return ErrCouldNotSaveModel
+	}
+	return nil
+}
+
+// Find returns one read model with using an id. Returns
+// ErrModelNotFound if no model could be found.
+func (r *RedisReadRepository) Find(id string) (interface{}, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	factory := r.modelFactory()
+	if factory == nil {
+		return nil, ErrModelNotSet
+	}
+
+	data, err := redis.Bytes(conn.Do("GET", r.prefix+id))
+	if err == redis.ErrNil {
+		return nil, ErrModelNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	model := factory()
+	if err := json.Unmarshal(data, model); err != nil {
+		return nil, err
+	}
+
+	return model, nil
+}
+
+// FindAll returns all read models in the repository.
+func (r *RedisReadRepository) FindAll() ([]interface{}, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	factory := r.modelFactory()
+	if factory == nil {
+		return nil, ErrModelNotSet
+	}
+
+	result := []interface{}{}
+	err := redisScanPrefix(conn, r.prefix, func(keys []interface{}) error {
+		// Keys may expire or be removed between SCAN and MGET, those are
+		// returned as nil and skipped.
+		values, err := redis.ByteSlices(conn.Do("MGET", keys...))
+		if err != nil {
+			return err
+		}
+		for _, data := range values {
+			if data == nil {
+				continue
+			}
+			model := factory()
+			if err := json.Unmarshal(data, model); err != nil {
+				return err
+			}
+			result = append(result, model)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Remove removes a read model with id from the repository. Returns
+// ErrModelNotFound if no model could be found.
+func (r *RedisReadRepository) Remove(id string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	n, err := redis.Int(conn.Do("DEL", r.prefix+id))
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return ErrModelNotFound
+	}
+
+	return nil
+}
+
+// SetModel sets a factory function that creates concrete model types.
+func (r *RedisReadRepository) SetModel(factory func() interface{}) {
+	r.optionsLock.Lock()
+	defer r.optionsLock.Unlock()
+	r.factory = factory
+}
+
+// modelFactory returns the factory set by SetModel.
+func (r *RedisReadRepository) modelFactory() func() interface{} {
+	r.optionsLock.RLock()
+	defer r.optionsLock.RUnlock()
+	return r.factory
+}
+
+// SetTTL sets the time after which saved models expire. A TTL of 0, the
+// default, keeps models until they are removed.
+func (r *RedisReadRepository) SetTTL(ttl time.Duration) {
+	r.optionsLock.Lock()
+	defer r.optionsLock.Unlock()
+	r.ttl = ttl
+}
+
+// Clear clears the read models of the repository.
+func (r *RedisReadRepository) Clear() error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	if err := redisDeletePrefix(conn, r.prefix); err != nil {
+		return ErrCouldNotClearDB
+	}
+	return nil
+}
+
+// Close closes the connection pool.
+func (r *RedisReadRepository) Close() error {
+	return r.pool.Close()
+}
@@ -0,0 +1,75 @@
+// +build redis
+
+package eventhorizon
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&RedisReadRepositorySuite{})
+
+type RedisReadRepositorySuite struct {
+	url  string
+	repo *RedisReadRepository
+	RemoteReadRepositorySuite
+}
+
+func (s *RedisReadRepositorySuite) SetUpSuite(c *C) {
+	s.url = redisURL()
+}
+
+func (s *RedisReadRepositorySuite) SetUpTest(c *C) {
+	var err error
+	s.repo, err = NewRedisReadRepository("test", "testmodel", s.url, "")
+	c.Assert(err, IsNil)
+	s.repo.SetModel(func() interface{} { return &TestModel{} })
+	s.repo.Clear()
+
+	s.Setup(s.repo)
+}
+
+func (s *RedisReadRepositorySuite) Test_NewRedisReadRepository(c *C) {
+	repo, err := NewRedisReadRepository("test", "testmodel", s.url, "")
+	c.Assert(repo, NotNil)
+	c.Assert(err, IsNil)
+}
+
+func (s *RedisReadRepositorySuite) Test_TTL(c *C) {
+	s.repo.SetTTL(50 * time.Millisecond)
+	model1 := NewTestModel("model1")
+	err := s.repo.Save(model1.ID, model1)
+	c.Assert(err, IsNil)
+	model, err := s.repo.Find(model1.ID)
+	c.Assert(err, IsNil)
+	c.Assert(model, DeepEquals, model1)
+
+	time.Sleep(100 * time.Millisecond)
+	model, err = s.repo.Find(model1.ID)
+	c.Assert(err, Equals, ErrModelNotFound)
+	c.Assert(model, IsNil)
+}
+
+func (s *RedisReadRepositorySuite) Test_CollectionEscaping(c *C) {
+	repo1, err := NewRedisReadRepository("test", "a:b", s.url, "")
+	c.Assert(err, IsNil)
+	repo1.SetModel(func() interface{} { return &TestModel{} })
+	defer repo1.Clear()
+	repo2, err := NewRedisReadRepository("test", "a", s.url, "")
+	c.Assert(err, IsNil)
+	repo2.SetModel(func() interface{} { return &TestModel{} })
+	defer repo2.Clear()
+
+	// The keys would both be test:readmodels:a:b:c without escaping.
+	model := NewTestModelWithID("c", "model")
+	c.Assert(repo1.Save(model.ID, model), IsNil)
+	_, err = repo2.Find("b:c")
+	c.Assert(err, Equals, ErrModelNotFound)
+	models, err := repo2.FindAll()
+	c.Assert(err, IsNil)
+	c.Assert(models, HasLen, 0)
+	found, err := repo1.Find("c")
+	c.Assert(err, IsNil)
+	c.Assert(found, DeepEquals, model)
+}
@@ -1,6 +1,7 @@
 package eventhorizon
 
 import (
+	"sync"
 	"time"
 
 	"github.com/odeke-em/go-uuid"
@@ -59,7 +60,8 @@ func (s *ReadRepositorySuite) TestFindEmptyRepo(c *C) {
 
 func (s *ReadRepositorySuite) TestFindNonExistingID(c *C) {
 	repo := s.repo
-	err := repo.Save(uuid.New(), NewTestModel("model1"))
+	model := NewTestModel("model1")
+	err := repo.Save(model.ID, model)
 	c.Assert(err, Equals, nil)
 	result, err := repo.Find(uuid.New())
 	c.Assert(err, ErrorMatches, "could not find model")
@@ -120,8 +122,8 @@ func (s *ReadRepositorySuite) TestRemove(c *C) {
 func (s *ReadRepositorySuite) TestRemoveNonExistingID(c *C) {
 	// Non existing ID.
 	repo := s.repo
-	id := uuid.New()
-	repo.Save(id, NewTestModel("content"))
+	model := NewTestModel("content")
+	repo.Save(model.ID, model)
 	err := repo.Remove(uuid.New())
 	c.Assert(err, ErrorMatches, "could not find model")
 	result, err := repo.FindAll()
@@ -142,3 +144,29 @@ func NewTestModel(content string) *TestModel {
 func NewTestModelWithID(id string, content string) *TestModel {
 	return &TestModel{id, content, time.Now().Round(time.Millisecond)}
 }
+
+func (s *ReadRepositorySuite) TestConcurrent(c *C) {
+	// Run with the race detector to find unsafe access.
+	repo := s.repo
+	shared := NewTestModel("shared")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			model := NewTestModel("model")
+			c.Check(repo.Save(model.ID, model), IsNil)
+			c.Check(repo.Save(shared.ID, NewTestModelWithID(shared.ID, "shared")), IsNil)
+			_, err := repo.Find(model.ID)
+			c.Check(err, IsNil)
+			_, err = repo.FindAll()
+			c.Check(err, IsNil)
+			c.Check(repo.Remove(model.ID), IsNil)
+		}()
+	}
+	wg.Wait()
+
+	result, err := repo.FindAll()
+	c.Assert(err, IsNil)
+	c.Assert(result, HasLen, 1)
+}
@@ -0,0 +1,137 @@
+package eventhorizon
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+// ErrInvalidUpdate returned when an update has a missing or invalid field,
+// an unknown operator or a non numeric increment.
+var ErrInvalidUpdate = errors.New("invalid update")
+
+// UpdateOp is an operator updating a model field.
+type UpdateOp string
+
+const (
+	// UpdateSet sets the field to the value.
+	UpdateSet UpdateOp = "set"
+	// UpdateInc increments the field by the value, which must be a number.
+	// A missing field is incremented from 0.
+	UpdateInc UpdateOp = "inc"
+)
+
+// FieldUpdate is a change of a single field of a read model.
+//
+// Field is named like in a Filter, with the JSON name for the memory and
+// Postgres repositories and the BSON name for the MongoDB repository. The id
+// of a model can not be updated.
+type FieldUpdate struct {
+	Field string
+	Op    UpdateOp
+	Value interface{}
+}
+
+// UpdateReadRepository is a read repository that can update fields of a read
+// model atomically, without first loading it.
+type UpdateReadRepository interface {
+	ReadRepository
+
+	// Update applies all updates to the read model with id as one atomic
+	// operation. Returns ErrModelNotFound if no model could be found.
+	//
+	// An example would be:
+	//     repository.Update(id, FieldUpdate{"num_accepted", UpdateInc, 1})
+	Update(id string, updates ...FieldUpdate) error
+}
+
+// validateUpdates checks that there are updates, that the fields are set
+// and unique and that increments are numbers.
+func validateUpdates(updates []FieldUpdate) error {
+	if len(updates) == 0 {
+		return ErrInvalidUpdate
+	}
+	fields := make(map[string]bool)
+	for _, u := range updates {
+		if u.Field == "" || u.Field == "id" || u.Field == "_id" || fields[u.Field] {
+			return ErrInvalidUpdate
+		}
+		fields[u.Field] = true
+
+		switch u.Op {
+		case UpdateSet:
+		case UpdateInc:
+			if !isNumber(u.Value) {
+				return ErrInvalidUpdate
+			}
+		default:
+			return ErrInvalidUpdate
+		}
+	}
+	return nil
+}
+
+// isNumber checks if a value is of any integer or float type.
+func isNumber(v interface{}) bool {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// updateJSON applies updates to a JSON document. Nested objects are created
+// as needed.
+func updateJSON(doc map[string]interface{}, updates []FieldUpdate) error {
+	for _, u := range updates {
+		value, err := toJSONValue(u.Value)
+		if err != nil {
+			return ErrInvalidUpdate
+		}
+
+		path := fieldPath(u.Field)
+		m := doc
+		for _, p := range path[:len(path)-1] {
+			next, ok := m[p].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				m[p] = next
+			}
+			m = next
+		}
+		key := path[len(path)-1]
+
+		if u.Op == UpdateInc {
+			value, err = addJSONNumbers(m[key], value.(json.Number))
+			if err != nil {
+				return err
+			}
+		}
+		m[key] = value
+	}
+	return nil
+}
+
+// addJSONNumbers adds a number to a JSON value, which must be a number or
+// missing. Integers are kept as integers.
+func addJSONNumbers(v interface{}, n json.Number) (json.Number, error) {
+	if v == nil {
+		return n, nil
+	}
+	current, ok := v.(json.Number)
+	if !ok {
+		return "", ErrInvalidUpdate
+	}
+
+	a, errA := current.Int64()
+	b, errB := n.Int64()
+	if errA == nil && errB == nil {
+		return json.Number(strconv.FormatInt(a+b, 10)), nil
+	}
+	fa, _ := current.Float64()
+	fb, _ := n.Float64()
+	return json.Number(strconv.FormatFloat(fa+fb, 'g', -1, 64)), nil
+}
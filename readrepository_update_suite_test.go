@@ -0,0 +1,132 @@
+package eventhorizon
+
+import (
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+type UpdateReadRepositorySuite struct {
+	updateRepo UpdateReadRepository
+}
+
+func (s *UpdateReadRepositorySuite) SetupUpdate(repo UpdateReadRepository) {
+	s.updateRepo = repo
+}
+
+type TestUpdateModel struct {
+	ID      string            `json:"id" bson:"id"`
+	Name    string            `json:"name" bson:"name"`
+	Count   int               `json:"count" bson:"count"`
+	Score   float64           `json:"score" bson:"score"`
+	Address TestUpdateAddress `json:"address" bson:"address"`
+	Visits  map[string]int    `json:"visits,omitempty" bson:"visits,omitempty"`
+}
+
+type TestUpdateAddress struct {
+	City string `json:"city" bson:"city"`
+}
+
+func (s *UpdateReadRepositorySuite) saveUpdateModel(c *C) *TestUpdateModel {
+	if repo, ok := s.updateRepo.(RemoteReadRepository); ok {
+		repo.SetModel(func() interface{} { return &TestUpdateModel{} })
+	}
+	model := &TestUpdateModel{
+		ID:      "1",
+		Name:    "athena",
+		Count:   1,
+		Score:   1.5,
+		Address: TestUpdateAddress{City: "athens"},
+	}
+	err := s.updateRepo.Save(model.ID, model)
+	c.Assert(err, IsNil)
+	return model
+}
+
+func (s *UpdateReadRepositorySuite) Test_Update_Set(c *C) {
+	s.saveUpdateModel(c)
+	err := s.updateRepo.Update("1",
+		FieldUpdate{"name", UpdateSet, "hades"},
+		FieldUpdate{"address.city", UpdateSet, "underworld"},
+	)
+	c.Assert(err, IsNil)
+	model, err := s.updateRepo.Find("1")
+	c.Assert(err, IsNil)
+	c.Assert(model, DeepEquals, &TestUpdateModel{
+		ID:      "1",
+		Name:    "hades",
+		Count:   1,
+		Score:   1.5,
+		Address: TestUpdateAddress{City: "underworld"},
+	})
+}
+
+func (s *UpdateReadRepositorySuite) Test_Update_Inc(c *C) {
+	s.saveUpdateModel(c)
+	err := s.updateRepo.Update("1",
+		FieldUpdate{"count", UpdateInc, 2},
+		FieldUpdate{"score", UpdateInc, 0.25},
+		FieldUpdate{"visits.athens", UpdateInc, 1},
+	)
+	c.Assert(err, IsNil)
+	err = s.updateRepo.Update("1", FieldUpdate{"count", UpdateInc, -1})
+	c.Assert(err, IsNil)
+	model, err := s.updateRepo.Find("1")
+	c.Assert(err, IsNil)
+	c.Assert(model, DeepEquals, &TestUpdateModel{
+		ID:      "1",
+		Name:    "athena",
+		Count:   2,
+		Score:   1.75,
+		Address: TestUpdateAddress{City: "athens"},
+		Visits:  map[string]int{"athens": 1},
+	})
+}
+
+func (s *UpdateReadRepositorySuite) Test_Update_NotFound(c *C) {
+	s.saveUpdateModel(c)
+	err := s.updateRepo.Update("2", FieldUpdate{"count", UpdateInc, 1})
+	c.Assert(err, Equals, ErrModelNotFound)
+}
+
+func (s *UpdateReadRepositorySuite) Test_Update_Invalid(c *C) {
+	s.saveUpdateModel(c)
+	for _, updates := range [][]FieldUpdate{
+		nil,
+		{{"", UpdateSet, 1}},
+		{{"id", UpdateSet, "2"}},
+		{{"count", "push", 1}},
+		{{"count", UpdateInc, "1"}},
+		{{"count", UpdateInc, 1}, {"count", UpdateSet, 1}},
+	} {
+		err := s.updateRepo.Update("1", updates...)
+		c.Assert(err, Equals, ErrInvalidUpdate, Commentf("%v", updates))
+	}
+}
+
+func (s *UpdateReadRepositorySuite) Test_Save_Upsert(c *C) {
+	model := s.saveUpdateModel(c)
+	model.Name = "hades"
+	err := s.updateRepo.Save(model.ID, model)
+	c.Assert(err, IsNil)
+	models, err := s.updateRepo.FindAll()
+	c.Assert(err, IsNil)
+	c.Assert(models, DeepEquals, []interface{}{model})
+}
+
+func (s *UpdateReadRepositorySuite) Test_Update_Concurrent(c *C) {
+	s.saveUpdateModel(c)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Check(s.updateRepo.Update("1", FieldUpdate{"count", UpdateInc, 1}), IsNil)
+		}()
+	}
+	wg.Wait()
+
+	model, err := s.updateRepo.Find("1")
+	c.Assert(err, IsNil)
+	c.Assert(model.(*TestUpdateModel).Count, Equals, 11)
+}
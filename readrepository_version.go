@@ -0,0 +1,41 @@
+package eventhorizon
+
+import "fmt"
+
+// VersionConflictError is returned by SaveVersion when a read model does not
+// have the expected version, because it was changed by someone else.
+type VersionConflictError struct {
+	ID      string
+	Version int
+}
+
+// Error implements the Error method of the error interface.
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("version conflict for model %s: expected version %d", e.ID, e.Version)
+}
+
+// VersionedReadRepository is a read repository that keeps a version per read
+// model, used for optimistic concurrency between writers.
+//
+// A model that does not exist has version 0. Each SaveVersion and Update
+// increments the version by one. Save is not versioned and stores the model
+// with version 0.
+//
+// A typical read-modify-write would be:
+//     model, version, err := repository.FindVersion(id)
+//     ...
+//     err = repository.SaveVersion(id, model, version)
+//     if _, ok := err.(*VersionConflictError); ok {
+//         // Retry with the latest version.
+//     }
+type VersionedReadRepository interface {
+	ReadRepository
+
+	// SaveVersion saves a read model with id if it has the expected version,
+	// otherwise it returns a VersionConflictError. A version of 0 saves a
+	// new model.
+	SaveVersion(id string, model interface{}, version int) error
+
+	// FindVersion returns a read model and its version.
+	FindVersion(id string) (interface{}, int, error)
+}
@@ -0,0 +1,71 @@
+package eventhorizon
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+type VersionedReadRepositorySuite struct {
+	versionedRepo VersionedReadRepository
+}
+
+func (s *VersionedReadRepositorySuite) SetupVersioned(repo VersionedReadRepository) {
+	s.versionedRepo = repo
+}
+
+func (s *VersionedReadRepositorySuite) Test_SaveVersion(c *C) {
+	model := NewTestModelWithID("1", "model1")
+	err := s.versionedRepo.SaveVersion(model.ID, model, 0)
+	c.Assert(err, IsNil)
+	result, version, err := s.versionedRepo.FindVersion(model.ID)
+	c.Assert(err, IsNil)
+	c.Assert(result, DeepEquals, model)
+	c.Assert(version, Equals, 1)
+
+	model.Content = "model2"
+	err = s.versionedRepo.SaveVersion(model.ID, model, 1)
+	c.Assert(err, IsNil)
+	result, version, err = s.versionedRepo.FindVersion(model.ID)
+	c.Assert(err, IsNil)
+	c.Assert(result, DeepEquals, model)
+	c.Assert(version, Equals, 2)
+}
+
+func (s *VersionedReadRepositorySuite) Test_SaveVersion_Conflict(c *C) {
+	model := NewTestModelWithID("1", "model1")
+	err := s.versionedRepo.SaveVersion(model.ID, model, 0)
+	c.Assert(err, IsNil)
+
+	// Both creating and replacing with an old version conflict.
+	conflict := NewTestModelWithID("1", "conflict")
+	err = s.versionedRepo.SaveVersion(conflict.ID, conflict, 0)
+	c.Assert(err, DeepEquals, &VersionConflictError{ID: "1", Version: 0})
+	err = s.versionedRepo.SaveVersion(conflict.ID, conflict, 2)
+	c.Assert(err, DeepEquals, &VersionConflictError{ID: "1", Version: 2})
+	err = s.versionedRepo.SaveVersion("2", conflict, 1)
+	c.Assert(err, DeepEquals, &VersionConflictError{ID: "2", Version: 1})
+
+	result, version, err := s.versionedRepo.FindVersion(model.ID)
+	c.Assert(err, IsNil)
+	c.Assert(result, DeepEquals, model)
+	c.Assert(version, Equals, 1)
+	_, _, err = s.versionedRepo.FindVersion("2")
+	c.Assert(err, Equals, ErrModelNotFound)
+}
+
+func (s *VersionedReadRepositorySuite) Test_SaveVersion_Unversioned(c *C) {
+	// Models saved without a version have version 0.
+	model := NewTestModelWithID("1", "model1")
+	err := s.versionedRepo.Save(model.ID, model)
+	c.Assert(err, IsNil)
+	_, version, err := s.versionedRepo.FindVersion(model.ID)
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, 0)
+
+	err = s.versionedRepo.SaveVersion(model.ID, model, 0)
+	c.Assert(err, IsNil)
+	err = s.versionedRepo.Save(model.ID, model)
+	c.Assert(err, IsNil)
+	_, version, err = s.versionedRepo.FindVersion(model.ID)
+	c.Assert(err, IsNil)
+	c.Assert(version, Equals, 0)
+}
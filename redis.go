@@ -0,0 +1,86 @@
+package eventhorizon
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrUnexpectedRedisReply returned when Redis replies with an unexpected format.
+var ErrUnexpectedRedisReply = errors.New("unexpected redis reply")
+
+// newRedisPool creates a connection pool for a Redis server, authenticating
+// new connections if a password is given.
+func newRedisPool(server, password string) *redis.Pool {
+	return &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 240 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			c, err := redis.Dial("tcp", server)
+			if err != nil {
+				return nil, err
+			}
+			if password != "" {
+				if _, err := c.Do("AUTH", password); err != nil {
+					c.Close()
+					return nil, err
+				}
+			}
+			return c, err
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+}
+
+// redisScanPrefix iterates over all keys starting with prefix, using SCAN to
+// not block the server. fn is called for each batch of keys.
+func redisScanPrefix(conn redis.Conn, prefix string, fn func(keys []interface{}) error) error {
+	cursor := "0"
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor,
+			"MATCH", redisEscapePattern(prefix)+"*", "COUNT", 100))
+		if err != nil {
+			return err
+		}
+		if len(reply) != 2 {
+			return ErrUnexpectedRedisReply
+		}
+
+		if cursor, err = redis.String(reply[0], nil); err != nil {
+			return err
+		}
+		keys, err := redis.Values(reply[1], nil)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+// redisDeletePrefix deletes all keys starting with prefix.
+func redisDeletePrefix(conn redis.Conn, prefix string) error {
+	return redisScanPrefix(conn, prefix, func(keys []interface{}) error {
+		_, err := conn.Do("DEL", keys...)
+		return err
+	})
+}
+
+// redisEscapePattern escapes the glob characters used by Redis patterns.
+func redisEscapePattern(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`,
+	).Replace(s)
+}
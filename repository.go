@@ -16,6 +16,8 @@ package eventhorizon
 
 import (
 	"errors"
+	"fmt"
+	"sync"
 )
 
 // Error returned when a dispatcher is created with a nil event store.
@@ -27,6 +29,55 @@ var ErrAggregateAlreadyRegistered = errors.New("aggregate is already registered"
 // Error returned when an aggregate is not registered.
 var ErrAggregateNotRegistered = errors.New("aggregate is not registered")
 
+// Error returned when an aggregate that must not exist already has events.
+var ErrAggregateExists = errors.New("aggregate already exists")
+
+// Error returned when an aggregate that must exist has no events.
+var ErrAggregateDoesNotExist = errors.New("aggregate does not exist")
+
+// AggregateLoadError is returned by Load when the events of an aggregate could
+// not be loaded from the event store.
+type AggregateLoadError struct {
+	AggregateType string
+	AggregateID   string
+	Err           error
+}
+
+// Error implements the Error method of the error interface.
+func (e *AggregateLoadError) Error() string {
+	return fmt.Sprintf("could not load aggregate %s %s: %s", e.AggregateType, e.AggregateID, e.Err)
+}
+
+// Unwrap returns the error of the event store.
+func (e *AggregateLoadError) Unwrap() error {
+	return e.Err
+}
+
+// AggregateExistence is what is required of the existence of an aggregate.
+// An aggregate exists when it has events, it has version 0 otherwise.
+type AggregateExistence int
+
+const (
+	// AggregateMayExist allows both new and existing aggregates.
+	AggregateMayExist AggregateExistence = iota
+	// AggregateMustExist requires an aggregate that has events.
+	AggregateMustExist
+	// AggregateMustNotExist requires a new aggregate without events.
+	AggregateMustNotExist
+)
+
+// Check returns ErrAggregateDoesNotExist if an aggregate must exist but does not
+// and ErrAggregateExists if it must not exist but does.
+func (e AggregateExistence) Check(aggregate Aggregate) error {
+	switch {
+	case e == AggregateMustExist && aggregate.Version() == 0:
+		return ErrAggregateDoesNotExist
+	case e == AggregateMustNotExist && aggregate.Version() > 0:
+		return ErrAggregateExists
+	}
+	return nil
+}
+
 // Repository is a repository responsible for loading and saving aggregates.
 type Repository interface {
 	// Load loads an aggregate with a type and id.
@@ -37,9 +88,15 @@ type Repository interface {
 }
 
 // CallbackRepository is an aggregate repository using factory functions.
+// Loading and saving aggregates is traced, see SetTracer, and loaded
+// aggregates can be cached, see SetCache.
 type CallbackRepository struct {
 	eventStore EventStore
 	callbacks  map[string]func(string) Aggregate
+	cache      *aggregateCache
+	cacheLock  sync.RWMutex
+
+	instrumentation
 }
 
 // NewCallbackRepository creates a repository and associates it with an event store.
@@ -70,19 +127,46 @@ func (r *CallbackRepository) RegisterAggregate(aggregate Aggregate, callback fun
 	return nil
 }
 
-// Load loads an aggregate by creating it and applying all events.
+// Load loads an aggregate by creating it and applying all events. An aggregate
+// without events is new, other errors of the event store are returned as an
+// AggregateLoadError.
 func (r *CallbackRepository) Load(aggregateType string, id string) (Aggregate, error) {
+	return r.loadTraced(SpanContext{}, aggregateType, id)
+}
+
+// traced returns the repository, see isTraced.
+func (r *CallbackRepository) traced() interface{} { return r }
+
+// loadTraced loads an aggregate as a child of parent.
+func (r *CallbackRepository) loadTraced(parent SpanContext, aggregateType string, id string) (aggregate Aggregate, err error) {
+	span := r.startSpan("load_aggregate", parent,
+		spanAttributes("callback_repository", map[string]string{
+			"aggregateID":   id,
+			"aggregateType": aggregateType,
+		}))
+	defer span.end(&err)
+
 	// Get the registered factory function for creating aggregates.
 	f, ok := r.callbacks[aggregateType]
 	if !ok {
 		return nil, ErrAggregateNotRegistered
 	}
 
+	// Use a cached aggregate if possible.
+	if c := r.aggregateCache(); c != nil {
+		if aggregate, ok := r.cachedAggregate(c, span.Context(), aggregateType, id); ok {
+			return aggregate, nil
+		}
+	}
+
 	// Create aggregate with factory.
-	aggregate := f(id)
+	aggregate = f(id)
 
 	// Load aggregate events.
-	events, _ := r.eventStore.Load(aggregate.AggregateID())
+	events, err := loadEvents(r.eventStore, span.Context(), aggregate.AggregateID())
+	if err != nil && err != ErrNoEventsFound {
+		return nil, &AggregateLoadError{aggregateType, id, err}
+	}
 
 	// Apply the events.
 	for _, event := range events {
@@ -93,16 +177,48 @@ func (r *CallbackRepository) Load(aggregateType string, id string) (Aggregate, e
 	return aggregate, nil
 }
 
+// LoadRequiring loads an aggregate like Load and checks its existence, see
+// AggregateExistence.
+//
+// An example would be:
+//     aggregate, err := repository.LoadRequiring("Invitation", id, AggregateMustExist)
+func (r *CallbackRepository) LoadRequiring(aggregateType string, id string, existence AggregateExistence) (Aggregate, error) {
+	aggregate, err := r.Load(aggregateType, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := existence.Check(aggregate); err != nil {
+		return nil, err
+	}
+	return aggregate, nil
+}
+
 // Save saves all uncommitted events from an aggregate.
 func (r *CallbackRepository) Save(aggregate Aggregate) error {
+	return r.saveTraced(SpanContext{}, aggregate)
+}
+
+// saveTraced saves an aggregate as a child of parent.
+func (r *CallbackRepository) saveTraced(parent SpanContext, aggregate Aggregate) (err error) {
+	span := r.startSpan("save_aggregate", parent,
+		spanAttributes("callback_repository", map[string]string{
+			"aggregateID":   aggregate.AggregateID(),
+			"aggregateType": aggregate.AggregateType(),
+		}))
+	defer span.end(&err)
+
 	resultEvents := aggregate.GetUncommittedEvents()
 
 	if len(resultEvents) > 0 {
 		// Store events
-		err := r.eventStore.Save(resultEvents)
-		if err != nil {
-			return err
-		}
+		err = saveEvents(r.eventStore, span.Context(), resultEvents)
+	}
+
+	if c := r.aggregateCache(); c != nil {
+		c.cacheAggregate(aggregate, resultEvents, err)
+	}
+	if err != nil {
+		return err
 	}
 
 	aggregate.ClearUncommittedEvents()
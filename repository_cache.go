@@ -0,0 +1,141 @@
+package eventhorizon
+
+import (
+	"sync"
+	"time"
+)
+
+// aggregateCache keeps the most recently saved aggregates of a repository.
+//
+// An aggregate is taken out of the cache when it is loaded and put back when
+// it is saved, so commands for the same aggregate never share it and an
+// aggregate that failed to handle a command is dropped. Aggregates that are
+// invalidated while they are loaded are not put back.
+type aggregateCache struct {
+	aggregates *lruCache
+	// loaded are the keys of the loaded aggregates, with false if they
+	// have been invalidated since.
+	loaded *lruCache
+	ttl    time.Duration
+	lock   sync.Mutex
+}
+
+type cachedAggregate struct {
+	aggregate Aggregate
+	expires   time.Time
+}
+
+// SetCache caches up to size aggregates, which expire after ttl unless it
+// is 0. A size of 0 disables the cache.
+//
+// Saved events are applied to a cached aggregate, so it must only change its
+// state in ApplyEvent. If the event store is a VersionedEventStore, or
+// decorates one, a cached aggregate is only used if it has the version of the
+// stored events, otherwise the repository must be the only writer of the
+// store, or be added as a global handler to a remote event bus to invalidate
+// the aggregates of received events.
+//
+// An example would be:
+//     repository.SetCache(1000, time.Minute)
+func (r *CallbackRepository) SetCache(size int, ttl time.Duration) error {
+	if size < 0 || ttl < 0 {
+		return ErrInvalidCacheSize
+	}
+
+	r.cacheLock.Lock()
+	defer r.cacheLock.Unlock()
+	if size == 0 {
+		r.cache = nil
+		return nil
+	}
+	r.cache = &aggregateCache{
+		aggregates: newLRUCache(size),
+		loaded:     newLRUCache(size),
+		ttl:        ttl,
+	}
+	return nil
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler
+// interface. It removes the aggregate of the event from the cache.
+func (r *CallbackRepository) HandleEvent(event Event) {
+	if c := r.aggregateCache(); c != nil {
+		c.invalidate(aggregateCacheKey(event.AggregateType(), event.AggregateID()))
+	}
+}
+
+// aggregateCache returns the cache, or nil if there is none.
+func (r *CallbackRepository) aggregateCache() *aggregateCache {
+	r.cacheLock.RLock()
+	defer r.cacheLock.RUnlock()
+	return r.cache
+}
+
+// cachedAggregate takes an aggregate out of the cache. It is only returned if
+// it has not expired and has the version of the stored events, which is
+// loaded as a child of parent.
+func (r *CallbackRepository) cachedAggregate(c *aggregateCache, parent SpanContext, aggregateType, id string) (Aggregate, bool) {
+	key := aggregateCacheKey(aggregateType, id)
+	c.lock.Lock()
+	v, ok := c.aggregates.get(key)
+	c.aggregates.remove(key)
+	c.loaded.add(key, true)
+	c.lock.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	cached := v.(cachedAggregate)
+	if !cached.expires.IsZero() && time.Now().After(cached.expires) {
+		return nil, false
+	}
+	if store, ok := r.eventStore.(VersionedEventStore); ok {
+		version, err := aggregateVersion(store, parent, id)
+		if err == ErrEventStoreNotVersioned {
+			return cached.aggregate, true
+		}
+		if err != nil || version != cached.aggregate.Version() {
+			return nil, false
+		}
+	}
+	return cached.aggregate, true
+}
+
+// cacheAggregate puts an aggregate back in the cache after its events have
+// been saved, with the events applied. If saving failed it is removed.
+func (c *aggregateCache) cacheAggregate(aggregate Aggregate, events []Event, err error) {
+	key := aggregateCacheKey(aggregate.AggregateType(), aggregate.AggregateID())
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	valid, ok := c.loaded.get(key)
+	c.loaded.remove(key)
+	if err != nil || !ok || !valid.(bool) {
+		c.aggregates.remove(key)
+		return
+	}
+
+	for _, event := range events {
+		aggregate.ApplyEvent(event)
+		aggregate.IncrementVersion()
+	}
+	cached := cachedAggregate{aggregate: aggregate}
+	if c.ttl > 0 {
+		cached.expires = time.Now().Add(c.ttl)
+	}
+	c.aggregates.add(key, cached)
+}
+
+// invalidate removes an aggregate from the cache, and prevents it from being
+// put back if it is loaded.
+func (c *aggregateCache) invalidate(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.aggregates.remove(key)
+	if _, ok := c.loaded.get(key); ok {
+		c.loaded.add(key, false)
+	}
+}
+
+func aggregateCacheKey(aggregateType, id string) string {
+	return aggregateType + ":" + id
+}
@@ -0,0 +1,186 @@
+package eventhorizon
+
+import (
+	"errors"
+	"time"
+
+	"github.com/odeke-em/go-uuid"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&AggregateCacheSuite{})
+
+type AggregateCacheSuite struct {
+	store *countingVersionedEventStore
+	repo  *CallbackRepository
+}
+
+// countingVersionedEventStore counts the loads of each aggregate and can
+// fail to save.
+type countingVersionedEventStore struct {
+	*MemoryEventStore
+	loads   map[string]int
+	saveErr error
+}
+
+func (s *countingVersionedEventStore) Load(id string) ([]Event, error) {
+	s.loads[id]++
+	return s.MemoryEventStore.Load(id)
+}
+
+func (s *countingVersionedEventStore) Save(events []Event) error {
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	return s.MemoryEventStore.Save(events)
+}
+
+func (s *AggregateCacheSuite) SetUpTest(c *C) {
+	s.store = &countingVersionedEventStore{NewMemoryEventStore(nil), map[string]int{}, nil}
+	s.repo, _ = NewCallbackRepository(s.store)
+	s.repo.RegisterAggregate(&TestRepositoryAggregate{}, func(id string) Aggregate {
+		return &TestRepositoryAggregate{AggregateBase: NewAggregateBase(id)}
+	})
+	c.Assert(s.repo.SetCache(10, 0), IsNil)
+}
+
+// handle loads an aggregate, stores an event and saves it.
+func (s *AggregateCacheSuite) handle(c *C, id string, event Event) Aggregate {
+	aggregate, err := s.repo.Load("TestRepositoryAggregate", id)
+	c.Assert(err, IsNil)
+	if event != nil {
+		aggregate.StoreEvent(event)
+	}
+	c.Assert(s.repo.Save(aggregate), IsNil)
+	return aggregate
+}
+
+func (s *AggregateCacheSuite) TestSetCache(c *C) {
+	c.Assert(s.repo.SetCache(-1, 0), Equals, ErrInvalidCacheSize)
+	c.Assert(s.repo.SetCache(1, -time.Second), Equals, ErrInvalidCacheSize)
+	c.Assert(s.repo.SetCache(0, 0), IsNil)
+	c.Assert(s.repo.aggregateCache(), IsNil)
+}
+
+func (s *AggregateCacheSuite) TestCache(c *C) {
+	id := uuid.New()
+	event1 := &TestEvent{id, "event1"}
+	event2 := &TestEvent{id, "event2"}
+	aggregate := s.handle(c, id, event1)
+	c.Assert(aggregate.Version(), Equals, 1)
+	c.Assert(aggregate.(*TestRepositoryAggregate).event, Equals, event1)
+
+	// The saved aggregate is cached, with the saved events applied.
+	cached := s.handle(c, id, event2)
+	c.Assert(cached, Equals, aggregate)
+	c.Assert(cached.Version(), Equals, 2)
+	c.Assert(cached.(*TestRepositoryAggregate).event, Equals, event2)
+	c.Assert(s.store.loads[id], Equals, 1)
+
+	// A loaded aggregate is not shared until it is saved.
+	loaded, err := s.repo.Load("TestRepositoryAggregate", id)
+	c.Assert(err, IsNil)
+	c.Assert(loaded, Equals, aggregate)
+	other, err := s.repo.Load("TestRepositoryAggregate", id)
+	c.Assert(err, IsNil)
+	c.Assert(other, Not(Equals), aggregate)
+	c.Assert(other.Version(), Equals, 2)
+	c.Assert(s.store.loads[id], Equals, 2)
+}
+
+func (s *AggregateCacheSuite) TestVersion(c *C) {
+	id := uuid.New()
+	aggregate := s.handle(c, id, &TestEvent{id, "event1"})
+
+	// Events saved by another writer are detected by their version.
+	err := s.store.MemoryEventStore.Save([]Event{&TestEvent{id, "event2"}})
+	c.Assert(err, IsNil)
+	loaded := s.handle(c, id, nil)
+	c.Assert(loaded, Not(Equals), aggregate)
+	c.Assert(loaded.Version(), Equals, 2)
+	c.Assert(s.store.loads[id], Equals, 2)
+}
+
+func (s *AggregateCacheSuite) TestVersionDecorated(c *C) {
+	encrypting, err := NewEncryptingEventStore(nil, testEncryptionKey)
+	c.Assert(err, IsNil)
+	store := DecorateEventStore(s.store,
+		NewMetricsEventStore(nil, "decorated_event_store"), NewTraceEventStore(nil), encrypting)
+	s.repo.eventStore = store
+
+	// The version is passed on by the decorators.
+	id := uuid.New()
+	aggregate := s.handle(c, id, &TestEvent{id, "event1"})
+	c.Assert(s.handle(c, id, nil), Equals, aggregate)
+	err = s.store.MemoryEventStore.Save([]Event{&TestEvent{id, "event2"}})
+	c.Assert(err, IsNil)
+	loaded := s.handle(c, id, nil)
+	c.Assert(loaded, Not(Equals), aggregate)
+	c.Assert(loaded.Version(), Equals, 2)
+	c.Assert(s.store.loads[id], Equals, 2)
+
+	// Decorated stores that are not versioned still use the cache.
+	base := &countingEventStore{NewMemoryEventStore(nil), map[string]int{}}
+	s.repo.eventStore = NewTraceEventStore(base)
+	_, err = NewTraceEventStore(base).AggregateVersion(id)
+	c.Assert(err, Equals, ErrEventStoreNotVersioned)
+	id = uuid.New()
+	aggregate = s.handle(c, id, &TestEvent{id, "event1"})
+	c.Assert(s.handle(c, id, nil), Equals, aggregate)
+	c.Assert(base.loads[id], Equals, 1)
+}
+
+func (s *AggregateCacheSuite) TestTTL(c *C) {
+	c.Assert(s.repo.SetCache(10, 10*time.Millisecond), IsNil)
+	id := uuid.New()
+	aggregate := s.handle(c, id, &TestEvent{id, "event1"})
+	c.Assert(s.handle(c, id, nil), Equals, aggregate)
+	time.Sleep(20 * time.Millisecond)
+	c.Assert(s.handle(c, id, nil), Not(Equals), aggregate)
+	c.Assert(s.store.loads[id], Equals, 2)
+}
+
+func (s *AggregateCacheSuite) TestSaveError(c *C) {
+	id := uuid.New()
+	aggregate := s.handle(c, id, &TestEvent{id, "event1"})
+
+	loaded, _ := s.repo.Load("TestRepositoryAggregate", id)
+	loaded.StoreEvent(&TestEvent{id, "event2"})
+	s.store.saveErr = errors.New("conflict")
+	c.Assert(s.repo.Save(loaded), ErrorMatches, "conflict")
+	s.store.saveErr = nil
+
+	loaded = s.handle(c, id, nil)
+	c.Assert(loaded, Not(Equals), aggregate)
+	c.Assert(loaded.Version(), Equals, 1)
+}
+
+func (s *AggregateCacheSuite) TestHandleEvent(c *C) {
+	id := uuid.New()
+	aggregate := s.handle(c, id, &TestEvent{id, "event1"})
+
+	// An event for the aggregate removes it from the cache.
+	s.repo.HandleEvent(&testRepositoryEvent{id})
+	c.Assert(s.handle(c, id, nil), Not(Equals), aggregate)
+	c.Assert(s.store.loads[id], Equals, 2)
+
+	// An event for a loaded aggregate prevents it from being cached.
+	loaded, _ := s.repo.Load("TestRepositoryAggregate", id)
+	s.repo.HandleEvent(&testRepositoryEvent{id})
+	c.Assert(s.repo.Save(loaded), IsNil)
+	c.Assert(s.handle(c, id, nil), Not(Equals), loaded)
+	c.Assert(s.store.loads[id], Equals, 3)
+
+	// Events of other aggregate types are ignored.
+	cached := s.handle(c, id, nil)
+	s.repo.HandleEvent(&TestEvent{id, "event2"})
+	c.Assert(s.handle(c, id, nil), Equals, cached)
+}
+
+type testRepositoryEvent struct {
+	TestID string
+}
+
+func (t *testRepositoryEvent) AggregateID() string   { return t.TestID }
+func (t *testRepositoryEvent) AggregateType() string { return "TestRepositoryAggregate" }
+func (t *testRepositoryEvent) EventType() string     { return "testRepositoryEvent" }
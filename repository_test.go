@@ -17,6 +17,7 @@ package eventhorizon
 import (
 	// "fmt"
 	// "time"
+	"errors"
 
 	"github.com/odeke-em/go-uuid"
 	. "gopkg.in/check.v1"
@@ -149,3 +150,70 @@ func (s *CallbackRepositorySuite) Test_RegisterTwice(c *C) {
 	)
 	c.Assert(err, Equals, ErrAggregateAlreadyRegistered)
 }
+
+// errorEventStore fails to load events.
+type errorEventStore struct {
+	MockEventStore
+	err error
+}
+
+func (s *errorEventStore) Load(id string) ([]Event, error) {
+	return nil, s.err
+}
+
+func (s *CallbackRepositorySuite) Test_Load_Error(c *C) {
+	storeErr := errors.New("i/o timeout")
+	repo, _ := NewCallbackRepository(&errorEventStore{err: storeErr})
+	repo.RegisterAggregate(&TestRepositoryAggregate{}, func(id string) Aggregate {
+		return &TestRepositoryAggregate{AggregateBase: NewAggregateBase(id)}
+	})
+
+	id := uuid.New()
+	agg, err := repo.Load("TestRepositoryAggregate", id)
+	c.Assert(agg, IsNil)
+	c.Assert(err, DeepEquals, &AggregateLoadError{"TestRepositoryAggregate", id, storeErr})
+	c.Assert(err, ErrorMatches, "could not load aggregate TestRepositoryAggregate "+id+": i/o timeout")
+	c.Assert(errors.Unwrap(err), Equals, storeErr)
+
+	// An aggregate without events is new.
+	repo, _ = NewCallbackRepository(&errorEventStore{err: ErrNoEventsFound})
+	repo.RegisterAggregate(&TestRepositoryAggregate{}, func(id string) Aggregate {
+		return &TestRepositoryAggregate{AggregateBase: NewAggregateBase(id)}
+	})
+	agg, err = repo.Load("TestRepositoryAggregate", id)
+	c.Assert(err, IsNil)
+	c.Assert(agg.Version(), Equals, 0)
+}
+
+func (s *CallbackRepositorySuite) Test_LoadRequiring(c *C) {
+	err := s.repo.RegisterAggregate(&TestRepositoryAggregate{},
+		func(id string) Aggregate {
+			return &TestRepositoryAggregate{
+				AggregateBase: NewAggregateBase(id),
+			}
+		},
+	)
+	c.Assert(err, IsNil)
+
+	id := uuid.New()
+	agg, err := s.repo.LoadRequiring("TestRepositoryAggregate", id, AggregateMustExist)
+	c.Assert(err, Equals, ErrAggregateDoesNotExist)
+	c.Assert(agg, IsNil)
+	agg, err = s.repo.LoadRequiring("TestRepositoryAggregate", id, AggregateMustNotExist)
+	c.Assert(err, IsNil)
+	c.Assert(agg.Version(), Equals, 0)
+
+	s.store.Save([]Event{&TestEvent{id, "event"}})
+	agg, err = s.repo.LoadRequiring("TestRepositoryAggregate", id, AggregateMustNotExist)
+	c.Assert(err, Equals, ErrAggregateExists)
+	c.Assert(agg, IsNil)
+	agg, err = s.repo.LoadRequiring("TestRepositoryAggregate", id, AggregateMustExist)
+	c.Assert(err, IsNil)
+	c.Assert(agg.Version(), Equals, 1)
+	agg, err = s.repo.LoadRequiring("TestRepositoryAggregate", id, AggregateMayExist)
+	c.Assert(err, IsNil)
+	c.Assert(agg.Version(), Equals, 1)
+
+	agg, err = s.repo.LoadRequiring("Unknown", id, AggregateMayExist)
+	c.Assert(err, Equals, ErrAggregateNotRegistered)
+}
@@ -0,0 +1,338 @@
+package eventhorizon
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanContext identifies a span and its trace, like in the W3C Trace Context.
+// The zero value is invalid and starts a new trace when used as parent.
+type SpanContext struct {
+	// TraceID is the 32 character hex id of the trace.
+	TraceID string
+	// SpanID is the 16 character hex id of the span.
+	SpanID string
+}
+
+// IsValid returns true if both ids are set.
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != "" && c.SpanID != ""
+}
+
+// Tracer creates spans, see MemoryTracer. Components start spans around
+// command handling, aggregate loading and saving, event store operations and
+// event handlers, but report nothing until a tracer is set with their
+// SetTracer method.
+//
+// Within a process the span context is passed down the call chain by the
+// command buses, command handler, repository, event stores and event buses of
+// this package, so that for example the event store span of a command
+// handler saving an aggregate is a child of its command span. Commands that
+// are handled by event handlers start new traces. Between processes the span
+// context is sent with the commands and events, in the traceparent header of
+// RabbitMQ messages and in the traceparent field of Redis messages.
+type Tracer interface {
+	// StartSpan starts a span as a child of parent, or as the root of a new
+	// trace if the parent is invalid.
+	StartSpan(name string, parent SpanContext, attributes map[string]string) Span
+}
+
+// Span is an operation that is traced.
+type Span interface {
+	// Context returns the context of the span, which is passed on to the
+	// spans of the operations that it causes.
+	Context() SpanContext
+
+	// SetError marks the span as failed.
+	SetError(error)
+
+	// End ends the span.
+	End()
+}
+
+// NopTracer is a Tracer that records nothing, it is the default of all
+// components. Its spans have the context of their parent, so a trace is
+// passed on by components without a tracer.
+type NopTracer struct{}
+
+// StartSpan implements the StartSpan method of the Tracer interface.
+func (NopTracer) StartSpan(name string, parent SpanContext, attributes map[string]string) Span {
+	return nopSpan{parent}
+}
+
+type nopSpan struct {
+	context SpanContext
+}
+
+func (s nopSpan) Context() SpanContext { return s.context }
+func (s nopSpan) SetError(error)       {}
+func (s nopSpan) End()                 {}
+
+// MemoryTracer is a Tracer that keeps the ended spans in memory, mostly
+// useful for tests.
+type MemoryTracer struct {
+	spans []SpanData
+	lock  sync.Mutex
+}
+
+// SpanData is a span that has ended.
+type SpanData struct {
+	Name       string
+	Context    SpanContext
+	Parent     SpanContext
+	Attributes map[string]string
+	Err        error
+	Start      time.Time
+	End        time.Time
+}
+
+// NewMemoryTracer creates a MemoryTracer.
+func NewMemoryTracer() *MemoryTracer {
+	return &MemoryTracer{}
+}
+
+// StartSpan implements the StartSpan method of the Tracer interface.
+func (t *MemoryTracer) StartSpan(name string, parent SpanContext, attributes map[string]string) Span {
+	context := SpanContext{TraceID: parent.TraceID, SpanID: newSpanID(8)}
+	if !parent.IsValid() {
+		context.TraceID = newSpanID(16)
+		parent = SpanContext{}
+	}
+	return &memorySpan{
+		tracer: t,
+		data: SpanData{
+			Name:       name,
+			Context:    context,
+			Parent:     parent,
+			Attributes: attributes,
+			Start:      time.Now(),
+		},
+	}
+}
+
+// Spans returns the spans that have ended, in the order they ended.
+func (t *MemoryTracer) Spans() []SpanData {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]SpanData(nil), t.spans...)
+}
+
+// Reset removes all spans.
+func (t *MemoryTracer) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.spans = nil
+}
+
+type memorySpan struct {
+	tracer *MemoryTracer
+	data   SpanData
+	ended  bool
+}
+
+func (s *memorySpan) Context() SpanContext { return s.data.Context }
+
+func (s *memorySpan) SetError(err error) {
+	s.data.Err = err
+}
+
+func (s *memorySpan) End() {
+	if s.ended {
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.tracer.lock.Lock()
+	defer s.tracer.lock.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s.data)
+}
+
+// newSpanID returns n random bytes as hex.
+func newSpanID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tracerValue wraps a tracer, atomic.Value needs values of the same type.
+type tracerValue struct {
+	Tracer
+}
+
+// SetTracer sets the tracer, the default is NopTracer.
+func (i *instrumentation) SetTracer(tracer Tracer) {
+	i.currentTracer.Store(tracerValue{tracer})
+}
+
+// tracer returns the tracer.
+func (i *instrumentation) tracer() Tracer {
+	if v, ok := i.currentTracer.Load().(tracerValue); ok {
+		return v.Tracer
+	}
+	return NopTracer{}
+}
+
+// startSpan starts a span as a child of parent, or as the root of a new trace
+// if parent is invalid.
+func (i *instrumentation) startSpan(name string, parent SpanContext, attributes map[string]string) startedSpan {
+	return startedSpan{i.tracer().StartSpan(name, parent, attributes)}
+}
+
+// startedSpan is a span that is ended with end.
+type startedSpan struct {
+	Span
+}
+
+// end ends the span, with the error that *err has when it is called,
+// typically deferred.
+func (s startedSpan) end(err *error) {
+	if err != nil && *err != nil {
+		s.SetError(*err)
+	}
+	s.End()
+}
+
+// traced is implemented by the components that have traced methods, like
+// handleCommandTraced, that are used instead of their exported methods when
+// the parent span is known. traced returns the component itself.
+type traced interface {
+	traced() interface{}
+}
+
+// isTraced checks if the traced methods of a component can be used. They are
+// not if the component is embedded in another type, which may change the
+// exported methods, as its traced method then returns the embedded value.
+func isTraced(component interface{}) bool {
+	t, ok := component.(traced)
+	return ok && t.traced() == component
+}
+
+// tracedCommandHandler is a CommandHandler that handles commands as a child
+// of a span, like the command buses and handler of this package.
+type tracedCommandHandler interface {
+	handleCommandTraced(parent SpanContext, command Command) error
+}
+
+// handleCommand handles a command as a child of parent, if the handler is
+// traced.
+func handleCommand(handler CommandHandler, parent SpanContext, command Command) error {
+	if h, ok := handler.(tracedCommandHandler); ok && isTraced(handler) {
+		return h.handleCommandTraced(parent, command)
+	}
+	return handler.HandleCommand(command)
+}
+
+// tracedRepository is a Repository that loads and saves aggregates as a
+// child of a span, like the CallbackRepository.
+type tracedRepository interface {
+	loadTraced(parent SpanContext, aggregateType, id string) (Aggregate, error)
+	saveTraced(parent SpanContext, aggregate Aggregate) error
+}
+
+// loadAggregate loads an aggregate as a child of parent, if the repository is
+// traced.
+func loadAggregate(repository Repository, parent SpanContext, aggregateType, id string) (Aggregate, error) {
+	if r, ok := repository.(tracedRepository); ok && isTraced(repository) {
+		return r.loadTraced(parent, aggregateType, id)
+	}
+	return repository.Load(aggregateType, id)
+}
+
+// saveAggregate saves an aggregate as a child of parent, if the repository is
+// traced.
+func saveAggregate(repository Repository, parent SpanContext, aggregate Aggregate) error {
+	if r, ok := repository.(tracedRepository); ok && isTraced(repository) {
+		return r.saveTraced(parent, aggregate)
+	}
+	return repository.Save(aggregate)
+}
+
+// tracedEventStore is an EventStore that saves and loads events as a child
+// of a span, like the event stores and decorators of this package.
+type tracedEventStore interface {
+	saveTraced(parent SpanContext, events []Event) error
+	loadTraced(parent SpanContext, id string) ([]Event, error)
+}
+
+// saveEvents saves events as a child of parent, if the store is traced.
+func saveEvents(store EventStore, parent SpanContext, events []Event) error {
+	if s, ok := store.(tracedEventStore); ok && isTraced(store) {
+		return s.saveTraced(parent, events)
+	}
+	return store.Save(events)
+}
+
+// loadEvents loads events as a child of parent, if the store is traced.
+func loadEvents(store EventStore, parent SpanContext, id string) ([]Event, error) {
+	if s, ok := store.(tracedEventStore); ok && isTraced(store) {
+		return s.loadTraced(parent, id)
+	}
+	return store.Load(id)
+}
+
+// tracedVersionedEventStore is a VersionedEventStore that loads the version
+// of an aggregate as a child of a span.
+type tracedVersionedEventStore interface {
+	aggregateVersionTraced(parent SpanContext, id string) (int, error)
+}
+
+// aggregateVersion loads the version of an aggregate as a child of parent, if
+// the store is traced.
+func aggregateVersion(store VersionedEventStore, parent SpanContext, id string) (int, error) {
+	if s, ok := store.(tracedVersionedEventStore); ok && isTraced(store) {
+		return s.aggregateVersionTraced(parent, id)
+	}
+	return store.AggregateVersion(id)
+}
+
+// tracedEventBus is an EventBus that publishes events as a child of a span,
+// like the event buses of this package.
+type tracedEventBus interface {
+	publishEventTraced(parent SpanContext, event Event)
+}
+
+// publishEvent publishes an event as a child of parent, if the bus is traced.
+func publishEvent(bus EventBus, parent SpanContext, event Event) {
+	if b, ok := bus.(tracedEventBus); ok && isTraced(bus) {
+		b.publishEventTraced(parent, event)
+		return
+	}
+	bus.PublishEvent(event)
+}
+
+// spanAttributes returns the attributes of a span of a component.
+func spanAttributes(component string, fields map[string]string) map[string]string {
+	attributes := map[string]string{"component": component}
+	for k, v := range fields {
+		attributes[k] = v
+	}
+	return attributes
+}
+
+// traceparent formats a span context as a W3C traceparent header, or returns
+// an empty string if it is invalid.
+func traceparent(context SpanContext) string {
+	if !context.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", context.TraceID, context.SpanID)
+}
+
+// parseTraceparent parses a W3C traceparent header, an invalid header gives
+// an invalid span context.
+func parseTraceparent(header string) SpanContext {
+	parts := strings.Split(header, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return SpanContext{}
+	}
+	for _, id := range parts[1:3] {
+		if _, err := hex.DecodeString(id); err != nil {
+			return SpanContext{}
+		}
+	}
+	return SpanContext{TraceID: parts[1], SpanID: parts[2]}
+}
@@ -0,0 +1,273 @@
+package eventhorizon
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/odeke-em/go-uuid"
+	"github.com/streadway/amqp"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&TracingSuite{})
+
+type TracingSuite struct{}
+
+// spanTree returns the spans as "name < parent name", in the order they
+// ended, and checks that they are all in the same trace.
+func spanTree(c *C, spans []SpanData) []string {
+	names := map[string]string{}
+	for _, span := range spans {
+		names[span.Context.SpanID] = span.Name
+		c.Assert(span.Context.TraceID, Equals, spans[0].Context.TraceID)
+	}
+	var tree []string
+	for _, span := range spans {
+		if span.Parent.IsValid() {
+			tree = append(tree, span.Name+" < "+names[span.Parent.SpanID])
+		} else {
+			tree = append(tree, span.Name)
+		}
+	}
+	return tree
+}
+
+func (s *TracingSuite) TestSetTracer(c *C) {
+	var i instrumentation
+	c.Assert(i.tracer(), Equals, NopTracer{})
+	tracer := NewMemoryTracer()
+	i.SetTracer(tracer)
+	c.Assert(i.tracer(), Equals, tracer)
+}
+
+func (s *TracingSuite) TestNopTracer(c *C) {
+	parent := SpanContext{"0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"}
+	span := NopTracer{}.StartSpan("span", parent, nil)
+	c.Assert(span.Context(), Equals, parent)
+	span = NopTracer{}.StartSpan("span", SpanContext{}, nil)
+	c.Assert(span.Context().IsValid(), Equals, false)
+}
+
+func (s *TracingSuite) TestMemoryTracer(c *C) {
+	tracer := NewMemoryTracer()
+	root := tracer.StartSpan("root", SpanContext{}, nil)
+	c.Assert(root.Context().TraceID, HasLen, 32)
+	c.Assert(root.Context().SpanID, HasLen, 16)
+	child := tracer.StartSpan("child", root.Context(), map[string]string{"key": "value"})
+	child.SetError(errors.New("error"))
+	child.End()
+	child.End()
+	root.End()
+
+	spans := tracer.Spans()
+	c.Assert(spans, HasLen, 2)
+	c.Assert(spans[0].Name, Equals, "child")
+	c.Assert(spans[0].Context.TraceID, Equals, root.Context().TraceID)
+	c.Assert(spans[0].Parent, Equals, root.Context())
+	c.Assert(spans[0].Attributes, DeepEquals, map[string]string{"key": "value"})
+	c.Assert(spans[0].Err, ErrorMatches, "error")
+	c.Assert(spans[1].Name, Equals, "root")
+	c.Assert(spans[1].Parent.IsValid(), Equals, false)
+
+	tracer.Reset()
+	c.Assert(tracer.Spans(), HasLen, 0)
+}
+
+func (s *TracingSuite) TestCommand(c *C) {
+	eventBus := NewInternalEventBus()
+	eventBus.AddHandler(NewMockEventHandler(), &TestEvent{})
+	store := NewMemoryEventStore(eventBus)
+	repo, _ := NewCallbackRepository(store)
+	repo.RegisterAggregate(&TestDispatcherAggregate{}, func(id string) Aggregate {
+		return &TestDispatcherAggregate{NewAggregateBase(id)}
+	})
+	handler, _ := NewAggregateCommandHandler(repo)
+	handler.SetAggregate(&TestDispatcherAggregate{}, &TestCommand{})
+	bus := NewInternalCommandBus()
+	bus.SetHandler(handler, &TestCommand{})
+
+	tracer := NewMemoryTracer()
+	eventBus.SetTracer(tracer)
+	store.SetTracer(tracer)
+	repo.SetTracer(tracer)
+	handler.SetTracer(tracer)
+	bus.SetTracer(tracer)
+
+	id := uuid.New()
+	err := bus.HandleCommand(&TestCommand{id, "command1"})
+	c.Assert(err, IsNil)
+	spans := tracer.Spans()
+	c.Assert(spanTree(c, spans), DeepEquals, []string{
+		"load_events < load_aggregate",
+		"load_aggregate < handle_command",
+		"handle_event < save_events",
+		"save_events < save_aggregate",
+		"save_aggregate < handle_command",
+		"handle_command < handle_command",
+		"handle_command",
+	})
+	c.Assert(spans[0].Err, IsNil)
+	c.Assert(spans[2].Attributes, DeepEquals, map[string]string{
+		"component":     "internal_event_bus",
+		"handler":       "*eventhorizon.MockEventHandler",
+		"eventType":     "TestEvent",
+		"aggregateID":   id,
+		"aggregateType": "Test",
+	})
+	c.Assert(spans[5].Attributes["component"], Equals, "aggregate_command_handler")
+	c.Assert(spans[6].Attributes["component"], Equals, "internal_command_bus")
+
+	tracer.Reset()
+	err = bus.HandleCommand(&TestCommand{id, "error"})
+	c.Assert(err, NotNil)
+	spans = tracer.Spans()
+	c.Assert(spanTree(c, spans), DeepEquals, []string{
+		"load_events < load_aggregate",
+		"load_aggregate < handle_command",
+		"handle_command < handle_command",
+		"handle_command",
+	})
+	c.Assert(spans[2].Err, ErrorMatches, "command error")
+	c.Assert(spans[3].Err, ErrorMatches, "command error")
+}
+
+func (s *TracingSuite) TestConcurrentCommands(c *C) {
+	eventBus := NewInternalEventBus()
+	eventBus.AddHandler(&lockedEventHandler{}, &TestEvent{})
+	store := NewMemoryEventStore(eventBus)
+	repo, _ := NewCallbackRepository(store)
+	repo.RegisterAggregate(&TestDispatcherAggregate{}, func(id string) Aggregate {
+		return &TestDispatcherAggregate{NewAggregateBase(id)}
+	})
+	handler, _ := NewAggregateCommandHandler(repo)
+	handler.SetAggregate(&TestDispatcherAggregate{}, &TestCommand{})
+
+	tracer := NewMemoryTracer()
+	eventBus.SetTracer(tracer)
+	store.SetTracer(tracer)
+	repo.SetTracer(tracer)
+	handler.SetTracer(tracer)
+
+	// Commands for the same aggregate, and events without an aggregate id,
+	// have their own traces.
+	id := uuid.New()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.Check(handler.HandleCommand(&TestCommand{id, "command"}), IsNil)
+		}()
+		go func() {
+			defer wg.Done()
+			span := eventBus.startSpan("publish", SpanContext{}, nil)
+			eventBus.publishEventTraced(span.Context(), &TestEvent{"", "event"})
+			span.end(nil)
+		}()
+	}
+	wg.Wait()
+
+	traces := map[string][]SpanData{}
+	for _, span := range tracer.Spans() {
+		traces[span.Context.TraceID] = append(traces[span.Context.TraceID], span)
+	}
+	c.Assert(traces, HasLen, 20)
+	for _, spans := range traces {
+		if spans[0].Name == "handle_event" {
+			c.Assert(spanTree(c, spans), DeepEquals, []string{
+				"handle_event < publish",
+				"publish",
+			})
+			continue
+		}
+		c.Assert(spanTree(c, spans), DeepEquals, []string{
+			"load_events < load_aggregate",
+			"load_aggregate < handle_command",
+			"handle_event < save_events",
+			"save_events < save_aggregate",
+			"save_aggregate < handle_command",
+			"handle_command",
+		})
+	}
+}
+
+func (s *TracingSuite) TestEventStore(c *C) {
+	store := NewMemoryEventStore(nil)
+	tracer := NewMemoryTracer()
+	store.SetTracer(tracer)
+
+	id := uuid.New()
+	store.Save([]Event{&TestEvent{id, "event1"}})
+	store.Load(id)
+	store.AggregateVersion(id)
+	spans := tracer.Spans()
+	c.Assert(spans, HasLen, 3)
+	c.Assert(spans[0].Name, Equals, "save_events")
+	c.Assert(spans[1].Name, Equals, "load_events")
+	c.Assert(spans[2].Name, Equals, "version_events")
+	c.Assert(spans[2].Attributes, DeepEquals, map[string]string{
+		"component":   "memory_event_store",
+		"aggregateID": id,
+	})
+}
+
+func (s *TracingSuite) TestAsyncEventBus(c *C) {
+	bus, err := NewAsyncInternalEventBus(2, 10)
+	c.Assert(err, IsNil)
+	defer bus.Close()
+	tracer := NewMemoryTracer()
+	bus.SetTracer(tracer)
+	handler := NewMockEventHandler()
+	bus.AddHandler(handler, &TestEvent{})
+
+	// The span that publishes the event is the parent, even if it has ended
+	// when the event is handled.
+	event := &TestEvent{uuid.New(), "event1"}
+	span := bus.startSpan("publish", SpanContext{}, nil)
+	bus.publishEventTraced(span.Context(), event)
+	span.end(nil)
+	<-handler.recv
+	bus.Close()
+
+	spans := tracer.Spans()
+	c.Assert(spans, HasLen, 2)
+	c.Assert(spans[1].Name, Equals, "handle_event")
+	c.Assert(spans[1].Parent, Equals, span.Context())
+}
+
+func (s *TracingSuite) TestTraceparent(c *C) {
+	context := SpanContext{"0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"}
+	header := traceparent(context)
+	c.Assert(header, Equals, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	c.Assert(parseTraceparent(header), Equals, context)
+	c.Assert(traceparent(SpanContext{}), Equals, "")
+
+	for _, header := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"00-0af7651916cd43dd8448eb211c8031-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319x-b7ad6b7169203331-01",
+	} {
+		c.Assert(parseTraceparent(header).IsValid(), Equals, false, Commentf("header: %s", header))
+	}
+}
+
+func (s *TracingSuite) TestRedisEvent(c *C) {
+	context := SpanContext{"0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"}
+	event := &TestEvent{uuid.New(), "event1"}
+	data, err := marshalRedisEvent(event, context)
+	c.Assert(err, IsNil)
+	c.Assert(redisEventSpanContext(data), Equals, context)
+
+	// Events without a span context are marshaled as before.
+	data, err = marshalRedisEvent(event, SpanContext{})
+	c.Assert(err, IsNil)
+	c.Assert(redisEventSpanContext(data).IsValid(), Equals, false)
+}
+
+func (s *TracingSuite) TestAMQPHeaders(c *C) {
+	context := SpanContext{"0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"}
+	c.Assert(amqpSpanContext(amqpTraceHeaders(context)), Equals, context)
+	c.Assert(amqpTraceHeaders(SpanContext{}), DeepEquals, amqp.Table{})
+	c.Assert(amqpSpanContext(amqp.Table{}).IsValid(), Equals, false)
+}